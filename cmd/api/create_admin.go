@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"os"
+
+	"github.com/joefazee/learning-go-shop/internal/config"
+	"github.com/joefazee/learning-go-shop/internal/services"
+	"github.com/rs/zerolog"
+	"gorm.io/gorm"
+)
+
+// runCreateAdmin bootstraps an admin account:
+//
+//	ADMIN_PASSWORD=... go run ./cmd/api create-admin -email admin@example.com
+//
+// The password may also be given with -password, but the environment
+// variable keeps it out of shell history. To make an existing user admin
+// instead, pass -promote and no password; the user must have verified the
+// email:
+//
+//	go run ./cmd/api create-admin -email admin@example.com -promote
+func runCreateAdmin(ctx context.Context, args []string, db *gorm.DB, cfg *config.Config, log *zerolog.Logger) error {
+	fs := flag.NewFlagSet("create-admin", flag.ContinueOnError)
+	email := fs.String("email", "", "email of the admin account (required)")
+	password := fs.String("password", os.Getenv("ADMIN_PASSWORD"), "password for a new account (default $ADMIN_PASSWORD)")
+	firstName := fs.String("first-name", "Admin", "first name for a new account")
+	lastName := fs.String("last-name", "User", "last name for a new account")
+	promote := fs.Bool("promote", false, "promote an existing user with a verified email instead of creating one")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *email == "" {
+		fs.Usage()
+		return errors.New("-email is required")
+	}
+
+	tokenVersionService := services.NewTokenVersionService(db, cfg.Auth.TokenVersionCacheTTL)
+	adminUserService := services.NewAdminUserService(db, tokenVersionService)
+
+	user, created, err := adminUserService.CreateAdmin(ctx, *email, *password, *firstName, *lastName, *promote)
+	if err != nil {
+		return err
+	}
+
+	if created {
+		log.Info().Uint("user_id", user.ID).Str("email", user.Email).Msg("admin account created")
+	} else {
+		log.Info().Uint("user_id", user.ID).Str("email", user.Email).Msg("existing user promoted to admin")
+	}
+
+	return nil
+}
@@ -14,12 +14,19 @@ import (
 	"github.com/joefazee/learning-go-shop/internal/config"
 	"github.com/joefazee/learning-go-shop/internal/database"
 	"github.com/joefazee/learning-go-shop/internal/interfaces"
+	"github.com/joefazee/learning-go-shop/internal/jobs"
 	"github.com/joefazee/learning-go-shop/internal/logger"
 	"github.com/joefazee/learning-go-shop/internal/providers"
 	"github.com/joefazee/learning-go-shop/internal/server"
 	"github.com/joefazee/learning-go-shop/internal/services"
+	"github.com/joefazee/learning-go-shop/internal/telemetry"
+	"github.com/joefazee/learning-go-shop/internal/utils"
+	"github.com/redis/go-redis/v9"
 )
 
+// spans still buffered at shutdown get this long to be exported
+const tracingFlushTimeout = 5 * time.Second
+
 func main() {
 
 	log := logger.New()
@@ -39,28 +46,138 @@ func main() {
 	}
 
 	defer mainDB.Close()
+
+	// Subcommands
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "create-admin":
+			if err := runCreateAdmin(context.Background(), os.Args[2:], db, cfg, &log); err != nil {
+				log.Error().Err(err).Msg("create-admin failed")
+				mainDB.Close()
+				os.Exit(1)
+			}
+		default:
+			log.Error().Str("command", os.Args[1]).Msg("unknown command, available: create-admin")
+			mainDB.Close()
+			os.Exit(2)
+		}
+		return
+	}
+
 	gin.SetMode(cfg.Server.GinMode)
 
-	authService := services.NewAuthService(db, cfg)
+	shutdownTracing, err := telemetry.SetupTracing(context.Background(), &cfg.Tracing)
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to set up tracing")
+	}
+	if cfg.Tracing.Enabled {
+		if err := db.Use(telemetry.GormTracing{}); err != nil {
+			log.Fatal().Err(err).Msg("failed to instrument database for tracing")
+		}
+	}
+
+	var metrics *telemetry.Metrics
+	if cfg.Metrics.Enabled {
+		metrics = telemetry.NewMetrics()
+		if err := metrics.InstrumentDB(db, cfg.Metrics.LowStockThreshold); err != nil {
+			log.Fatal().Err(err).Msg("failed to instrument database for metrics")
+		}
+	}
+
+	var mailer interfaces.Mailer
+	switch cfg.Mail.Provider {
+	case "smtp":
+		mailer = providers.NewSMTPMailer(&cfg.Mail)
+	case "memory":
+		mailer = providers.NewMemoryMailer()
+	default:
+		mailer = providers.NewLogMailer(&log)
+	}
+
+	keys, err := utils.LoadKeySet(&cfg.JWT)
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to load jwt keys")
+	}
+
+	var loginAttemptStore interfaces.LoginAttemptStore
+	switch cfg.Auth.LoginThrottle.Store {
+	case "memory":
+		loginAttemptStore = providers.NewMemoryLoginAttemptStore()
+	default:
+		loginAttemptStore = providers.NewDBLoginAttemptStore(db)
+	}
+
+	tokenVersionService := services.NewTokenVersionService(db, cfg.Auth.TokenVersionCacheTTL)
+	loginThrottleService := services.NewLoginThrottleService(db, loginAttemptStore, &cfg.Auth.LoginThrottle)
+	authService := services.NewAuthService(db, cfg, keys, mailer, tokenVersionService, loginThrottleService)
 	productService := services.NewProductService(db)
-	userService := services.NewUserService(db)
+	userService := services.NewUserService(db, tokenVersionService)
+	roleService := services.NewRoleService(db, tokenVersionService, cfg.Auth.PermissionCacheTTL)
+	adminUserService := services.NewAdminUserService(db, tokenVersionService)
+
+	identityProviders := make([]interfaces.IdentityProvider, 0, len(cfg.OIDC.Providers))
+	for _, p := range cfg.OIDC.Providers {
+		identityProviders = append(identityProviders, providers.NewOIDCProvider(p, cfg.OIDC.RedirectURL))
+	}
+	identityService := services.NewIdentityService(db, cfg, authService, identityProviders...)
+	apiKeyService := services.NewAPIKeyService(db, roleService)
+	orderService := services.NewOrderService(db, cfg, keys, metrics)
+	cartService := services.NewCartService(db)
+	mfaService := services.NewMFAService(db, cfg)
+	sessionService := services.NewSessionService(db, cfg.Auth.TokenVersionCacheTTL)
+	abandonedCartService := services.NewAbandonedCartService(db, &cfg.Cart, providers.NewLogNotifier(&log))
 
 	var uploadProvider interfaces.UploadProvider
-	uploadProvider = providers.NewLocalProvider(cfg)
+	switch cfg.Upload.UploadProvider {
+	case "s3":
+		uploadProvider = providers.NewS3Provider(cfg)
+	default:
+		uploadProvider = providers.NewLocalProvider(cfg)
+	}
 
 	uploadService := services.NewUploadService(uploadProvider)
+	idempotencyService := services.NewIdempotencyService(db, cfg.Idempotency.KeyTTL)
 
-	srv := server.New(cfg, db, &log, authService, productService, userService, uploadService)
+	// version ที่ build นี้ต้องการ ถ้าอ่านไม่ได้ readiness จะเช็คแค่ dirty
+	migrationVersion, err := database.LatestMigrationVersion(cfg.Database.MigrationsPath)
+	if err != nil {
+		log.Warn().Err(err).Msg("failed to read migrations, readiness will not check schema version")
+	}
+	healthService := services.NewHealthService(db, uploadProvider, migrationVersion)
+
+	var rateLimitStore interfaces.RateLimitStore
+	switch cfg.RateLimit.Store {
+	case "redis":
+		redisOptions, err := redis.ParseURL(cfg.RateLimit.RedisURL)
+		if err != nil {
+			log.Fatal().Err(err).Msg("invalid REDIS_URL")
+		}
+		redisClient := redis.NewClient(redisOptions)
+		defer redisClient.Close()
+		rateLimitStore = providers.NewRedisRateLimitStore(redisClient)
+	default:
+		rateLimitStore = providers.NewMemoryRateLimitStore()
+	}
 
-	router := srv.SetupRoutes()
+	srv := server.New(cfg, db, &log, keys, authService, productService, userService, uploadService, orderService, cartService, mfaService, sessionService, abandonedCartService, tokenVersionService, roleService, adminUserService, identityService, apiKeyService, loginThrottleService, idempotencyService, healthService, rateLimitStore, metrics)
+
+	router, err := srv.SetupRoutes()
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to set up routes")
+	}
 
 	httpServer := &http.Server{
 		Addr:         fmt.Sprintf(":%s", cfg.Server.Port),
 		Handler:      router,
-		ReadTimeout:  10 * time.Second,
-		WriteTimeout: 10 * time.Second,
+		ReadTimeout:  cfg.Server.ReadTimeout,
+		WriteTimeout: cfg.Server.WriteTimeout,
 	}
 
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+
+	go jobs.NewAbandonedCartJob(abandonedCartService, cfg.Cart.AbandonCheckInterval, &log).Run(jobsCtx)
+
 	go func() {
 		log.Info().Str("port", cfg.Server.Port).Msg("starting http server")
 		if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
@@ -72,15 +189,31 @@ func main() {
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 
+	// ให้ load balancer เห็น /health/ready เป็น 503 ก่อนค่อยหยุดรับ connection
+	srv.StartDraining()
+	if cfg.Server.DrainDelay > 0 {
+		log.Info().Dur("delay", cfg.Server.DrainDelay).Msg("draining before shutdown")
+		time.Sleep(cfg.Server.DrainDelay)
+	}
+
 	log.Info().Msg("shutting down server")
-	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	stopJobs()
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
 	defer cancel()
 
 	if err := httpServer.Shutdown(ctx); err != nil {
 		log.Error().Err(err).Msg("failed to shutdown http server")
-		return
+	}
+
+	// ส่ง span ที่ค้างใน batch ออกไปก่อนปิด แม้ shutdown ข้างบนจะล้มเหลว
+	// ใช้ context ใหม่เพราะ ctx อาจหมดเวลาไปกับการรอ request ที่ค้าง
+	flushCtx, cancelFlush := context.WithTimeout(context.Background(), tracingFlushTimeout)
+	defer cancelFlush()
+	if err := shutdownTracing(flushCtx); err != nil {
+		log.Error().Err(err).Msg("failed to flush traces")
 	}
 
 	log.Info().Msg("shutting down database")
 
-}
\ No newline at end of file
+}
@@ -0,0 +1,19 @@
+DROP INDEX IF EXISTS idx_orders_guest_email;
+
+ALTER TABLE orders DROP CONSTRAINT IF EXISTS chk_orders_owner;
+
+-- Guest orders cannot survive the NOT NULL constraint
+DELETE FROM orders WHERE user_id IS NULL;
+
+ALTER TABLE orders
+    DROP COLUMN IF EXISTS guest_email,
+    DROP COLUMN IF EXISTS shipping_full_name,
+    DROP COLUMN IF EXISTS shipping_phone,
+    DROP COLUMN IF EXISTS shipping_address_line1,
+    DROP COLUMN IF EXISTS shipping_address_line2,
+    DROP COLUMN IF EXISTS shipping_city,
+    DROP COLUMN IF EXISTS shipping_state,
+    DROP COLUMN IF EXISTS shipping_postal_code,
+    DROP COLUMN IF EXISTS shipping_country;
+
+ALTER TABLE orders ALTER COLUMN user_id SET NOT NULL;
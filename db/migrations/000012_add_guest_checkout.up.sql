@@ -0,0 +1,18 @@
+ALTER TABLE orders ALTER COLUMN user_id DROP NOT NULL;
+
+ALTER TABLE orders
+    ADD COLUMN guest_email VARCHAR(255),
+    ADD COLUMN shipping_full_name VARCHAR(200),
+    ADD COLUMN shipping_phone VARCHAR(20),
+    ADD COLUMN shipping_address_line1 VARCHAR(255),
+    ADD COLUMN shipping_address_line2 VARCHAR(255),
+    ADD COLUMN shipping_city VARCHAR(100),
+    ADD COLUMN shipping_state VARCHAR(100),
+    ADD COLUMN shipping_postal_code VARCHAR(20),
+    ADD COLUMN shipping_country VARCHAR(100);
+
+-- An order belongs either to a registered user or to a guest email
+ALTER TABLE orders ADD CONSTRAINT chk_orders_owner
+    CHECK (user_id IS NOT NULL OR guest_email IS NOT NULL);
+
+CREATE INDEX idx_orders_guest_email ON orders(LOWER(guest_email)) WHERE user_id IS NULL;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_carts_updated_at;
+DROP TABLE IF EXISTS cart_abandonments;
@@ -0,0 +1,18 @@
+CREATE TABLE cart_abandonments (
+    id SERIAL PRIMARY KEY,
+    cart_id INTEGER NOT NULL REFERENCES carts(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    item_count INTEGER NOT NULL,
+    cart_value DECIMAL(10,2) NOT NULL,
+    cart_updated_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    detected_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    reminder_sent_at TIMESTAMP WITH TIME ZONE,
+    recovered_at TIMESTAMP WITH TIME ZONE,
+    order_id INTEGER REFERENCES orders(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_cart_abandonments_cart_id ON cart_abandonments(cart_id);
+CREATE INDEX idx_cart_abandonments_detected_at ON cart_abandonments(detected_at);
+CREATE INDEX idx_carts_updated_at ON carts(updated_at);
@@ -0,0 +1,8 @@
+-- Price of the product at the time it was added to the cart
+ALTER TABLE cart_items ADD COLUMN price DECIMAL(10,2);
+
+UPDATE cart_items SET price = products.price
+FROM products
+WHERE products.id = cart_items.product_id;
+
+ALTER TABLE cart_items ALTER COLUMN price SET NOT NULL;
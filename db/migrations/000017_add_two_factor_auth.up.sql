@@ -0,0 +1,15 @@
+ALTER TABLE users
+    ADD COLUMN totp_secret VARCHAR(64),
+    ADD COLUMN totp_enabled_at TIMESTAMP WITH TIME ZONE,
+    ADD COLUMN totp_last_step BIGINT NOT NULL DEFAULT 0;
+
+CREATE TABLE mfa_recovery_codes (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    code_hash VARCHAR(64) NOT NULL,
+    used_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(user_id, code_hash)
+);
+
+CREATE INDEX idx_mfa_recovery_codes_user_id ON mfa_recovery_codes(user_id);
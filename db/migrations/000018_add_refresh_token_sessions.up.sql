@@ -0,0 +1,18 @@
+ALTER TABLE refresh_tokens
+    ADD COLUMN family_id VARCHAR(36),
+    ADD COLUMN user_agent VARCHAR(512),
+    ADD COLUMN ip_address VARCHAR(45),
+    ADD COLUMN session_created_at TIMESTAMP WITH TIME ZONE,
+    ADD COLUMN last_used_at TIMESTAMP WITH TIME ZONE,
+    ADD COLUMN rotated_at TIMESTAMP WITH TIME ZONE;
+
+-- Existing tokens each become their own session
+UPDATE refresh_tokens
+SET family_id = gen_random_uuid()::text,
+    session_created_at = created_at;
+
+ALTER TABLE refresh_tokens
+    ALTER COLUMN family_id SET NOT NULL,
+    ALTER COLUMN session_created_at SET NOT NULL;
+
+CREATE INDEX idx_refresh_tokens_family_id ON refresh_tokens(family_id);
@@ -0,0 +1,9 @@
+-- Sessions created with opaque tokens cannot be restored
+DELETE FROM refresh_tokens WHERE token IS NULL;
+
+DROP INDEX IF EXISTS idx_refresh_tokens_token_hash;
+
+ALTER TABLE refresh_tokens
+    ALTER COLUMN token SET NOT NULL,
+    DROP COLUMN IF EXISTS token_hash,
+    DROP COLUMN IF EXISTS mfa;
@@ -0,0 +1,17 @@
+-- Refresh tokens become opaque random strings stored as SHA-256 hashes.
+-- The raw token column stays (nullable) for the dual-read period: existing
+-- JWT refresh tokens are hashed below so they keep working, and rows written
+-- by instances still on the previous release are matched on the raw value.
+-- token_hash stays nullable too, those instances only fill in token. A later
+-- migration hashes what is left, drops token and sets token_hash NOT NULL
+-- once no instance of the previous release is running.
+ALTER TABLE refresh_tokens
+    ADD COLUMN token_hash VARCHAR(64),
+    ADD COLUMN mfa BOOLEAN NOT NULL DEFAULT false;
+
+UPDATE refresh_tokens SET token_hash = encode(sha256(token::bytea), 'hex');
+
+ALTER TABLE refresh_tokens
+    ALTER COLUMN token DROP NOT NULL;
+
+CREATE UNIQUE INDEX idx_refresh_tokens_token_hash ON refresh_tokens(token_hash);
@@ -0,0 +1,13 @@
+CREATE TYPE user_role AS ENUM ('customer', 'admin');
+
+ALTER TABLE users DROP CONSTRAINT IF EXISTS fk_users_role;
+UPDATE users SET role = 'customer' WHERE role NOT IN ('customer', 'admin');
+ALTER TABLE users
+    ALTER COLUMN role DROP DEFAULT,
+    ALTER COLUMN role DROP NOT NULL;
+ALTER TABLE users ALTER COLUMN role TYPE user_role USING role::user_role;
+ALTER TABLE users ALTER COLUMN role SET DEFAULT 'customer';
+
+DROP TABLE IF EXISTS role_permissions;
+DROP TABLE IF EXISTS permissions;
+DROP TABLE IF EXISTS roles;
@@ -0,0 +1,55 @@
+CREATE TABLE roles (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(50) UNIQUE NOT NULL,
+    description TEXT,
+    built_in BOOLEAN NOT NULL DEFAULT false,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE permissions (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(100) UNIQUE NOT NULL,
+    description TEXT
+);
+
+CREATE TABLE role_permissions (
+    role_id INTEGER NOT NULL REFERENCES roles(id) ON DELETE CASCADE,
+    permission_id INTEGER NOT NULL REFERENCES permissions(id) ON DELETE CASCADE,
+    PRIMARY KEY (role_id, permission_id)
+);
+
+INSERT INTO permissions (name, description) VALUES
+    ('catalog:write', 'Create, update and delete categories, products and product images'),
+    ('orders:manage', 'View and manage orders of all customers'),
+    ('users:manage', 'View, deactivate and sign out users'),
+    ('roles:manage', 'Manage roles and assign them to users'),
+    ('reports:read', 'View admin reports');
+
+INSERT INTO roles (name, description, built_in) VALUES
+    ('customer', 'Regular shop customer', true),
+    ('admin', 'Full access to every admin feature', true),
+    ('catalog_editor', 'Maintains the product catalog', false),
+    ('support', 'Helps customers with orders and accounts', false);
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id FROM roles r CROSS JOIN permissions p WHERE r.name = 'admin';
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id FROM roles r JOIN permissions p ON p.name = 'catalog:write'
+WHERE r.name = 'catalog_editor';
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id FROM roles r JOIN permissions p ON p.name IN ('orders:manage', 'reports:read')
+WHERE r.name = 'support';
+
+-- users.role เปลี่ยนจาก enum เป็นชื่อ role ในตาราง roles
+ALTER TABLE users ALTER COLUMN role DROP DEFAULT;
+ALTER TABLE users ALTER COLUMN role TYPE VARCHAR(50) USING role::text;
+UPDATE users SET role = 'customer' WHERE role IS NULL;
+ALTER TABLE users
+    ALTER COLUMN role SET DEFAULT 'customer',
+    ALTER COLUMN role SET NOT NULL,
+    ADD CONSTRAINT fk_users_role FOREIGN KEY (role) REFERENCES roles(name) ON UPDATE CASCADE;
+
+DROP TYPE user_role;
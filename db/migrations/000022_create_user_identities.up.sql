@@ -0,0 +1,28 @@
+CREATE TABLE user_identities (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    provider VARCHAR(50) NOT NULL,
+    subject VARCHAR(255) NOT NULL,
+    email VARCHAR(255),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    last_login_at TIMESTAMP WITH TIME ZONE,
+    UNIQUE(provider, subject),
+    UNIQUE(user_id, provider)
+);
+
+CREATE INDEX idx_user_identities_user_id ON user_identities(user_id);
+
+CREATE TABLE oidc_auth_requests (
+    id SERIAL PRIMARY KEY,
+    state_hash VARCHAR(64) UNIQUE NOT NULL,
+    provider VARCHAR(50) NOT NULL,
+    purpose VARCHAR(20) NOT NULL,
+    user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+    nonce VARCHAR(64) NOT NULL,
+    code_verifier VARCHAR(128) NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_oidc_auth_requests_user_id ON oidc_auth_requests(user_id);
+CREATE INDEX idx_oidc_auth_requests_expires_at ON oidc_auth_requests(expires_at);
@@ -0,0 +1,20 @@
+CREATE TABLE api_keys (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    prefix VARCHAR(16) UNIQUE NOT NULL,
+    secret_hash VARCHAR(64) NOT NULL,
+    scopes TEXT NOT NULL DEFAULT '',
+    created_by_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    expires_at TIMESTAMP WITH TIME ZONE,
+    last_used_at TIMESTAMP WITH TIME ZONE,
+    last_used_ip VARCHAR(45),
+    revoked_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO permissions (name, description) VALUES
+    ('api_keys:manage', 'Issue and revoke API keys for integrations');
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id FROM roles r JOIN permissions p ON p.name = 'api_keys:manage'
+WHERE r.name = 'admin';
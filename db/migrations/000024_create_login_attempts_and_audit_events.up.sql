@@ -0,0 +1,22 @@
+CREATE TABLE login_attempts (
+    key VARCHAR(320) PRIMARY KEY,
+    failures INTEGER NOT NULL DEFAULT 0,
+    last_failure_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    locked_until TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX idx_login_attempts_last_failure_at ON login_attempts(last_failure_at);
+
+CREATE TABLE audit_events (
+    id SERIAL PRIMARY KEY,
+    type VARCHAR(50) NOT NULL,
+    user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    actor_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    subject VARCHAR(320),
+    ip_address VARCHAR(45),
+    details TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_audit_events_type_created_at ON audit_events(type, created_at);
+CREATE INDEX idx_audit_events_user_id ON audit_events(user_id);
@@ -0,0 +1,2 @@
+-- Deleted responses cannot be restored; retries simply run again
+SELECT 1;
@@ -0,0 +1,4 @@
+-- Anonymous keys are now scoped to the client IP, so rows stored under the
+-- shared "anon" scope can never be replayed. Some of them hold the tokens
+-- returned by /auth/register.
+DELETE FROM idempotency_keys WHERE scope = 'anon';
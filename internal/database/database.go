@@ -22,6 +22,8 @@ func New(cfg config.DatabaseConfig) (*gorm.DB, error) {
 
 	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{
 		Logger: logger.Default.LogMode(logger.Info),
+		// แปลง unique/foreign key violation เป็น gorm.ErrDuplicatedKey/ErrForeignKeyViolated
+		TranslateError: true,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to database: %w", err)
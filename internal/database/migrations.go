@@ -0,0 +1,40 @@
+package database
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// LatestMigrationVersion returns the highest version among the
+// golang-migrate files (<version>_<name>.up.sql) in dir
+func LatestMigrationVersion(dir string) (uint, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, err
+	}
+
+	var latest uint
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".up.sql") {
+			continue
+		}
+
+		prefix, _, ok := strings.Cut(name, "_")
+		if !ok {
+			continue
+		}
+		version, err := strconv.ParseUint(prefix, 10, 64)
+		if err != nil {
+			continue
+		}
+		latest = max(latest, uint(version))
+	}
+
+	if latest == 0 {
+		return 0, fmt.Errorf("no migrations found in %s", dir)
+	}
+	return latest, nil
+}
@@ -31,10 +31,179 @@ type UserResponse struct {
 	Phone     string `json:"phone"`
 	Role      string `json:"role"`
 	IsActive  bool   `json:"is_active"`
+
+	EmailVerified    bool `json:"email_verified"`
+	TwoFactorEnabled bool `json:"two_factor_enabled"`
+}
+
+type VerifyEmailRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+type ResendVerificationRequest struct {
+	Email string `json:"email" binding:"required,email"`
 }
 
 type UpdateProfileRequest struct {
 	FirstName string `json:"first_name" binding:"required"`
 	LastName  string `json:"last_name" binding:"required"`
 	Phone     string `json:"phone"`
-}
\ No newline at end of file
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type ResetPasswordRequest struct {
+	Token       string `json:"token" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required,min=8"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required,min=8"`
+}
+
+// MFAChallengeResponse is returned by login instead of tokens when the
+// account has two-factor authentication enabled
+type MFAChallengeResponse struct {
+	MFARequired bool   `json:"mfa_required"`
+	MFAToken    string `json:"mfa_token"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+type MFALoginRequest struct {
+	MFAToken string `json:"mfa_token" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+type TwoFactorSetupResponse struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type DisableTwoFactorRequest struct {
+	Password string `json:"password" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// ClientInfo describes the client a session is created for
+type ClientInfo struct {
+	UserAgent string
+	IPAddress string
+}
+
+type SessionResponse struct {
+	ID         string `json:"id"`
+	UserAgent  string `json:"user_agent"`
+	IPAddress  string `json:"ip_address"`
+	CreatedAt  string `json:"created_at"`
+	LastUsedAt string `json:"last_used_at"`
+	ExpiresAt  string `json:"expires_at"`
+	Current    bool   `json:"current"`
+}
+
+type RevokeSessionsResponse struct {
+	Revoked int64 `json:"revoked"`
+}
+
+type AdminUserListQuery struct {
+	Search   string
+	Role     string
+	IsActive *bool
+	Page     int
+	Limit    int
+}
+
+type AuditEventListQuery struct {
+	Type   string
+	UserID uint
+	Page   int
+	Limit  int
+}
+
+type AuditEventResponse struct {
+	ID        uint   `json:"id"`
+	Type      string `json:"type"`
+	UserID    *uint  `json:"user_id"`
+	ActorID   *uint  `json:"actor_id"`
+	Subject   string `json:"subject"`
+	IPAddress string `json:"ip_address"`
+	Details   string `json:"details"`
+	CreatedAt string `json:"created_at"`
+}
+
+// AdminUpdateUserRequest changes account status and role. Omitted fields are
+// left unchanged.
+type AdminUpdateUserRequest struct {
+	IsActive *bool   `json:"is_active"`
+	Role     *string `json:"role"`
+}
+
+type AdminUserResponse struct {
+	UserResponse
+	CreatedAt      string `json:"created_at"`
+	ActiveSessions int64  `json:"active_sessions"`
+}
+
+type ForceLogoutResponse struct {
+	Revoked int64 `json:"revoked"`
+}
+
+type OIDCProviderResponse struct {
+	Name string `json:"name"`
+}
+
+// OIDCStartResponse tells the client where to send the user. The client must
+// keep State and check it against the state returned to the redirect URL.
+type OIDCStartResponse struct {
+	AuthorizationURL string `json:"authorization_url"`
+	State            string `json:"state"`
+	ExpiresIn        int    `json:"expires_in"`
+}
+
+type OIDCCallbackRequest struct {
+	Code  string `json:"code" binding:"required"`
+	State string `json:"state" binding:"required"`
+}
+
+type IdentityResponse struct {
+	ID          uint    `json:"id"`
+	Provider    string  `json:"provider"`
+	Email       string  `json:"email"`
+	CreatedAt   string  `json:"created_at"`
+	LastLoginAt *string `json:"last_login_at"`
+}
+
+type CreateAPIKeyRequest struct {
+	Name          string   `json:"name" binding:"required,max=100"`
+	Scopes        []string `json:"scopes" binding:"required,min=1"`
+	ExpiresInDays int      `json:"expires_in_days" binding:"min=0,max=3650"` // 0 = never
+}
+
+type APIKeyResponse struct {
+	ID          uint     `json:"id"`
+	Name        string   `json:"name"`
+	Prefix      string   `json:"prefix"`
+	Scopes      []string `json:"scopes"`
+	CreatedByID *uint    `json:"created_by_id"`
+	ExpiresAt   *string  `json:"expires_at"`
+	LastUsedAt  *string  `json:"last_used_at"`
+	LastUsedIP  string   `json:"last_used_ip"`
+	RevokedAt   *string  `json:"revoked_at"`
+	CreatedAt   string   `json:"created_at"`
+}
+
+// CreatedAPIKeyResponse carries the full key. It is shown only once.
+type CreatedAPIKeyResponse struct {
+	APIKeyResponse
+	Key string `json:"key"`
+}
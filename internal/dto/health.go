@@ -0,0 +1,19 @@
+package dto
+
+const (
+	HealthStatusOK       = "ok"
+	HealthStatusFail     = "fail"
+	HealthStatusDraining = "draining"
+)
+
+type HealthResponse struct {
+	Status string                       `json:"status"`
+	Checks map[string]HealthCheckResult `json:"checks,omitempty"`
+}
+
+// HealthCheckResult is public, so it carries no errors or details; those are
+// logged by the health service
+type HealthCheckResult struct {
+	Status    string  `json:"status"`
+	LatencyMS float64 `json:"latency_ms"`
+}
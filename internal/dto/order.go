@@ -10,26 +10,133 @@ type UpdateCartItemRequest struct {
 }
 
 type CartResponse struct {
-	ID        uint               `json:"id"`
-	UserID    uint               `json:"user_id"`
-	CartItems []CartItemResponse `json:"cart_items"`
-	Total     float64            `json:"total"`
+	ID          uint               `json:"id"`
+	UserID      uint               `json:"user_id"`
+	CartItems   []CartItemResponse `json:"cart_items"`
+	Total       float64            `json:"total"`
+	HasWarnings bool               `json:"has_warnings"`
 }
 
 type CartItemResponse struct {
-	ID       uint            `json:"id"`
-	Product  ProductResponse `json:"product"`
-	Quantity int             `json:"quantity"`
-	Subtotal float64         `json:"subtotal"`
+	ID       uint              `json:"id"`
+	Product  ProductResponse   `json:"product"`
+	Quantity int               `json:"quantity"`
+	Price    float64           `json:"price"`
+	Subtotal float64           `json:"subtotal"`
+	Warnings []CartItemWarning `json:"warnings"`
+}
+
+// Cart warning types
+const (
+	CartWarningPriceChanged    = "price_changed"
+	CartWarningUnavailable     = "unavailable"
+	CartWarningQuantityReduced = "quantity_reduced"
+)
+
+// CartItemWarning describes a change to a cart line since it was added
+type CartItemWarning struct {
+	Type              string   `json:"type"`
+	OldPrice          *float64 `json:"old_price,omitempty"`
+	NewPrice          *float64 `json:"new_price,omitempty"`
+	RequestedQuantity *int     `json:"requested_quantity,omitempty"`
+	AvailableQuantity *int     `json:"available_quantity,omitempty"`
+}
+
+type CartChangesResponse struct {
+	CartItemID uint              `json:"cart_item_id"`
+	ProductID  uint              `json:"product_id"`
+	Warnings   []CartItemWarning `json:"warnings"`
+}
+
+type AbandonedCartRunResult struct {
+	Detected         int `json:"detected"`
+	RemindersSent    int `json:"reminders_sent"`
+	ReminderFailures int `json:"reminder_failures"`
+}
+
+type AbandonedCartReport struct {
+	From           string  `json:"from"`
+	To             string  `json:"to"`
+	AbandonedCount int64   `json:"abandoned_count"`
+	AbandonedValue float64 `json:"abandoned_value"`
+	RemindersSent  int64   `json:"reminders_sent"`
+	RecoveredCount int64   `json:"recovered_count"`
+	RecoveredValue float64 `json:"recovered_value"`
+	RecoveryRate   float64 `json:"recovery_rate"`
+}
+
+type GuestCheckoutRequest struct {
+	Email           string                 `json:"email" binding:"required,email"`
+	ShippingAddress ShippingAddressRequest `json:"shipping_address" binding:"required"`
+	Items           []GuestCheckoutItem    `json:"items" binding:"required,min=1,dive"`
+}
+
+type GuestCheckoutItem struct {
+	ProductID uint `json:"product_id" binding:"required"`
+	Quantity  int  `json:"quantity" binding:"required,min=1"`
+}
+
+type ShippingAddressRequest struct {
+	FullName     string `json:"full_name" binding:"required"`
+	Phone        string `json:"phone"`
+	AddressLine1 string `json:"address_line1" binding:"required"`
+	AddressLine2 string `json:"address_line2"`
+	City         string `json:"city" binding:"required"`
+	State        string `json:"state"`
+	PostalCode   string `json:"postal_code" binding:"required"`
+	Country      string `json:"country" binding:"required"`
+}
+
+type GuestCheckoutResponse struct {
+	Order       OrderResponse `json:"order"`
+	LookupToken string        `json:"lookup_token"`
+	LookupURL   string        `json:"lookup_url"`
+}
+
+// ClaimGuestOrdersRequest proves ownership of the guest email with a lookup
+// token from one of its orders, since the account email is not verified
+type ClaimGuestOrdersRequest struct {
+	LookupToken string `json:"lookup_token" binding:"required"`
+}
+
+type ClaimGuestOrdersResponse struct {
+	Claimed int64 `json:"claimed"`
+}
+
+// AdminOrderListQuery filters the order list staff see. Email matches guest
+// orders and orders of the account with that email.
+type AdminOrderListQuery struct {
+	Status string
+	UserID uint
+	Email  string
+	Page   int
+	Limit  int
+}
+
+type UpdateOrderStatusRequest struct {
+	Status string `json:"status" binding:"required,oneof=confirmed shipped delivered cancelled"`
 }
 
 type OrderResponse struct {
-	ID          uint                `json:"id"`
-	UserID      uint                `json:"user_id"`
-	Status      string              `json:"status"`
-	TotalAmount float64             `json:"total_amount"`
-	OrderItems  []OrderItemResponse `json:"order_items"`
-	CreatedAt   string              `json:"created_at"`
+	ID              uint                     `json:"id"`
+	UserID          *uint                    `json:"user_id"`
+	GuestEmail      string                   `json:"guest_email,omitempty"`
+	Status          string                   `json:"status"`
+	TotalAmount     float64                  `json:"total_amount"`
+	ShippingAddress *ShippingAddressResponse `json:"shipping_address,omitempty"`
+	OrderItems      []OrderItemResponse      `json:"order_items"`
+	CreatedAt       string                   `json:"created_at"`
+}
+
+type ShippingAddressResponse struct {
+	FullName     string `json:"full_name"`
+	Phone        string `json:"phone"`
+	AddressLine1 string `json:"address_line1"`
+	AddressLine2 string `json:"address_line2"`
+	City         string `json:"city"`
+	State        string `json:"state"`
+	PostalCode   string `json:"postal_code"`
+	Country      string `json:"country"`
 }
 
 type OrderItemResponse struct {
@@ -37,4 +144,4 @@ type OrderItemResponse struct {
 	Product  ProductResponse `json:"product"`
 	Quantity int             `json:"quantity"`
 	Price    float64         `json:"price"`
-}
\ No newline at end of file
+}
@@ -0,0 +1,29 @@
+package dto
+
+type CreateRoleRequest struct {
+	Name        string   `json:"name" binding:"required,max=50"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+}
+
+type UpdateRoleRequest struct {
+	Description *string  `json:"description"`
+	Permissions []string `json:"permissions"`
+}
+
+type AssignRoleRequest struct {
+	Role string `json:"role" binding:"required"`
+}
+
+type RoleResponse struct {
+	ID          uint     `json:"id"`
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	BuiltIn     bool     `json:"built_in"`
+	Permissions []string `json:"permissions"`
+}
+
+type PermissionResponse struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
@@ -0,0 +1,21 @@
+package interfaces
+
+import "context"
+
+// IdentityClaims are the verified claims of an OpenID Connect ID token
+type IdentityClaims struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	GivenName     string
+	FamilyName    string
+	Name          string
+}
+
+// IdentityProvider runs the authorization code flow with PKCE against an
+// external OpenID Connect issuer
+type IdentityProvider interface {
+	Name() string
+	AuthCodeURL(ctx context.Context, state, nonce, codeVerifier string) (string, error)
+	Exchange(ctx context.Context, code, codeVerifier, nonce string) (*IdentityClaims, error)
+}
@@ -0,0 +1,29 @@
+package interfaces
+
+import (
+	"context"
+	"time"
+)
+
+// LoginAttempts is the failed login state of one key (an account or an IP)
+type LoginAttempts struct {
+	Failures      int
+	LastFailureAt time.Time
+	LockedUntil   time.Time
+}
+
+// LoginAttemptStore keeps failed login counters. Implementations must be safe
+// for concurrent use.
+type LoginAttemptStore interface {
+	// Get returns the state of key, or a zero value if there is none
+	Get(ctx context.Context, key string) (*LoginAttempts, error)
+
+	// RecordFailure adds a failure and returns the new state. Failures older
+	// than window are forgotten first.
+	RecordFailure(ctx context.Context, key string, now time.Time, window time.Duration) (*LoginAttempts, error)
+
+	Lock(ctx context.Context, key string, until time.Time) error
+
+	// Reset forgets every failure and lock of key
+	Reset(ctx context.Context, key string) error
+}
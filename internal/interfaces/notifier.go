@@ -0,0 +1,23 @@
+package interfaces
+
+import "context"
+
+// AbandonedCartItem is a single line shown in a cart reminder
+type AbandonedCartItem struct {
+	ProductName string
+	Quantity    int
+	Price       float64
+}
+
+// AbandonedCartNotification carries what a reminder needs to reach the user
+type AbandonedCartNotification struct {
+	UserID    uint
+	Email     string
+	FirstName string
+	CartValue float64
+	Items     []AbandonedCartItem
+}
+
+type Notifier interface {
+	NotifyAbandonedCart(ctx context.Context, notification *AbandonedCartNotification) error
+}
@@ -0,0 +1,26 @@
+package interfaces
+
+import (
+	"context"
+	"time"
+)
+
+// RateLimitResult is the state of a token bucket after one request
+type RateLimitResult struct {
+	Allowed   bool
+	Remaining int
+
+	// ResetAfter is how long until the bucket is full again
+	ResetAfter time.Duration
+
+	// RetryAfter is how long until the next token, set when not allowed
+	RetryAfter time.Duration
+}
+
+// RateLimitStore keeps token buckets. Implementations must be safe for
+// concurrent use.
+type RateLimitStore interface {
+	// Allow takes a token from the bucket of key. The bucket holds up to limit
+	// tokens and refills limit tokens every period.
+	Allow(ctx context.Context, key string, limit int, period time.Duration) (*RateLimitResult, error)
+}
@@ -1,8 +1,14 @@
 package interfaces
 
-import "mime/multipart"
+import (
+	"context"
+	"mime/multipart"
+)
 
 type UploadProvider interface {
-	UploadFile(file *multipart.FileHeader, path string) (string, error)
-	DeleteFile(path string) error
+	UploadFile(ctx context.Context, file *multipart.FileHeader, path string) (string, error)
+	DeleteFile(ctx context.Context, path string) error
+
+	// CheckHealth reports whether files can currently be stored
+	CheckHealth(ctx context.Context) error
 }
\ No newline at end of file
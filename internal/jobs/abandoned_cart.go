@@ -0,0 +1,61 @@
+package jobs
+
+import (
+	"context"
+	"time"
+
+	"github.com/joefazee/learning-go-shop/internal/services"
+	"github.com/rs/zerolog"
+)
+
+// AbandonedCartJob periodically looks for abandoned carts and sends reminders
+type AbandonedCartJob struct {
+	service  *services.AbandonedCartService
+	interval time.Duration
+	logger   *zerolog.Logger
+}
+
+func NewAbandonedCartJob(service *services.AbandonedCartService, interval time.Duration, logger *zerolog.Logger) *AbandonedCartJob {
+	return &AbandonedCartJob{
+		service:  service,
+		interval: interval,
+		logger:   logger,
+	}
+}
+
+// Run blocks until ctx is cancelled. An interval of zero disables the job.
+func (j *AbandonedCartJob) Run(ctx context.Context) {
+	if j.interval <= 0 {
+		j.logger.Info().Msg("abandoned cart job disabled")
+		return
+	}
+
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			j.runOnce(ctx, now)
+		}
+	}
+}
+
+func (j *AbandonedCartJob) runOnce(ctx context.Context, now time.Time) {
+	// stop กลางรอบได้ตอน shutdown
+	result, err := j.service.DetectAbandonedCarts(ctx, now)
+	if err != nil {
+		j.logger.Error().Err(err).Msg("abandoned cart job failed")
+	}
+	if result == nil {
+		return
+	}
+
+	j.logger.Info().
+		Int("detected", result.Detected).
+		Int("reminders_sent", result.RemindersSent).
+		Int("reminder_failures", result.ReminderFailures).
+		Msg("abandoned cart job finished")
+}
@@ -1,6 +1,7 @@
 package logger
 
 import (
+	"context"
 	"os"
 	"time"
 
@@ -17,4 +18,10 @@ func New() zerolog.Logger {
 
 	return log.Logger
 
-}
\ No newline at end of file
+}
+
+// FromContext returns the request scoped logger stored by the request logging
+// middleware, or a disabled logger when ctx has none
+func FromContext(ctx context.Context) *zerolog.Logger {
+	return zerolog.Ctx(ctx)
+}
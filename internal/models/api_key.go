@@ -0,0 +1,35 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// APIKey lets an integration call permission-protected endpoints without a
+// user login. Only the hash of the secret is stored.
+type APIKey struct {
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	Name        string     `json:"name" gorm:"not null"`
+	Prefix      string     `json:"prefix" gorm:"uniqueIndex;not null"`
+	SecretHash  string     `json:"-" gorm:"not null"`
+	Scopes      string     `json:"-" gorm:"not null;default:''"` // space separated permissions
+	CreatedByID *uint      `json:"created_by_id"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+	LastUsedAt  *time.Time `json:"last_used_at"`
+	LastUsedIP  string     `json:"last_used_ip" gorm:"column:last_used_ip"`
+	RevokedAt   *time.Time `json:"revoked_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+func (APIKey) TableName() string {
+	return "api_keys"
+}
+
+func (k *APIKey) ScopeList() []string {
+	return strings.Fields(k.Scopes)
+}
+
+// Active reports whether the key may be used at t
+func (k *APIKey) Active(t time.Time) bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || t.Before(*k.ExpiresAt))
+}
@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// AuditEvent records a security relevant event
+type AuditEvent struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	Type      string    `json:"type" gorm:"not null"`
+	UserID    *uint     `json:"user_id"`
+	ActorID   *uint     `json:"actor_id"` // staff member who caused the event, if any
+	Subject   string    `json:"subject"`  // email or IP the event is about
+	IPAddress string    `json:"ip_address"`
+	Details   string    `json:"details"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Audit event types
+const (
+	AuditAccountLocked   = "account_locked"
+	AuditAccountUnlocked = "account_unlocked"
+	AuditIPLocked        = "ip_locked"
+	AuditIPUnlocked      = "ip_unlocked"
+)
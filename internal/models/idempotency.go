@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// IdempotencyKey remembers the response to a request sent with an
+// Idempotency-Key header so a retry gets the same response. StatusCode is nil
+// while the first request is still running.
+type IdempotencyKey struct {
+	ID           uint   `gorm:"primaryKey"`
+	Scope        string `gorm:"not null;uniqueIndex:idx_idempotency_keys_scope_key"` // user the key belongs to, or the client IP
+	Key          string `gorm:"not null;uniqueIndex:idx_idempotency_keys_scope_key"`
+	Fingerprint  string `gorm:"not null"` // hash of method, route and body
+	StatusCode   *int
+	ContentType  string
+	ResponseBody []byte
+	CreatedAt    time.Time
+	ExpiresAt    time.Time `gorm:"not null"`
+}
+
+func (IdempotencyKey) TableName() string {
+	return "idempotency_keys"
+}
@@ -0,0 +1,40 @@
+package models
+
+import "time"
+
+// UserIdentity links an account at an external OpenID Connect provider to a user
+type UserIdentity struct {
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	UserID      uint       `json:"user_id" gorm:"not null;index"`
+	Provider    string     `json:"provider" gorm:"not null"`
+	Subject     string     `json:"-" gorm:"not null"`
+	Email       string     `json:"email"`
+	CreatedAt   time.Time  `json:"created_at"`
+	LastLoginAt *time.Time `json:"last_login_at"`
+
+	User User `json:"-"`
+}
+
+// OIDC flow purposes
+const (
+	OIDCPurposeLogin = "login"
+	OIDCPurposeLink  = "link"
+)
+
+// OIDCAuthRequest holds the state, nonce and PKCE verifier of a started
+// authorization code flow until the user comes back from the provider
+type OIDCAuthRequest struct {
+	ID           uint      `gorm:"primaryKey"`
+	StateHash    string    `gorm:"uniqueIndex;not null"`
+	Provider     string    `gorm:"not null"`
+	Purpose      string    `gorm:"not null"`
+	UserID       *uint     `gorm:"index"`
+	Nonce        string    `gorm:"not null"`
+	CodeVerifier string    `gorm:"not null"`
+	ExpiresAt    time.Time `gorm:"not null"`
+	CreatedAt    time.Time
+}
+
+func (OIDCAuthRequest) TableName() string {
+	return "oidc_auth_requests"
+}
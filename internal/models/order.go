@@ -8,18 +8,37 @@ import (
 
 type Order struct {
 	ID          uint           `json:"id" gorm:"primaryKey"`
-	UserID      uint           `json:"user_id" gorm:"not null"`
+	UserID      *uint          `json:"user_id"`
+	GuestEmail  string         `json:"guest_email"`
 	Status      OrderStatus    `json:"status" gorm:"default:pending"`
 	TotalAmount float64        `json:"total_amount" gorm:"not null"`
 	CreatedAt   time.Time      `json:"created_at"`
 	UpdatedAt   time.Time      `json:"updated_at"`
 	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
 
+	ShippingAddress ShippingAddress `json:"shipping_address" gorm:"embedded;embeddedPrefix:shipping_"`
+
 	// Relationships
-	User       User        `json:"user"`
+	User       *User       `json:"user"`
 	OrderItems []OrderItem `json:"order_items"`
 }
 
+// IsGuest reports whether the order was placed without an account
+func (o *Order) IsGuest() bool {
+	return o.UserID == nil
+}
+
+type ShippingAddress struct {
+	FullName     string `json:"full_name"`
+	Phone        string `json:"phone"`
+	AddressLine1 string `json:"address_line1" gorm:"column:address_line1"`
+	AddressLine2 string `json:"address_line2" gorm:"column:address_line2"`
+	City         string `json:"city"`
+	State        string `json:"state"`
+	PostalCode   string `json:"postal_code"`
+	Country      string `json:"country"`
+}
+
 type OrderStatus string
 
 const (
@@ -52,14 +71,36 @@ type Cart struct {
 	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
 
 	// Relationships
+	User      *User      `json:"-"`
 	CartItems []CartItem `json:"cart_items"`
 }
 
+// CartAbandonment records a cart that was left untouched with items in it
+type CartAbandonment struct {
+	ID             uint       `json:"id" gorm:"primaryKey"`
+	CartID         uint       `json:"cart_id" gorm:"not null"`
+	UserID         uint       `json:"user_id" gorm:"not null"`
+	ItemCount      int        `json:"item_count" gorm:"not null"`
+	CartValue      float64    `json:"cart_value" gorm:"not null"`
+	CartUpdatedAt  time.Time  `json:"cart_updated_at" gorm:"not null"`
+	DetectedAt     time.Time  `json:"detected_at" gorm:"not null"`
+	ReminderSentAt *time.Time `json:"reminder_sent_at"`
+	RecoveredAt    *time.Time `json:"recovered_at"`
+	OrderID        *uint      `json:"order_id"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+
+	// Relationships
+	Cart Cart `json:"-"`
+	User User `json:"-"`
+}
+
 type CartItem struct {
 	ID        uint           `json:"id" gorm:"primaryKey"`
 	CartID    uint           `json:"cart_id" gorm:"not null"`
 	ProductID uint           `json:"product_id" gorm:"not null"`
 	Quantity  int            `json:"quantity" gorm:"not null"`
+	Price     float64        `json:"price" gorm:"not null"` // price seen when the item was added
 	CreatedAt time.Time      `json:"created_at"`
 	UpdatedAt time.Time      `json:"updated_at"`
 	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
@@ -67,4 +108,4 @@ type CartItem struct {
 	// Relationships
 	Cart    Cart    `json:"-"`
 	Product Product `json:"product"`
-}
\ No newline at end of file
+}
@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// Role groups permissions. users.role holds the role name.
+type Role struct {
+	ID          uint         `json:"id" gorm:"primaryKey"`
+	Name        string       `json:"name" gorm:"uniqueIndex;not null"`
+	Description string       `json:"description"`
+	BuiltIn     bool         `json:"built_in" gorm:"not null;default:false"`
+	CreatedAt   time.Time    `json:"created_at"`
+	UpdatedAt   time.Time    `json:"updated_at"`
+	Permissions []Permission `json:"permissions" gorm:"many2many:role_permissions;"`
+}
+
+type Permission struct {
+	ID          uint   `json:"id" gorm:"primaryKey"`
+	Name        string `json:"name" gorm:"uniqueIndex;not null"`
+	Description string `json:"description"`
+}
+
+// Permissions checked by the API
+const (
+	PermissionCatalogWrite  = "catalog:write"
+	PermissionOrdersManage  = "orders:manage"
+	PermissionUsersManage   = "users:manage"
+	PermissionRolesManage   = "roles:manage"
+	PermissionReportsRead   = "reports:read"
+	PermissionAPIKeysManage = "api_keys:manage"
+)
@@ -19,12 +19,28 @@ type User struct {
 	UpdatedAt time.Time      `json:"updated_at"`
 	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
 
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+
+	// TokenVersion is embedded in access tokens; bumping it revokes them all
+	TokenVersion int `json:"-" gorm:"not null;default:1"`
+
+	// Two-factor authentication (TOTP). The secret is set during setup and
+	// only takes effect once TOTPEnabledAt is set.
+	TOTPSecret    string     `json:"-" gorm:"column:totp_secret"`
+	TOTPEnabledAt *time.Time `json:"-" gorm:"column:totp_enabled_at"`
+	TOTPLastStep  int64      `json:"-" gorm:"column:totp_last_step"`
+
 	// Relationships
 	RefreshTokens []RefreshToken `json:"-"`
 	Orders        []Order        `json:"-"`
 	Cart          Cart           `json:"-"`
 }
 
+// TwoFactorEnabled reports whether login requires a second factor
+func (u *User) TwoFactorEnabled() bool {
+	return u.TOTPEnabledAt != nil
+}
+
 type UserRole string
 
 const (
@@ -35,11 +51,61 @@ const (
 type RefreshToken struct {
 	ID        uint           `json:"id" gorm:"primaryKey"`
 	UserID    uint           `json:"user_id" gorm:"not null"`
-	Token     string         `json:"token" gorm:"uniqueIndex;not null"`
+	TokenHash string         `json:"-" gorm:"uniqueIndex"`
 	ExpiresAt time.Time      `json:"expires_at" gorm:"not null"`
 	CreatedAt time.Time      `json:"created_at"`
 	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
 
+	// Token holds the raw value of legacy JWT refresh tokens only. New tokens
+	// are stored as TokenHash, which rows from the previous release leave
+	// empty. Drop once no instance of that release is running.
+	Token *string `json:"-" gorm:"uniqueIndex"`
+
+	// Session: every token issued by rotation shares the FamilyID of the login
+	// that started it
+	FamilyID         string     `json:"family_id" gorm:"index;not null"`
+	UserAgent        string     `json:"user_agent"`
+	IPAddress        string     `json:"ip_address"`
+	SessionCreatedAt time.Time  `json:"session_created_at" gorm:"not null"`
+	LastUsedAt       *time.Time `json:"last_used_at"`
+	RotatedAt        *time.Time `json:"rotated_at"`
+	MFA              bool       `json:"mfa" gorm:"column:mfa"`
+
+	// Relationships
+	User User `json:"-"`
+}
+
+type EmailVerificationToken struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	UserID    uint       `json:"user_id" gorm:"not null"`
+	TokenHash string     `json:"-" gorm:"uniqueIndex;not null"`
+	ExpiresAt time.Time  `json:"expires_at" gorm:"not null"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+
 	// Relationships
 	User User `json:"-"`
-}
\ No newline at end of file
+}
+
+type PasswordResetToken struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	UserID    uint       `json:"user_id" gorm:"not null"`
+	TokenHash string     `json:"-" gorm:"uniqueIndex;not null"`
+	ExpiresAt time.Time  `json:"expires_at" gorm:"not null"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+
+	// Relationships
+	User User `json:"-"`
+}
+
+type MFARecoveryCode struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	UserID    uint       `json:"user_id" gorm:"not null"`
+	CodeHash  string     `json:"-" gorm:"not null"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+
+	// Relationships
+	User User `json:"-"`
+}
@@ -0,0 +1,82 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/joefazee/learning-go-shop/internal/interfaces"
+	"gorm.io/gorm"
+)
+
+// DBLoginAttemptStore keeps login counters in the login_attempts table so
+// every instance sees the same counters and locks
+type DBLoginAttemptStore struct {
+	db *gorm.DB
+}
+
+func NewDBLoginAttemptStore(db *gorm.DB) *DBLoginAttemptStore {
+	return &DBLoginAttemptStore{db: db}
+}
+
+type loginAttemptRow struct {
+	Key           string `gorm:"primaryKey"`
+	Failures      int
+	LastFailureAt time.Time
+	LockedUntil   *time.Time
+}
+
+func (loginAttemptRow) TableName() string {
+	return "login_attempts"
+}
+
+func (r *loginAttemptRow) toAttempts() *interfaces.LoginAttempts {
+	attempts := &interfaces.LoginAttempts{
+		Failures:      r.Failures,
+		LastFailureAt: r.LastFailureAt,
+	}
+	if r.LockedUntil != nil {
+		attempts.LockedUntil = *r.LockedUntil
+	}
+	return attempts
+}
+
+func (s *DBLoginAttemptStore) Get(ctx context.Context, key string) (*interfaces.LoginAttempts, error) {
+	var row loginAttemptRow
+	err := s.db.WithContext(ctx).Where("key = ?", key).First(&row).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &interfaces.LoginAttempts{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return row.toAttempts(), nil
+}
+
+func (s *DBLoginAttemptStore) RecordFailure(ctx context.Context, key string, now time.Time, window time.Duration) (*interfaces.LoginAttempts, error) {
+	// upsert ทีเดียว ไม่ให้ request พร้อมกันนับหาย
+	var row loginAttemptRow
+	err := s.db.WithContext(ctx).Raw(`
+		INSERT INTO login_attempts (key, failures, last_failure_at)
+		VALUES (?, 1, ?)
+		ON CONFLICT (key) DO UPDATE SET
+			failures = CASE WHEN login_attempts.last_failure_at < ? THEN 1 ELSE login_attempts.failures + 1 END,
+			last_failure_at = EXCLUDED.last_failure_at
+		RETURNING key, failures, last_failure_at, locked_until`,
+		key, now, now.Add(-window),
+	).Scan(&row).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return row.toAttempts(), nil
+}
+
+func (s *DBLoginAttemptStore) Lock(ctx context.Context, key string, until time.Time) error {
+	return s.db.WithContext(ctx).Model(&loginAttemptRow{}).Where("key = ?", key).Update("locked_until", until).Error
+}
+
+func (s *DBLoginAttemptStore) Reset(ctx context.Context, key string) error {
+	return s.db.WithContext(ctx).Where("key = ?", key).Delete(&loginAttemptRow{}).Error
+}
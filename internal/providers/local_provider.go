@@ -1,6 +1,7 @@
 package providers
 
 import (
+	"context"
 	"mime/multipart"
 	"os"
 	"path/filepath"
@@ -20,7 +21,7 @@ func NewLocalProvider(cfg *config.Config) *LocalUploadProvider {
 	return &LocalUploadProvider{basePath: cfg.Upload.Path}
 }
 
-func (p *LocalUploadProvider) UploadFile(file *multipart.FileHeader, path string) (string, error) {
+func (p *LocalUploadProvider) UploadFile(_ context.Context, file *multipart.FileHeader, path string) (string, error) {
 
 	fullPath := filepath.Join(p.basePath, path)
 
@@ -51,7 +52,23 @@ func (p *LocalUploadProvider) UploadFile(file *multipart.FileHeader, path string
 
 }
 
-func (p *LocalUploadProvider) DeleteFile(path string) error {
+func (p *LocalUploadProvider) DeleteFile(_ context.Context, path string) error {
 	fullPath := filepath.Join(p.basePath, path)
 	return os.Remove(fullPath)
+}
+
+// CheckHealth writes and removes a probe file to make sure the upload
+// directory is writable
+func (p *LocalUploadProvider) CheckHealth(_ context.Context) error {
+	if err := os.MkdirAll(p.basePath, 0o755); err != nil {
+		return err
+	}
+
+	probe, err := os.CreateTemp(p.basePath, ".health-*")
+	if err != nil {
+		return err
+	}
+	probe.Close()
+
+	return os.Remove(probe.Name())
 }
\ No newline at end of file
@@ -0,0 +1,33 @@
+package providers
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/joefazee/learning-go-shop/internal/interfaces"
+	"github.com/rs/zerolog"
+)
+
+func TestLogMailerRedactsLinkTokens(t *testing.T) {
+	var buf bytes.Buffer
+	logger := zerolog.New(&buf)
+
+	err := NewLogMailer(&logger).Send(context.Background(), &interfaces.MailMessage{
+		To:      "user@example.com",
+		Subject: "Reset your password",
+		Body:    "Open the link below:\n\nhttp://localhost:3000/reset-password?token=s3cr3t-t0ken&lang=en\n",
+	})
+	if err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	out := buf.String()
+	if strings.Contains(out, "s3cr3t-t0ken") {
+		t.Errorf("token leaked into the log: %s", out)
+	}
+	if !strings.Contains(out, "reset-password?token=[REDACTED]&lang=en") {
+		t.Errorf("expected the redacted link in the log: %s", out)
+	}
+}
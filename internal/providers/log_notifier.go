@@ -0,0 +1,29 @@
+package providers
+
+import (
+	"context"
+
+	"github.com/joefazee/learning-go-shop/internal/interfaces"
+	"github.com/rs/zerolog"
+)
+
+// LogNotifier writes notifications to the application log instead of
+// delivering them. Useful for local development.
+type LogNotifier struct {
+	logger *zerolog.Logger
+}
+
+func NewLogNotifier(logger *zerolog.Logger) *LogNotifier {
+	return &LogNotifier{logger: logger}
+}
+
+func (n *LogNotifier) NotifyAbandonedCart(_ context.Context, notification *interfaces.AbandonedCartNotification) error {
+	n.logger.Info().
+		Uint("user_id", notification.UserID).
+		Str("email", notification.Email).
+		Int("items", len(notification.Items)).
+		Float64("cart_value", notification.CartValue).
+		Msg("abandoned cart reminder")
+
+	return nil
+}
@@ -0,0 +1,61 @@
+package providers
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/joefazee/learning-go-shop/internal/interfaces"
+)
+
+// MemoryLoginAttemptStore keeps login counters in process. Meant for tests
+// and single instance deployments; counters are lost on restart.
+type MemoryLoginAttemptStore struct {
+	mu       sync.Mutex
+	attempts map[string]interfaces.LoginAttempts
+}
+
+func NewMemoryLoginAttemptStore() *MemoryLoginAttemptStore {
+	return &MemoryLoginAttemptStore{attempts: make(map[string]interfaces.LoginAttempts)}
+}
+
+func (s *MemoryLoginAttemptStore) Get(_ context.Context, key string) (*interfaces.LoginAttempts, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	attempts := s.attempts[key]
+	return &attempts, nil
+}
+
+func (s *MemoryLoginAttemptStore) RecordFailure(_ context.Context, key string, now time.Time, window time.Duration) (*interfaces.LoginAttempts, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	attempts := s.attempts[key]
+	if now.Sub(attempts.LastFailureAt) > window {
+		attempts.Failures = 0
+	}
+	attempts.Failures++
+	attempts.LastFailureAt = now
+	s.attempts[key] = attempts
+
+	return &attempts, nil
+}
+
+func (s *MemoryLoginAttemptStore) Lock(_ context.Context, key string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	attempts := s.attempts[key]
+	attempts.LockedUntil = until
+	s.attempts[key] = attempts
+	return nil
+}
+
+func (s *MemoryLoginAttemptStore) Reset(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.attempts, key)
+	return nil
+}
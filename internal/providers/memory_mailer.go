@@ -0,0 +1,45 @@
+package providers
+
+import (
+	"context"
+	"sync"
+
+	"github.com/joefazee/learning-go-shop/internal/interfaces"
+)
+
+// MemoryMailer keeps sent messages in memory instead of delivering them.
+// Meant for tests and local development.
+type MemoryMailer struct {
+	mu       sync.Mutex
+	messages []interfaces.MailMessage
+}
+
+func NewMemoryMailer() *MemoryMailer {
+	return &MemoryMailer{}
+}
+
+func (m *MemoryMailer) Send(_ context.Context, message *interfaces.MailMessage) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.messages = append(m.messages, *message)
+	return nil
+}
+
+// Messages returns a copy of every message sent so far
+func (m *MemoryMailer) Messages() []interfaces.MailMessage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	out := make([]interfaces.MailMessage, len(m.messages))
+	copy(out, m.messages)
+	return out
+}
+
+// Reset drops all recorded messages
+func (m *MemoryMailer) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.messages = nil
+}
@@ -0,0 +1,83 @@
+package providers
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/joefazee/learning-go-shop/internal/interfaces"
+)
+
+// sweep buckets that have refilled once the map gets this big
+const rateLimitSweepAt = 10000
+
+// MemoryRateLimitStore keeps token buckets in process. Each instance counts
+// on its own, so use RedisRateLimitStore when running more than one.
+type MemoryRateLimitStore struct {
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+	period  time.Duration
+}
+
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{buckets: make(map[string]*tokenBucket)}
+}
+
+func (s *MemoryRateLimitStore) Allow(_ context.Context, key string, limit int, period time.Duration) (*interfaces.RateLimitResult, error) {
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	bucket, ok := s.buckets[key]
+	if !ok {
+		if len(s.buckets) >= rateLimitSweepAt {
+			s.sweep(now)
+		}
+		bucket = &tokenBucket{tokens: float64(limit), updated: now}
+		s.buckets[key] = bucket
+	}
+
+	rate := float64(limit) / period.Seconds()
+	bucket.tokens = math.Min(float64(limit), bucket.tokens+now.Sub(bucket.updated).Seconds()*rate)
+	bucket.updated = now
+	bucket.period = period
+
+	allowed := bucket.tokens >= 1
+	if allowed {
+		bucket.tokens--
+	}
+
+	return tokenBucketResult(allowed, bucket.tokens, limit, period), nil
+}
+
+// sweep drops buckets that are full again; they are the same as no bucket
+func (s *MemoryRateLimitStore) sweep(now time.Time) {
+	for key, bucket := range s.buckets {
+		if now.Sub(bucket.updated) >= bucket.period {
+			delete(s.buckets, key)
+		}
+	}
+}
+
+// tokenBucketResult describes a bucket left with tokens after a request
+func tokenBucketResult(allowed bool, tokens float64, limit int, period time.Duration) *interfaces.RateLimitResult {
+	perToken := period / time.Duration(limit)
+
+	result := &interfaces.RateLimitResult{
+		Allowed:    allowed,
+		Remaining:  int(tokens),
+		ResetAfter: time.Duration((float64(limit) - tokens) * float64(perToken)),
+	}
+	if !allowed {
+		result.RetryAfter = time.Duration((1 - tokens) * float64(perToken))
+	}
+
+	return result
+}
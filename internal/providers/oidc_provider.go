@@ -0,0 +1,118 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/joefazee/learning-go-shop/internal/config"
+	"github.com/joefazee/learning-go-shop/internal/interfaces"
+	"golang.org/x/oauth2"
+)
+
+// OIDCProvider talks to one OpenID Connect issuer. Discovery runs on first
+// use so an unreachable issuer does not stop the API from starting.
+type OIDCProvider struct {
+	cfg         config.OIDCProviderConfig
+	redirectURL string
+
+	mu       sync.Mutex
+	provider *oidc.Provider
+}
+
+func NewOIDCProvider(cfg config.OIDCProviderConfig, redirectURL string) *OIDCProvider {
+	return &OIDCProvider{
+		cfg:         cfg,
+		redirectURL: redirectURL,
+	}
+}
+
+func (p *OIDCProvider) Name() string {
+	return p.cfg.Name
+}
+
+func (p *OIDCProvider) AuthCodeURL(ctx context.Context, state, nonce, codeVerifier string) (string, error) {
+	provider, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	return p.oauth2Config(provider).AuthCodeURL(state,
+		oidc.Nonce(nonce),
+		oauth2.S256ChallengeOption(codeVerifier),
+	), nil
+}
+
+func (p *OIDCProvider) Exchange(ctx context.Context, code, codeVerifier, nonce string) (*interfaces.IdentityClaims, error) {
+	provider, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := p.oauth2Config(provider).Exchange(ctx, code, oauth2.VerifierOption(codeVerifier))
+	if err != nil {
+		return nil, err
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, errors.New("oidc: token response has no id_token")
+	}
+
+	idToken, err := provider.Verifier(&oidc.Config{ClientID: p.cfg.ClientID}).Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, err
+	}
+
+	if idToken.Nonce != nonce {
+		return nil, errors.New("oidc: nonce mismatch")
+	}
+
+	var claims struct {
+		Email         string `json:"email"`
+		EmailVerified bool   `json:"email_verified"`
+		GivenName     string `json:"given_name"`
+		FamilyName    string `json:"family_name"`
+		Name          string `json:"name"`
+	}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, err
+	}
+
+	return &interfaces.IdentityClaims{
+		Subject:       idToken.Subject,
+		Email:         claims.Email,
+		EmailVerified: claims.EmailVerified,
+		GivenName:     claims.GivenName,
+		FamilyName:    claims.FamilyName,
+		Name:          claims.Name,
+	}, nil
+}
+
+func (p *OIDCProvider) discover(ctx context.Context) (*oidc.Provider, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.provider != nil {
+		return p.provider, nil
+	}
+
+	provider, err := oidc.NewProvider(ctx, p.cfg.Issuer)
+	if err != nil {
+		return nil, err
+	}
+
+	p.provider = provider
+	return provider, nil
+}
+
+func (p *OIDCProvider) oauth2Config(provider *oidc.Provider) *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     p.cfg.ClientID,
+		ClientSecret: p.cfg.ClientSecret,
+		RedirectURL:  p.redirectURL,
+		Endpoint:     provider.Endpoint(),
+		Scopes:       p.cfg.Scopes,
+	}
+}
@@ -0,0 +1,70 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/joefazee/learning-go-shop/internal/interfaces"
+	"github.com/redis/go-redis/v9"
+)
+
+// ใช้เวลาจาก Redis เอง นาฬิกาแต่ละ instance จะได้ไม่ต้องตรงกัน
+var tokenBucketScript = redis.NewScript(`
+local limit = tonumber(ARGV[1])
+local period = tonumber(ARGV[2])
+local t = redis.call('TIME')
+local now = t[1] * 1000 + math.floor(t[2] / 1000)
+
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(state[1])
+local ts = tonumber(state[2])
+if tokens == nil or ts == nil then
+	tokens = limit
+	ts = now
+end
+
+tokens = math.min(limit, tokens + math.max(0, now - ts) * limit / period)
+
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', now)
+redis.call('PEXPIRE', KEYS[1], period)
+
+return {allowed, tostring(tokens)}
+`)
+
+// RedisRateLimitStore keeps token buckets in Redis (or anything speaking its
+// protocol and Lua scripting) so every instance shares the same limits
+type RedisRateLimitStore struct {
+	client redis.Scripter
+	prefix string
+}
+
+func NewRedisRateLimitStore(client redis.Scripter) *RedisRateLimitStore {
+	return &RedisRateLimitStore{client: client, prefix: "ratelimit:"}
+}
+
+func (s *RedisRateLimitStore) Allow(ctx context.Context, key string, limit int, period time.Duration) (*interfaces.RateLimitResult, error) {
+	reply, err := tokenBucketScript.Run(ctx, s.client, []string{s.prefix + key}, limit, period.Milliseconds()).Slice()
+	if err != nil {
+		return nil, err
+	}
+	if len(reply) != 2 {
+		return nil, fmt.Errorf("ratelimit: unexpected script reply %v", reply)
+	}
+
+	allowed, _ := reply[0].(int64)
+	tokensText, _ := reply[1].(string)
+	tokens, err := strconv.ParseFloat(tokensText, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	return tokenBucketResult(allowed == 1, tokens, limit, period), nil
+}
@@ -22,7 +22,7 @@ type S3Provider struct {
 }
 
 func NewS3Provider(cfg *appconfig.Config) *S3Provider {
-	awsCfg, err := config.LoadDefaultConfig(context.TODO(),
+	awsCfg, err := config.LoadDefaultConfig(context.Background(),
 		config.WithRegion(cfg.AWS.Region),
 		config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(
 			cfg.AWS.AccessKeyID,
@@ -51,7 +51,7 @@ func NewS3Provider(cfg *appconfig.Config) *S3Provider {
 	}
 }
 
-func (p *S3Provider) UploadFile(file *multipart.FileHeader, path string) (string, error) {
+func (p *S3Provider) UploadFile(ctx context.Context, file *multipart.FileHeader, path string) (string, error) {
 
 	src, err := file.Open()
 	if err != nil {
@@ -59,7 +59,7 @@ func (p *S3Provider) UploadFile(file *multipart.FileHeader, path string) (string
 	}
 	defer src.Close()
 
-	result, err := p.uploader.Upload(context.TODO(), &s3.PutObjectInput{
+	result, err := p.uploader.Upload(ctx, &s3.PutObjectInput{
 		Bucket: aws.String(p.bucket),
 		Key:    aws.String(path),
 		Body:   src,
@@ -72,11 +72,20 @@ func (p *S3Provider) UploadFile(file *multipart.FileHeader, path string) (string
 	return *result.Key, nil
 }
 
-func (p *S3Provider) DeleteFile(path string) error {
-	_, err := p.client.DeleteObject(context.TODO(), &s3.DeleteObjectInput{
+func (p *S3Provider) DeleteFile(ctx context.Context, path string) error {
+	_, err := p.client.DeleteObject(ctx, &s3.DeleteObjectInput{
 		Bucket: aws.String(p.bucket),
 		Key:    aws.String(strings.TrimPrefix(path, "/")),
 	})
 
+	return err
+}
+
+// CheckHealth makes sure the bucket exists and the credentials can reach it
+func (p *S3Provider) CheckHealth(ctx context.Context) error {
+	_, err := p.client.HeadBucket(ctx, &s3.HeadBucketInput{
+		Bucket: aws.String(p.bucket),
+	})
+
 	return err
 }
\ No newline at end of file
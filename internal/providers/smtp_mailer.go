@@ -0,0 +1,50 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+
+	"github.com/joefazee/learning-go-shop/internal/config"
+	"github.com/joefazee/learning-go-shop/internal/interfaces"
+)
+
+type SMTPMailer struct {
+	addr string
+	auth smtp.Auth
+	from string
+}
+
+func NewSMTPMailer(cfg *config.MailConfig) *SMTPMailer {
+	var auth smtp.Auth
+	if cfg.SMTPUsername != "" {
+		auth = smtp.PlainAuth("", cfg.SMTPUsername, cfg.SMTPPassword, cfg.SMTPHost)
+	}
+
+	return &SMTPMailer{
+		addr: net.JoinHostPort(cfg.SMTPHost, cfg.SMTPPort),
+		auth: auth,
+		from: cfg.From,
+	}
+}
+
+// Send gives up before connecting if ctx is already done; net/smtp cannot
+// cancel a conversation that has started
+func (m *SMTPMailer) Send(ctx context.Context, message *interfaces.MailMessage) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", m.from)
+	fmt.Fprintf(&b, "To: %s\r\n", message.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", message.Subject)
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(message.Body)
+
+	return smtp.SendMail(m.addr, m.auth, m.from, []string{message.To}, []byte(b.String()))
+}
@@ -0,0 +1,90 @@
+package server
+
+import (
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joefazee/learning-go-shop/internal/dto"
+	"github.com/joefazee/learning-go-shop/internal/utils"
+)
+
+// ================== ADMIN ORDERS ==================
+
+func (s *Server) getAdminOrders(c *gin.Context) {
+	if s.orderService == nil {
+		utils.InternalServerErrorResponse(c, "orderService not initialized", nil)
+		return
+	}
+
+	query := dto.AdminOrderListQuery{
+		Status: c.Query("status"),
+		Email:  c.Query("email"),
+		Page:   parseIntQuery(c, "page", 1, 1, 1_000_000),
+		Limit:  parseIntQuery(c, "limit", 20, 1, 100),
+	}
+
+	if v := c.Query("user_id"); v != "" {
+		userID, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			utils.BadRequestResponse(c, "Invalid user_id", err)
+			return
+		}
+		query.UserID = uint(userID)
+	}
+
+	orders, meta, err := s.orderService.ListAllOrders(c.Request.Context(), &query)
+	if err != nil {
+		utils.ServiceErrorResponse(c, "Failed to fetch orders", err)
+		return
+	}
+
+	utils.PaginatedSuccessResponse(c, "Orders retrieved successfully", orders, *meta)
+}
+
+func (s *Server) getAdminOrder(c *gin.Context) {
+	if s.orderService == nil {
+		utils.InternalServerErrorResponse(c, "orderService not initialized", nil)
+		return
+	}
+
+	id, err := parseUintParam(c, "id")
+	if err != nil {
+		utils.BadRequestResponse(c, "Invalid order ID", err)
+		return
+	}
+
+	order, err := s.orderService.GetAnyOrder(c.Request.Context(), id)
+	if err != nil {
+		utils.ServiceErrorResponse(c, "Failed to fetch order", err)
+		return
+	}
+
+	utils.SuccessResponse(c, "Order retrieved successfully", order)
+}
+
+func (s *Server) updateOrderStatus(c *gin.Context) {
+	if s.orderService == nil {
+		utils.InternalServerErrorResponse(c, "orderService not initialized", nil)
+		return
+	}
+
+	id, err := parseUintParam(c, "id")
+	if err != nil {
+		utils.BadRequestResponse(c, "Invalid order ID", err)
+		return
+	}
+
+	var req dto.UpdateOrderStatusRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequestResponse(c, "Invalid request data", err)
+		return
+	}
+
+	order, err := s.orderService.UpdateOrderStatus(c.Request.Context(), id, req.Status)
+	if err != nil {
+		utils.ServiceErrorResponse(c, "Failed to update order status", err)
+		return
+	}
+
+	utils.SuccessResponse(c, "Order status updated successfully", order)
+}
@@ -0,0 +1,125 @@
+package server
+
+import (
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joefazee/learning-go-shop/internal/dto"
+	"github.com/joefazee/learning-go-shop/internal/models"
+	"github.com/joefazee/learning-go-shop/internal/utils"
+)
+
+// ================== ADMIN USERS ==================
+
+func (s *Server) getAdminUsers(c *gin.Context) {
+	if s.adminUserService == nil {
+		utils.InternalServerErrorResponse(c, "adminUserService not initialized", nil)
+		return
+	}
+
+	query := dto.AdminUserListQuery{
+		Search: c.Query("search"),
+		Role:   c.Query("role"),
+		Page:   parseIntQuery(c, "page", 1, 1, 1_000_000),
+		Limit:  parseIntQuery(c, "limit", 20, 1, 100),
+	}
+
+	if v := c.Query("is_active"); v != "" {
+		isActive, err := strconv.ParseBool(v)
+		if err != nil {
+			utils.BadRequestResponse(c, "Invalid is_active, expected true or false", err)
+			return
+		}
+		query.IsActive = &isActive
+	}
+
+	users, meta, err := s.adminUserService.ListUsers(c.Request.Context(), &query)
+	if err != nil {
+		utils.ServiceErrorResponse(c, "Failed to fetch users", err)
+		return
+	}
+
+	utils.PaginatedSuccessResponse(c, "Users retrieved successfully", users, *meta)
+}
+
+func (s *Server) getAdminUser(c *gin.Context) {
+	if s.adminUserService == nil {
+		utils.InternalServerErrorResponse(c, "adminUserService not initialized", nil)
+		return
+	}
+
+	id, err := parseUintParam(c, "id")
+	if err != nil {
+		utils.BadRequestResponse(c, "Invalid user ID", err)
+		return
+	}
+
+	user, err := s.adminUserService.GetUser(c.Request.Context(), id)
+	if err != nil {
+		utils.ServiceErrorResponse(c, "Failed to fetch user", err)
+		return
+	}
+
+	utils.SuccessResponse(c, "User retrieved successfully", user)
+}
+
+func (s *Server) updateAdminUser(c *gin.Context) {
+	if s.adminUserService == nil {
+		utils.InternalServerErrorResponse(c, "adminUserService not initialized", nil)
+		return
+	}
+
+	id, err := parseUintParam(c, "id")
+	if err != nil {
+		utils.BadRequestResponse(c, "Invalid user ID", err)
+		return
+	}
+
+	var req dto.AdminUpdateUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequestResponse(c, "Invalid request data", err)
+		return
+	}
+
+	// เปลี่ยน role ได้เฉพาะคนที่จัดการ role ได้
+	if req.Role != nil {
+		allowed, err := s.hasPermissions(c, models.PermissionRolesManage)
+		if err != nil {
+			utils.InternalServerErrorResponse(c, "Failed to check permissions", err)
+			return
+		}
+		if !allowed {
+			utils.ForbiddenResponse(c, "Changing roles requires the "+models.PermissionRolesManage+" permission")
+			return
+		}
+	}
+
+	user, err := s.adminUserService.UpdateUser(c.Request.Context(), c.GetUint("user_id"), id, &req)
+	if err != nil {
+		utils.ServiceErrorResponse(c, "Failed to update user", err)
+		return
+	}
+
+	utils.SuccessResponse(c, "User updated successfully", user)
+}
+
+func (s *Server) forceLogoutUser(c *gin.Context) {
+	if s.adminUserService == nil {
+		utils.InternalServerErrorResponse(c, "adminUserService not initialized", nil)
+		return
+	}
+
+	id, err := parseUintParam(c, "id")
+	if err != nil {
+		utils.BadRequestResponse(c, "Invalid user ID", err)
+		return
+	}
+
+	revoked, err := s.adminUserService.ForceLogout(c.Request.Context(), c.GetUint("user_id"), id)
+	if err != nil {
+		utils.ServiceErrorResponse(c, "Failed to sign out user", err)
+		return
+	}
+
+	utils.SuccessResponse(c, "User signed out of every session", dto.ForceLogoutResponse{Revoked: revoked})
+}
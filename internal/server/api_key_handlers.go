@@ -0,0 +1,71 @@
+package server
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/joefazee/learning-go-shop/internal/dto"
+	"github.com/joefazee/learning-go-shop/internal/utils"
+)
+
+// ================== ADMIN API KEYS ==================
+
+func (s *Server) getAPIKeys(c *gin.Context) {
+	if s.apiKeyService == nil {
+		utils.InternalServerErrorResponse(c, "apiKeyService not initialized", nil)
+		return
+	}
+
+	keys, err := s.apiKeyService.ListAPIKeys(c.Request.Context())
+	if err != nil {
+		utils.ServiceErrorResponse(c, "Failed to fetch API keys", err)
+		return
+	}
+
+	utils.SuccessResponse(c, "API keys retrieved successfully", keys)
+}
+
+func (s *Server) createAPIKey(c *gin.Context) {
+	if s.apiKeyService == nil {
+		utils.InternalServerErrorResponse(c, "apiKeyService not initialized", nil)
+		return
+	}
+
+	// key ต้องออกโดยคน ไม่ให้ key หนึ่งออก key ใหม่ต่อไปเรื่อย ๆ
+	if c.GetUint("api_key_id") != 0 {
+		utils.ForbiddenResponse(c, "API keys cannot issue API keys")
+		return
+	}
+
+	var req dto.CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequestResponse(c, "Invalid request data", err)
+		return
+	}
+
+	key, err := s.apiKeyService.CreateAPIKey(c.Request.Context(), c.GetUint("user_id"), c.GetString("user_role"), &req)
+	if err != nil {
+		utils.ServiceErrorResponse(c, "Failed to create API key", err)
+		return
+	}
+
+	utils.CreatedResponse(c, "API key created. Store the key now, it will not be shown again", key)
+}
+
+func (s *Server) revokeAPIKey(c *gin.Context) {
+	if s.apiKeyService == nil {
+		utils.InternalServerErrorResponse(c, "apiKeyService not initialized", nil)
+		return
+	}
+
+	id, err := parseUintParam(c, "id")
+	if err != nil {
+		utils.BadRequestResponse(c, "Invalid API key ID", err)
+		return
+	}
+
+	if err := s.apiKeyService.RevokeAPIKey(c.Request.Context(), id); err != nil {
+		utils.ServiceErrorResponse(c, "Failed to revoke API key", err)
+		return
+	}
+
+	utils.SuccessResponse(c, "API key revoked successfully", nil)
+}
@@ -0,0 +1,73 @@
+package server
+
+import (
+	"net"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joefazee/learning-go-shop/internal/dto"
+	"github.com/joefazee/learning-go-shop/internal/utils"
+)
+
+// ================== LOCKOUTS & AUDIT ==================
+
+func (s *Server) unlockUser(c *gin.Context) {
+	if s.loginThrottleService == nil {
+		utils.InternalServerErrorResponse(c, "loginThrottleService not initialized", nil)
+		return
+	}
+
+	id, err := parseUintParam(c, "id")
+	if err != nil {
+		utils.BadRequestResponse(c, "Invalid user ID", err)
+		return
+	}
+
+	if err := s.loginThrottleService.UnlockAccount(c.Request.Context(), c.GetUint("user_id"), id); err != nil {
+		utils.ServiceErrorResponse(c, "Failed to unlock user", err)
+		return
+	}
+
+	utils.SuccessResponse(c, "User unlocked successfully", nil)
+}
+
+func (s *Server) unlockIP(c *gin.Context) {
+	if s.loginThrottleService == nil {
+		utils.InternalServerErrorResponse(c, "loginThrottleService not initialized", nil)
+		return
+	}
+
+	ip := net.ParseIP(c.Param("ip"))
+	if ip == nil {
+		utils.BadRequestResponse(c, "Invalid IP address", nil)
+		return
+	}
+
+	if err := s.loginThrottleService.UnlockIP(c.Request.Context(), c.GetUint("user_id"), ip.String()); err != nil {
+		utils.ServiceErrorResponse(c, "Failed to unlock IP address", err)
+		return
+	}
+
+	utils.SuccessResponse(c, "IP address unlocked successfully", nil)
+}
+
+func (s *Server) getAuditEvents(c *gin.Context) {
+	if s.loginThrottleService == nil {
+		utils.InternalServerErrorResponse(c, "loginThrottleService not initialized", nil)
+		return
+	}
+
+	query := dto.AuditEventListQuery{
+		Type:   c.Query("type"),
+		UserID: uint(parseIntQuery(c, "user_id", 0, 0, 1<<31-1)),
+		Page:   parseIntQuery(c, "page", 1, 1, 1_000_000),
+		Limit:  parseIntQuery(c, "limit", 20, 1, 100),
+	}
+
+	events, meta, err := s.loginThrottleService.ListAuditEvents(c.Request.Context(), &query)
+	if err != nil {
+		utils.ServiceErrorResponse(c, "Failed to fetch audit events", err)
+		return
+	}
+
+	utils.PaginatedSuccessResponse(c, "Audit events retrieved successfully", events, *meta)
+}
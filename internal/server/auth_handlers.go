@@ -1,8 +1,11 @@
 package server
 
 import (
+	"errors"
+
 	"github.com/gin-gonic/gin"
 	"github.com/joefazee/learning-go-shop/internal/dto"
+	"github.com/joefazee/learning-go-shop/internal/services"
 	"github.com/joefazee/learning-go-shop/internal/utils"
 )
 
@@ -20,9 +23,9 @@ func (s *Server) register(c *gin.Context) {
 		return
 	}
 
-	response, err := s.authService.Register(&req)
+	response, err := s.authService.Register(c.Request.Context(), &req, clientInfo(c))
 	if err != nil {
-		utils.BadRequestResponse(c, "Registration failed", err)
+		utils.ServiceErrorResponse(c, "Registration failed", err)
 		return
 	}
 
@@ -41,9 +44,14 @@ func (s *Server) login(c *gin.Context) {
 		return
 	}
 
-	response, err := s.authService.Login(&req)
+	response, err := s.authService.Login(c.Request.Context(), &req, clientInfo(c))
 	if err != nil {
-		utils.UnauthorizedResponse(c, "Login failed")
+		var mfaRequired *services.MFARequiredError
+		if errors.As(err, &mfaRequired) {
+			utils.SuccessResponse(c, "Two-factor authentication required", mfaRequired.Challenge)
+			return
+		}
+		loginErrorResponse(c, err)
 		return
 	}
 
@@ -62,9 +70,9 @@ func (s *Server) refreshToken(c *gin.Context) {
 		return
 	}
 
-	response, err := s.authService.RefreshToken(&req)
+	response, err := s.authService.RefreshToken(c.Request.Context(), &req, clientInfo(c))
 	if err != nil {
-		utils.UnauthorizedResponse(c, "Token refresh failed")
+		utils.ServiceErrorResponse(c, "Token refresh failed", err)
 		return
 	}
 
@@ -83,14 +91,95 @@ func (s *Server) logout(c *gin.Context) {
 		return
 	}
 
-	if err := s.authService.Logout(req.RefreshToken); err != nil {
-		utils.InternalServerErrorResponse(c, "Logout failed", err)
+	if err := s.authService.Logout(c.Request.Context(), req.RefreshToken); err != nil {
+		utils.ServiceErrorResponse(c, "Logout failed", err)
 		return
 	}
 
 	utils.SuccessResponse(c, "Logout successful", nil)
 }
 
+func (s *Server) verifyEmail(c *gin.Context) {
+	if s.authService == nil {
+		utils.InternalServerErrorResponse(c, "authService is not initialized", nil)
+		return
+	}
+
+	var req dto.VerifyEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequestResponse(c, "Invalid request data", err)
+		return
+	}
+
+	if err := s.authService.VerifyEmail(c.Request.Context(), req.Token); err != nil {
+		utils.ServiceErrorResponse(c, "Email verification failed", err)
+		return
+	}
+
+	utils.SuccessResponse(c, "Email verified successfully", nil)
+}
+
+func (s *Server) resendVerification(c *gin.Context) {
+	if s.authService == nil {
+		utils.InternalServerErrorResponse(c, "authService is not initialized", nil)
+		return
+	}
+
+	var req dto.ResendVerificationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequestResponse(c, "Invalid request data", err)
+		return
+	}
+
+	if err := s.authService.ResendVerification(c.Request.Context(), req.Email); err != nil {
+		utils.InternalServerErrorResponse(c, "Failed to resend verification email", nil)
+		return
+	}
+
+	// ตอบเหมือนกันเสมอ ไม่บอกว่ามีอีเมลนี้ในระบบหรือไม่
+	utils.SuccessResponse(c, "If the account exists and is not verified, a verification email has been sent", nil)
+}
+
+func (s *Server) forgotPassword(c *gin.Context) {
+	if s.authService == nil {
+		utils.InternalServerErrorResponse(c, "authService is not initialized", nil)
+		return
+	}
+
+	var req dto.ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequestResponse(c, "Invalid request data", err)
+		return
+	}
+
+	if err := s.authService.ForgotPassword(c.Request.Context(), req.Email); err != nil {
+		utils.InternalServerErrorResponse(c, "Failed to send password reset email", nil)
+		return
+	}
+
+	utils.SuccessResponse(c, "If the account exists, a password reset email has been sent", nil)
+}
+
+func (s *Server) resetPassword(c *gin.Context) {
+	if s.authService == nil {
+		utils.InternalServerErrorResponse(c, "authService is not initialized", nil)
+		return
+	}
+
+	var req dto.ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequestResponse(c, "Invalid request data", err)
+		return
+	}
+
+	if err := s.authService.ResetPassword(c.Request.Context(), &req); err != nil {
+		utils.ServiceErrorResponse(c, "Password reset failed", err)
+		return
+	}
+
+	utils.SuccessResponse(c, "Password reset successfully", nil)
+}
+
 // ================== USERS ==================
 
 func (s *Server) getProfile(c *gin.Context) {
@@ -100,9 +189,9 @@ func (s *Server) getProfile(c *gin.Context) {
 	}
 
 	userID := c.GetUint("user_id")
-	profile, err := s.userService.GetProfile(userID)
+	profile, err := s.userService.GetProfile(c.Request.Context(), userID)
 	if err != nil {
-		utils.NotFoundResponse(c, "User not found")
+		utils.ServiceErrorResponse(c, "Failed to fetch profile", err)
 		return
 	}
 
@@ -123,11 +212,97 @@ func (s *Server) updateProfile(c *gin.Context) {
 		return
 	}
 
-	profile, err := s.userService.UpdateProfile(userID, &req)
+	profile, err := s.userService.UpdateProfile(c.Request.Context(), userID, &req)
 	if err != nil {
-		utils.InternalServerErrorResponse(c, "Failed to update profile", err)
+		utils.ServiceErrorResponse(c, "Failed to update profile", err)
 		return
 	}
 
 	utils.SuccessResponse(c, "Profile updated successfully", profile)
 }
+
+func (s *Server) changePassword(c *gin.Context) {
+	if s.userService == nil {
+		utils.InternalServerErrorResponse(c, "userService is not initialized", nil)
+		return
+	}
+
+	userID := c.GetUint("user_id")
+
+	var req dto.ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequestResponse(c, "Invalid request data", err)
+		return
+	}
+
+	if err := s.userService.ChangePassword(c.Request.Context(), userID, &req); err != nil {
+		utils.ServiceErrorResponse(c, "Failed to change password", err)
+		return
+	}
+
+	utils.SuccessResponse(c, "Password changed successfully", nil)
+}
+
+// ================== SESSIONS ==================
+
+func (s *Server) getSessions(c *gin.Context) {
+	if s.sessionService == nil {
+		utils.InternalServerErrorResponse(c, "sessionService is not initialized", nil)
+		return
+	}
+
+	sessions, err := s.sessionService.ListSessions(c.Request.Context(), c.GetUint("user_id"), c.GetString("session_id"))
+	if err != nil {
+		utils.ServiceErrorResponse(c, "Failed to fetch sessions", err)
+		return
+	}
+
+	utils.SuccessResponse(c, "Sessions retrieved successfully", sessions)
+}
+
+func (s *Server) revokeSession(c *gin.Context) {
+	if s.sessionService == nil {
+		utils.InternalServerErrorResponse(c, "sessionService is not initialized", nil)
+		return
+	}
+
+	if err := s.sessionService.RevokeSession(c.Request.Context(), c.GetUint("user_id"), c.Param("id")); err != nil {
+		utils.ServiceErrorResponse(c, "Failed to revoke session", err)
+		return
+	}
+
+	utils.SuccessResponse(c, "Session revoked successfully", nil)
+}
+
+func (s *Server) revokeOtherSessions(c *gin.Context) {
+	if s.sessionService == nil {
+		utils.InternalServerErrorResponse(c, "sessionService is not initialized", nil)
+		return
+	}
+
+	revoked, err := s.sessionService.RevokeOtherSessions(c.Request.Context(), c.GetUint("user_id"), c.GetString("session_id"))
+	if err != nil {
+		utils.ServiceErrorResponse(c, "Failed to revoke sessions", err)
+		return
+	}
+
+	utils.SuccessResponse(c, "Other sessions revoked successfully", dto.RevokeSessionsResponse{Revoked: revoked})
+}
+
+// loginErrorResponse answers a failed login with a 429 while throttled
+func loginErrorResponse(c *gin.Context, err error) {
+	var throttled *services.LoginThrottledError
+	if errors.As(err, &throttled) {
+		utils.TooManyRequestsResponse(c, "Too many failed login attempts, try again later", throttled.RetryAfter)
+		return
+	}
+
+	utils.ServiceErrorResponse(c, "Login failed", err)
+}
+
+func clientInfo(c *gin.Context) *dto.ClientInfo {
+	return &dto.ClientInfo{
+		UserAgent: c.Request.UserAgent(),
+		IPAddress: c.ClientIP(),
+	}
+}
@@ -0,0 +1,112 @@
+package server
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/joefazee/learning-go-shop/internal/dto"
+	"github.com/joefazee/learning-go-shop/internal/utils"
+)
+
+// ================== CART ==================
+
+func (s *Server) getCart(c *gin.Context) {
+	if s.cartService == nil {
+		utils.InternalServerErrorResponse(c, "cartService not initialized", nil)
+		return
+	}
+
+	userID := c.GetUint("user_id")
+	cart, err := s.cartService.GetCart(c.Request.Context(), userID)
+	if err != nil {
+		utils.ServiceErrorResponse(c, "Failed to fetch cart", err)
+		return
+	}
+
+	utils.SuccessResponse(c, "Cart retrieved successfully", cart)
+}
+
+func (s *Server) addToCart(c *gin.Context) {
+	if s.cartService == nil {
+		utils.InternalServerErrorResponse(c, "cartService not initialized", nil)
+		return
+	}
+
+	var req dto.AddToCartRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequestResponse(c, "Invalid request data", err)
+		return
+	}
+
+	userID := c.GetUint("user_id")
+	cart, err := s.cartService.AddToCart(c.Request.Context(), userID, &req)
+	if err != nil {
+		utils.ServiceErrorResponse(c, "Failed to add item to cart", err)
+		return
+	}
+
+	utils.SuccessResponse(c, "Item added to cart successfully", cart)
+}
+
+func (s *Server) updateCartItem(c *gin.Context) {
+	if s.cartService == nil {
+		utils.InternalServerErrorResponse(c, "cartService not initialized", nil)
+		return
+	}
+
+	id, err := parseUintParam(c, "id")
+	if err != nil {
+		utils.BadRequestResponse(c, "Invalid cart item ID", err)
+		return
+	}
+
+	var req dto.UpdateCartItemRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequestResponse(c, "Invalid request data", err)
+		return
+	}
+
+	userID := c.GetUint("user_id")
+	cart, err := s.cartService.UpdateCartItem(c.Request.Context(), userID, id, &req)
+	if err != nil {
+		utils.ServiceErrorResponse(c, "Failed to update cart item", err)
+		return
+	}
+
+	utils.SuccessResponse(c, "Cart item updated successfully", cart)
+}
+
+func (s *Server) removeFromCart(c *gin.Context) {
+	if s.cartService == nil {
+		utils.InternalServerErrorResponse(c, "cartService not initialized", nil)
+		return
+	}
+
+	id, err := parseUintParam(c, "id")
+	if err != nil {
+		utils.BadRequestResponse(c, "Invalid cart item ID", err)
+		return
+	}
+
+	userID := c.GetUint("user_id")
+	if err := s.cartService.RemoveFromCart(c.Request.Context(), userID, id); err != nil {
+		utils.ServiceErrorResponse(c, "Failed to remove cart item", err)
+		return
+	}
+
+	utils.SuccessResponse(c, "Item removed from cart successfully", nil)
+}
+
+func (s *Server) acknowledgeCartChanges(c *gin.Context) {
+	if s.cartService == nil {
+		utils.InternalServerErrorResponse(c, "cartService not initialized", nil)
+		return
+	}
+
+	userID := c.GetUint("user_id")
+	cart, err := s.cartService.AcknowledgeCartChanges(c.Request.Context(), userID)
+	if err != nil {
+		utils.ServiceErrorResponse(c, "Failed to acknowledge cart changes", err)
+		return
+	}
+
+	utils.SuccessResponse(c, "Cart changes acknowledged successfully", cart)
+}
@@ -0,0 +1,39 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joefazee/learning-go-shop/internal/dto"
+)
+
+// StartDraining makes readiness fail so load balancers stop sending new
+// requests while in-flight ones finish. Liveness is unaffected.
+func (s *Server) StartDraining() {
+	s.draining.Store(true)
+}
+
+func (s *Server) healthLive(c *gin.Context) {
+	c.JSON(http.StatusOK, dto.HealthResponse{Status: dto.HealthStatusOK})
+}
+
+func (s *Server) healthReady(c *gin.Context) {
+	if s.draining.Load() {
+		c.JSON(http.StatusServiceUnavailable, dto.HealthResponse{Status: dto.HealthStatusDraining})
+		return
+	}
+
+	if s.healthService == nil {
+		c.JSON(http.StatusServiceUnavailable, dto.HealthResponse{Status: dto.HealthStatusFail})
+		return
+	}
+
+	response := s.healthService.Ready(c.Request.Context())
+
+	status := http.StatusOK
+	if response.Status != dto.HealthStatusOK {
+		status = http.StatusServiceUnavailable
+	}
+	c.Header("Cache-Control", "no-store")
+	c.JSON(status, response)
+}
@@ -0,0 +1,148 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joefazee/learning-go-shop/internal/dto"
+	"github.com/joefazee/learning-go-shop/internal/services"
+	"github.com/joefazee/learning-go-shop/internal/utils"
+)
+
+// ================== OIDC LOGIN ==================
+
+func (s *Server) getIdentityProviders(c *gin.Context) {
+	if s.identityService == nil {
+		utils.InternalServerErrorResponse(c, "identityService is not initialized", nil)
+		return
+	}
+
+	utils.SuccessResponse(c, "Identity providers retrieved successfully", s.identityService.ListProviders())
+}
+
+func (s *Server) startOIDCLogin(c *gin.Context) {
+	if s.identityService == nil {
+		utils.InternalServerErrorResponse(c, "identityService is not initialized", nil)
+		return
+	}
+
+	response, err := s.identityService.StartLogin(c.Request.Context(), c.Param("provider"))
+	if err != nil {
+		identityErrorResponse(c, "Failed to start login", err)
+		return
+	}
+
+	utils.SuccessResponse(c, "Login started", response)
+}
+
+func (s *Server) completeOIDCLogin(c *gin.Context) {
+	if s.identityService == nil {
+		utils.InternalServerErrorResponse(c, "identityService is not initialized", nil)
+		return
+	}
+
+	var req dto.OIDCCallbackRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequestResponse(c, "Invalid request data", err)
+		return
+	}
+
+	response, err := s.identityService.CompleteLogin(c.Request.Context(), &req, clientInfo(c))
+	if err != nil {
+		var mfaRequired *services.MFARequiredError
+		if errors.As(err, &mfaRequired) {
+			utils.SuccessResponse(c, "Two-factor authentication required", mfaRequired.Challenge)
+			return
+		}
+		identityErrorResponse(c, "Login failed", err)
+		return
+	}
+
+	utils.SuccessResponse(c, "Login successful", response)
+}
+
+// ================== LINKED IDENTITIES ==================
+
+func (s *Server) getIdentities(c *gin.Context) {
+	if s.identityService == nil {
+		utils.InternalServerErrorResponse(c, "identityService is not initialized", nil)
+		return
+	}
+
+	identities, err := s.identityService.ListIdentities(c.Request.Context(), c.GetUint("user_id"))
+	if err != nil {
+		utils.ServiceErrorResponse(c, "Failed to fetch identities", err)
+		return
+	}
+
+	utils.SuccessResponse(c, "Identities retrieved successfully", identities)
+}
+
+func (s *Server) startIdentityLink(c *gin.Context) {
+	if s.identityService == nil {
+		utils.InternalServerErrorResponse(c, "identityService is not initialized", nil)
+		return
+	}
+
+	response, err := s.identityService.StartLink(c.Request.Context(), c.GetUint("user_id"), c.Param("provider"))
+	if err != nil {
+		identityErrorResponse(c, "Failed to start linking", err)
+		return
+	}
+
+	utils.SuccessResponse(c, "Linking started", response)
+}
+
+func (s *Server) completeIdentityLink(c *gin.Context) {
+	if s.identityService == nil {
+		utils.InternalServerErrorResponse(c, "identityService is not initialized", nil)
+		return
+	}
+
+	var req dto.OIDCCallbackRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequestResponse(c, "Invalid request data", err)
+		return
+	}
+
+	identity, err := s.identityService.CompleteLink(c.Request.Context(), c.GetUint("user_id"), &req)
+	if err != nil {
+		identityErrorResponse(c, "Failed to link identity", err)
+		return
+	}
+
+	utils.SuccessResponse(c, "Identity linked successfully", identity)
+}
+
+func (s *Server) unlinkIdentity(c *gin.Context) {
+	if s.identityService == nil {
+		utils.InternalServerErrorResponse(c, "identityService is not initialized", nil)
+		return
+	}
+
+	id, err := parseUintParam(c, "id")
+	if err != nil {
+		utils.BadRequestResponse(c, "Invalid identity ID", err)
+		return
+	}
+
+	if err := s.identityService.Unlink(c.Request.Context(), c.GetUint("user_id"), id); err != nil {
+		utils.ServiceErrorResponse(c, "Failed to unlink identity", err)
+		return
+	}
+
+	utils.SuccessResponse(c, "Identity unlinked successfully", nil)
+}
+
+// identityErrorResponse maps identity service errors to status codes
+func identityErrorResponse(c *gin.Context, message string, err error) {
+	var appErr *utils.AppError
+	if errors.As(err, &appErr) {
+		utils.ServiceErrorResponse(c, message, err)
+		return
+	}
+
+	// error จาก provider (เช่น code ผิด/หมดอายุ) ถือว่า login ไม่ผ่าน
+	utils.ErrorResponse(c, http.StatusUnauthorized, message, err)
+}
@@ -0,0 +1,107 @@
+package server
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/joefazee/learning-go-shop/internal/dto"
+	"github.com/joefazee/learning-go-shop/internal/utils"
+)
+
+// ================== TWO-FACTOR AUTH ==================
+
+func (s *Server) loginWithMFA(c *gin.Context) {
+	if s.authService == nil {
+		utils.InternalServerErrorResponse(c, "authService is not initialized", nil)
+		return
+	}
+
+	var req dto.MFALoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequestResponse(c, "Invalid request data", err)
+		return
+	}
+
+	response, err := s.authService.LoginWithMFA(c.Request.Context(), &req, clientInfo(c))
+	if err != nil {
+		loginErrorResponse(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, "Login successful", response)
+}
+
+func (s *Server) setupTwoFactor(c *gin.Context) {
+	if s.mfaService == nil {
+		utils.InternalServerErrorResponse(c, "mfaService is not initialized", nil)
+		return
+	}
+
+	response, err := s.mfaService.SetupTwoFactor(c.Request.Context(), c.GetUint("user_id"))
+	if err != nil {
+		utils.ServiceErrorResponse(c, "Failed to set up two-factor authentication", err)
+		return
+	}
+
+	utils.SuccessResponse(c, "Scan the provisioning URI with your authenticator app", response)
+}
+
+func (s *Server) enableTwoFactor(c *gin.Context) {
+	if s.mfaService == nil {
+		utils.InternalServerErrorResponse(c, "mfaService is not initialized", nil)
+		return
+	}
+
+	var req dto.TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequestResponse(c, "Invalid request data", err)
+		return
+	}
+
+	response, err := s.mfaService.EnableTwoFactor(c.Request.Context(), c.GetUint("user_id"), req.Code)
+	if err != nil {
+		utils.ServiceErrorResponse(c, "Failed to enable two-factor authentication", err)
+		return
+	}
+
+	utils.SuccessResponse(c, "Two-factor authentication enabled, store the recovery codes safely", response)
+}
+
+func (s *Server) disableTwoFactor(c *gin.Context) {
+	if s.mfaService == nil {
+		utils.InternalServerErrorResponse(c, "mfaService is not initialized", nil)
+		return
+	}
+
+	var req dto.DisableTwoFactorRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequestResponse(c, "Invalid request data", err)
+		return
+	}
+
+	if err := s.mfaService.DisableTwoFactor(c.Request.Context(), c.GetUint("user_id"), &req); err != nil {
+		utils.ServiceErrorResponse(c, "Failed to disable two-factor authentication", err)
+		return
+	}
+
+	utils.SuccessResponse(c, "Two-factor authentication disabled", nil)
+}
+
+func (s *Server) regenerateRecoveryCodes(c *gin.Context) {
+	if s.mfaService == nil {
+		utils.InternalServerErrorResponse(c, "mfaService is not initialized", nil)
+		return
+	}
+
+	var req dto.TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequestResponse(c, "Invalid request data", err)
+		return
+	}
+
+	response, err := s.mfaService.RegenerateRecoveryCodes(c.Request.Context(), c.GetUint("user_id"), req.Code)
+	if err != nil {
+		utils.ServiceErrorResponse(c, "Failed to regenerate recovery codes", err)
+		return
+	}
+
+	utils.SuccessResponse(c, "Recovery codes regenerated", response)
+}
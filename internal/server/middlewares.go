@@ -1,13 +1,190 @@
 package server
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"runtime/debug"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/joefazee/learning-go-shop/internal/models"
+	"github.com/google/uuid"
+	"github.com/joefazee/learning-go-shop/internal/logger"
+	"github.com/joefazee/learning-go-shop/internal/services"
 	"github.com/joefazee/learning-go-shop/internal/utils"
+	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// requestLogger gives each request an ID (kept from X-Request-ID when the
+// client or a proxy sent a sane one), stores a logger carrying it and the
+// trace ID in the request context and logs the request once it is done
+func (s *Server) requestLogger() gin.HandlerFunc {
+	base := s.logger
+	if base == nil {
+		nop := zerolog.Nop()
+		base = &nop
+	}
+
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		requestID := c.GetHeader("X-Request-ID")
+		if !validRequestID(requestID) {
+			requestID = uuid.NewString()
+		}
+		c.Set("request_id", requestID)
+		c.Header("X-Request-ID", requestID)
+
+		logContext := base.With().Str("request_id", requestID)
+		// ใช้ค้น log ของ request เดียวกับ trace ที่ export ไป
+		if spanContext := trace.SpanContextFromContext(c.Request.Context()); spanContext.HasTraceID() {
+			logContext = logContext.Str("trace_id", spanContext.TraceID().String())
+		}
+		reqLogger := logContext.Logger()
+		c.Request = c.Request.WithContext(reqLogger.WithContext(c.Request.Context()))
+
+		c.Next()
+
+		status := c.Writer.Status()
+		event := reqLogger.Info()
+		switch {
+		case status >= http.StatusInternalServerError:
+			event = reqLogger.Error()
+		case status >= http.StatusBadRequest:
+			event = reqLogger.Warn()
+		}
+
+		event = event.
+			Str("method", c.Request.Method).
+			Str("route", routeTemplate(c)).
+			Str("path", c.Request.URL.Path).
+			Int("status", status).
+			Dur("latency", time.Since(start)).
+			Str("ip", c.ClientIP()).
+			Int("bytes", c.Writer.Size())
+		if id := c.GetUint("user_id"); id != 0 {
+			event = event.Uint("user_id", id)
+		}
+		if id := c.GetUint("api_key_id"); id != 0 {
+			event = event.Uint("api_key_id", id)
+		}
+		// error ที่ handler แนบไว้ด้วย c.Error (ไม่ได้ส่งให้ client)
+		if len(c.Errors) > 0 {
+			event = event.Str("error", c.Errors.String())
+		}
+
+		event.Msg("request")
+	}
+}
+
+// routeTemplate is the matched route (/products/:id rather than
+// /products/42), or "unmatched" for 404s
+func routeTemplate(c *gin.Context) string {
+	if route := c.FullPath(); route != "" {
+		return route
+	}
+	return "unmatched"
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, r := range id {
+		if r < 0x21 || r > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// httpMetrics records the count and latency of each request. It runs outside
+// recovery so requests that panicked are counted as the 500 they became.
+func (s *Server) httpMetrics() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+		s.metrics.ObserveHTTPRequest(c.Request.Method, routeTemplate(c), c.Writer.Status(), time.Since(start))
+	}
+}
+
+// metricsAuth requires Authorization: Bearer <METRICS_TOKEN> when a token is
+// configured
+func (s *Server) metricsAuth() gin.HandlerFunc {
+	token := s.config.Metrics.Token
+
+	return func(c *gin.Context) {
+		if token == "" {
+			c.Next()
+			return
+		}
+
+		given, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			utils.UnauthorizedResponse(c, "Invalid metrics token")
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// requestTimeout cancels the request context after REQUEST_TIMEOUT, which
+// stops the database and storage calls made with it
+func (s *Server) requestTimeout() gin.HandlerFunc {
+	timeout := s.config.Server.RequestTimeout
+
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+		defer cancel()
+
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
+
+// recovery turns a panic into a 500 and reports it with its stack trace
+// through the request logger
+func (s *Server) recovery() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+
+			logger.FromContext(c.Request.Context()).Error().
+				Interface("panic", recovered).
+				Bytes("stack", debug.Stack()).
+				Str("method", c.Request.Method).
+				Str("route", c.FullPath()).
+				Msg("recovered from panic")
+
+			if c.Writer.Written() {
+				c.Abort()
+				return
+			}
+			utils.InternalServerErrorResponse(c, "Internal server error", nil)
+			c.Abort()
+		}()
+
+		c.Next()
+	}
+}
+
 func (s *Server) authMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		//Authorization: Bearer JWT
@@ -25,36 +202,446 @@ func (s *Server) authMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		claims, err := utils.ValidateToken(tokenParts[1], s.config.JWT.Secret)
+		claims, err := utils.ValidateAccessToken(tokenParts[1], s.keys, &s.config.JWT)
 		if err != nil {
 			utils.UnauthorizedResponse(c, "Invalid token")
 			c.Abort()
 			return
 		}
 
+		// role/สถานะใน token อาจเก่าแล้ว เช็ค token version ล่าสุดของผู้ใช้
+		if err := s.tokenVersionService.Check(c.Request.Context(), claims.UserID, claims.TokenVersion); err != nil {
+			if errors.Is(err, services.ErrTokenRevoked) {
+				utils.UnauthorizedResponse(c, "Token has been revoked")
+			} else {
+				utils.InternalServerErrorResponse(c, "Failed to validate token", err)
+			}
+			c.Abort()
+			return
+		}
+
+		// session ที่ถูก sign out แล้ว access token ของมันต้องใช้ไม่ได้ด้วย
+		if claims.SessionID != "" && s.sessionService != nil {
+			if err := s.sessionService.CheckSession(c.Request.Context(), claims.UserID, claims.SessionID); err != nil {
+				if errors.Is(err, services.ErrSessionRevoked) {
+					utils.UnauthorizedResponse(c, "Session has been revoked")
+				} else {
+					utils.InternalServerErrorResponse(c, "Failed to validate token", err)
+				}
+				c.Abort()
+				return
+			}
+		}
+
 		c.Set("user_id", claims.UserID)
 		c.Set("user_email", claims.Email)
 		c.Set("user_role", claims.Role)
+		c.Set("mfa", claims.MFA)
+		c.Set("session_id", claims.SessionID)
 
 		c.Next()
 	}
 }
 
-func (s *Server) adminMiddleware() gin.HandlerFunc {
+// staffAuthMiddleware accepts an X-API-Key header as an alternative to a
+// Bearer token. API keys have no user, so only use it on routes that are
+// guarded by requirePermission.
+func (s *Server) staffAuthMiddleware() gin.HandlerFunc {
+	jwtAuth := s.authMiddleware()
+
 	return func(c *gin.Context) {
-		role, exists := c.Get("user_role")
-		if !exists {
-			utils.ForbiddenResponse(c, "Forbidden")
+		rawKey := c.GetHeader("X-API-Key")
+		if rawKey == "" {
+			jwtAuth(c)
+			return
+		}
+
+		key, scopes, err := s.apiKeyService.Authenticate(c.Request.Context(), rawKey, c.ClientIP())
+		if err != nil {
+			if errors.Is(err, services.ErrInvalidAPIKey) {
+				utils.UnauthorizedResponse(c, "Invalid API key")
+			} else {
+				utils.InternalServerErrorResponse(c, "Failed to validate API key", err)
+			}
+			c.Abort()
+			return
+		}
+
+		c.Set("api_key_id", key.ID)
+		c.Set("api_key_scopes", scopes)
+
+		c.Next()
+	}
+}
+
+// requirePermission allows the request only if the user's role grants every
+// one of permissions. The role comes from the token, which the token version
+// check keeps current; its permissions are resolved per request. API keys are
+// checked against their scopes instead.
+func (s *Server) requirePermission(permissions ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		allowed, err := s.hasPermissions(c, permissions...)
+		if err != nil {
+			utils.InternalServerErrorResponse(c, "Failed to check permissions", err)
 			c.Abort()
 			return
 		}
 
-		if role != string(models.UserRoleAdmin) {
+		if !allowed {
 			utils.ForbiddenResponse(c, "Forbidden")
 			c.Abort()
 			return
 		}
 
+		// API key ไม่มี second factor ให้เช็ค
+		if c.GetUint("api_key_id") == 0 && s.config.Auth.RequireMFAForAdmin && !c.GetBool("mfa") {
+			utils.ForbiddenResponse(c, "Two-factor authentication is required for admin access")
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// hasPermissions checks the scopes of an API key, or the role of a user
+func (s *Server) hasPermissions(c *gin.Context, permissions ...string) (bool, error) {
+	if c.GetUint("api_key_id") == 0 {
+		return s.roleService.HasPermissions(c.Request.Context(), c.GetString("user_role"), permissions...)
+	}
+
+	scopes := c.GetStringSlice("api_key_scopes")
+	for _, p := range permissions {
+		if !slices.Contains(scopes, p) {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// corsMiddleware answers preflight requests and sets the CORS headers for the
+// origins allowed in config. Responses vary by Origin, so caches must not
+// share them between origins.
+func (s *Server) corsMiddleware() gin.HandlerFunc {
+	cfg := s.config.CORS
+	allowAny := slices.Contains(cfg.AllowedOrigins, "*")
+	allowMethods := strings.Join(cfg.AllowedMethods, ", ")
+	allowHeaders := strings.Join(cfg.AllowedHeaders, ", ")
+	exposeHeaders := strings.Join(cfg.ExposedHeaders, ", ")
+	maxAge := strconv.Itoa(int(cfg.MaxAge.Seconds()))
+
+	return func(c *gin.Context) {
+		c.Writer.Header().Add("Vary", "Origin")
+
+		origin := c.GetHeader("Origin")
+		preflight := c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != ""
+
+		if origin == "" {
+			// ไม่ใช่ request จาก browser ตอบ preflight ไปเลยโดยไม่มี CORS header
+			if preflight {
+				c.AbortWithStatus(http.StatusNoContent)
+				return
+			}
+			c.Next()
+			return
+		}
+
+		if !allowAny && !originAllowed(origin, cfg.AllowedOrigins) {
+			if preflight {
+				c.AbortWithStatus(http.StatusForbidden)
+				return
+			}
+			// ไม่ใส่ header ให้ browser บล็อกเอง request จาก server-to-server ยังใช้ได้
+			c.Next()
+			return
+		}
+
+		if allowAny && !cfg.AllowCredentials {
+			c.Header("Access-Control-Allow-Origin", "*")
+		} else {
+			c.Header("Access-Control-Allow-Origin", origin)
+		}
+		if cfg.AllowCredentials {
+			c.Header("Access-Control-Allow-Credentials", "true")
+		}
+
+		if !preflight {
+			if exposeHeaders != "" {
+				c.Header("Access-Control-Expose-Headers", exposeHeaders)
+			}
+			c.Next()
+			return
+		}
+
+		c.Writer.Header().Add("Vary", "Access-Control-Request-Method")
+		c.Writer.Header().Add("Vary", "Access-Control-Request-Headers")
+		c.Header("Access-Control-Allow-Methods", allowMethods)
+		c.Header("Access-Control-Allow-Headers", allowHeaders)
+		c.Header("Access-Control-Max-Age", maxAge)
+		c.AbortWithStatus(http.StatusNoContent)
+	}
+}
+
+// originAllowed matches origin against exact origins and wildcard subdomain
+// patterns like https://*.example.com, which does not match example.com itself
+func originAllowed(origin string, allowed []string) bool {
+	origin = strings.ToLower(origin)
+	for _, pattern := range allowed {
+		pattern = strings.ToLower(strings.TrimRight(pattern, "/"))
+
+		prefix, suffix, wildcard := strings.Cut(pattern, "*.")
+		if !wildcard {
+			if origin == pattern {
+				return true
+			}
+			continue
+		}
+
+		// scheme ต้องตรง และต้องมี subdomain อย่างน้อยหนึ่งชั้น
+		if strings.HasPrefix(origin, prefix) && strings.HasSuffix(origin, "."+suffix) &&
+			len(origin) > len(prefix)+len(suffix)+1 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// rateLimit applies the named policy from config. Requests are counted per API
+// key, then per user, then per client IP, whichever is known when it runs, so
+// put it after the auth middleware on protected routes.
+func (s *Server) rateLimit(policyName string) gin.HandlerFunc {
+	policy, ok := s.config.RateLimit.Policies[policyName]
+	if !s.config.RateLimit.Enabled || !ok || s.rateLimitStore == nil {
+		return func(c *gin.Context) {
+			c.Next()
+		}
+	}
+
+	policyHeader := fmt.Sprintf("%d;w=%d", policy.Requests, int(policy.Period.Seconds()))
+
+	return func(c *gin.Context) {
+		key := policyName + ":" + rateLimitKey(c)
+		result, err := s.rateLimitStore.Allow(c.Request.Context(), key, policy.Requests, policy.Period)
+		if err != nil {
+			// store ล่มไม่ควรพา API ล่มไปด้วย ปล่อยผ่านแล้ว log ไว้
+			logger.FromContext(c.Request.Context()).Error().Err(err).Str("policy", policyName).Msg("rate limit store failed")
+			c.Next()
+			return
+		}
+
+		c.Header("RateLimit-Policy", policyHeader)
+		c.Header("RateLimit-Limit", strconv.Itoa(policy.Requests))
+		c.Header("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		c.Header("RateLimit-Reset", ceilSeconds(result.ResetAfter))
+
+		if !result.Allowed {
+			utils.TooManyRequestsResponse(c, "Too many requests, try again later", result.RetryAfter)
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+func rateLimitKey(c *gin.Context) string {
+	if id := c.GetUint("api_key_id"); id != 0 {
+		return "key:" + strconv.FormatUint(uint64(id), 10)
+	}
+	if id := c.GetUint("user_id"); id != 0 {
+		return "user:" + strconv.FormatUint(uint64(id), 10)
+	}
+	return "ip:" + c.ClientIP()
+}
+
+func ceilSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
+
+// idempotencyMaxBody caps the request body buffered for fingerprinting
+const idempotencyMaxBody = 1 << 20
+
+// idempotencyRedactedFields are removed from responses before they are
+// stored, so the idempotency_keys table never holds credentials. A replay
+// returns the response without them.
+var idempotencyRedactedFields = []string{"access_token", "refresh_token", "lookup_token", "lookup_url"}
+
+// idempotency makes the POST routes listed in IDEMPOTENCY_ROUTES safe to
+// retry: a request carrying an Idempotency-Key header runs once, and retries
+// with the same key and body get the stored response. Put it after the auth
+// middleware so keys are scoped to the user; anonymous keys are scoped to
+// the client IP. Other routes pass straight through.
+func (s *Server) idempotency() gin.HandlerFunc {
+	routes := make(map[string]bool, len(s.config.Idempotency.Routes))
+	for _, route := range s.config.Idempotency.Routes {
+		routes[route] = true
+	}
+
+	return func(c *gin.Context) {
+		key := c.GetHeader("Idempotency-Key")
+		if key == "" || s.idempotencyService == nil || c.Request.Method != http.MethodPost || !routes[c.FullPath()] {
+			c.Next()
+			return
+		}
+		if len(key) > 255 {
+			utils.BadRequestResponse(c, "Idempotency-Key must be at most 255 characters", nil)
+			c.Abort()
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, idempotencyMaxBody))
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				utils.ErrorResponse(c, http.StatusRequestEntityTooLarge, "Request body is too large", nil)
+			} else {
+				utils.BadRequestResponse(c, "Failed to read request body", err)
+			}
+			c.Abort()
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		hash := sha256.New()
+		hash.Write([]byte(c.Request.Method + " " + c.FullPath() + "\n"))
+		hash.Write(body)
+		fingerprint := hex.EncodeToString(hash.Sum(nil))
+
+		// key ของ guest ผูกกับ IP ไม่ให้คนอื่นที่รู้ key มาดึง response ไปได้
+		scope := "ip:" + c.ClientIP()
+		if id := c.GetUint("user_id"); id != 0 {
+			scope = "user:" + strconv.FormatUint(uint64(id), 10)
+		}
+
+		// key เดิมแต่ body ต่าง => 422, request แรกยังไม่จบ => 409
+		record, replay, err := s.idempotencyService.Begin(c.Request.Context(), scope, key, fingerprint)
+		if err != nil {
+			utils.ServiceErrorResponse(c, "Idempotency-Key cannot be used", err)
+			c.Abort()
+			return
+		}
+
+		if replay {
+			c.Header("Idempotent-Replayed", "true")
+			c.Data(*record.StatusCode, record.ContentType, record.ResponseBody)
+			c.Abort()
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+		c.Next()
+
+		// handler ทำงานไปแล้ว ต้องบันทึกผลแม้ client ตัดการเชื่อมต่อหรือหมดเวลา
+		ctx := context.WithoutCancel(c.Request.Context())
+
+		// 5xx อาจเป็นปัญหาชั่วคราว ส่วน 401/403 ถูกปฏิเสธก่อนทำอะไร (เช่นยังไม่ยืนยันอีเมล)
+		// ปล่อยให้ retry ทำงานใหม่ได้
+		status := recorder.Status()
+		if status >= http.StatusInternalServerError || status == http.StatusUnauthorized || status == http.StatusForbidden {
+			err = s.idempotencyService.Release(ctx, record)
+		} else {
+			contentType := recorder.Header().Get("Content-Type")
+			err = s.idempotencyService.Complete(ctx, record, status, contentType, redactStoredResponse(contentType, recorder.body.Bytes()))
+		}
+		if err != nil {
+			logger.FromContext(c.Request.Context()).Error().Err(err).Str("idempotency_key", key).Msg("failed to store idempotent response")
+		}
+	}
+}
+
+// redactStoredResponse removes idempotencyRedactedFields from a JSON body at
+// any depth. Other bodies are returned as they are.
+func redactStoredResponse(contentType string, body []byte) []byte {
+	if !strings.HasPrefix(contentType, "application/json") {
+		return body
+	}
+
+	var value any
+	if err := json.Unmarshal(body, &value); err != nil {
+		return body
+	}
+	if !redactFields(value) {
+		return body
+	}
+
+	redacted, err := json.Marshal(value)
+	if err != nil {
+		return nil
+	}
+	return redacted
+}
+
+// redactFields deletes the redacted fields from value in place and reports
+// whether it found any
+func redactFields(value any) bool {
+	found := false
+	switch v := value.(type) {
+	case map[string]any:
+		for key, field := range v {
+			if slices.Contains(idempotencyRedactedFields, key) {
+				delete(v, key)
+				found = true
+			} else if redactFields(field) {
+				found = true
+			}
+		}
+	case []any:
+		for _, item := range v {
+			if redactFields(item) {
+				found = true
+			}
+		}
+	}
+	return found
+}
+
+// responseRecorder keeps a copy of the response body as it is written
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *responseRecorder) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *responseRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// verifiedEmailMiddleware rejects users who have not confirmed their email address
+func (s *Server) verifiedEmailMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		verified, err := s.userService.IsEmailVerified(c.Request.Context(), c.GetUint("user_id"))
+		if err != nil {
+			// ไม่เจอ user => 404, error อื่นของ DB => 500 และถูก log
+			utils.ServiceErrorResponse(c, "Failed to check email verification", err)
+			c.Abort()
+			return
+		}
+
+		if !verified {
+			utils.ForbiddenResponse(c, "Email address is not verified")
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// checkoutMiddleware applies the checkout restrictions enabled in config
+func (s *Server) checkoutMiddleware() gin.HandlerFunc {
+	if s.config.Auth.RequireVerifiedEmailForCheckout {
+		return s.verifiedEmailMiddleware()
+	}
+
+	return func(c *gin.Context) {
 		c.Next()
 	}
-}
\ No newline at end of file
+}
@@ -0,0 +1,137 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joefazee/learning-go-shop/internal/config"
+)
+
+func newCORSTestRouter(cors config.CORSConfig) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+
+	s := &Server{config: &config.Config{CORS: cors}}
+	router := gin.New()
+	router.Use(s.corsMiddleware())
+	router.GET("/products", func(c *gin.Context) { c.Status(http.StatusOK) })
+	router.OPTIONS("/products", func(c *gin.Context) { c.Status(http.StatusTeapot) })
+
+	return router
+}
+
+func TestCORSMiddleware(t *testing.T) {
+	allowList := config.CORSConfig{
+		AllowedOrigins:   []string{"https://shop.example.com", "https://*.example.org"},
+		AllowedMethods:   []string{"GET", "POST"},
+		AllowedHeaders:   []string{"Authorization", "Content-Type"},
+		ExposedHeaders:   []string{"X-Request-ID"},
+		AllowCredentials: true,
+		MaxAge:           time.Hour,
+	}
+	anyOrigin := allowList
+	anyOrigin.AllowedOrigins = []string{"*"}
+	anyOrigin.AllowCredentials = false
+
+	tests := []struct {
+		name    string
+		cors    config.CORSConfig
+		method  string
+		origin  string
+		request string // Access-Control-Request-Method
+
+		status      int
+		allowOrigin string
+		credentials string
+		allowMethod string
+		exposed     string
+	}{
+		{
+			name: "preflight from allowed origin", cors: allowList,
+			method: http.MethodOptions, origin: "https://shop.example.com", request: "POST",
+			status: http.StatusNoContent, allowOrigin: "https://shop.example.com", credentials: "true", allowMethod: "GET, POST",
+		},
+		{
+			name: "preflight from wildcard subdomain", cors: allowList,
+			method: http.MethodOptions, origin: "https://admin.example.org", request: "POST",
+			status: http.StatusNoContent, allowOrigin: "https://admin.example.org", credentials: "true", allowMethod: "GET, POST",
+		},
+		{
+			name: "preflight from bare wildcard domain", cors: allowList,
+			method: http.MethodOptions, origin: "https://example.org", request: "POST",
+			status: http.StatusForbidden,
+		},
+		{
+			name: "preflight from unknown origin", cors: allowList,
+			method: http.MethodOptions, origin: "https://evil.test", request: "POST",
+			status: http.StatusForbidden,
+		},
+		{
+			name: "preflight without origin", cors: allowList,
+			method: http.MethodOptions, request: "POST",
+			status: http.StatusNoContent,
+		},
+		{
+			name: "plain options is not a preflight", cors: allowList,
+			method: http.MethodOptions, origin: "https://shop.example.com",
+			status: http.StatusTeapot, allowOrigin: "https://shop.example.com", credentials: "true", exposed: "X-Request-ID",
+		},
+		{
+			name: "simple request from allowed origin", cors: allowList,
+			method: http.MethodGet, origin: "https://shop.example.com",
+			status: http.StatusOK, allowOrigin: "https://shop.example.com", credentials: "true", exposed: "X-Request-ID",
+		},
+		{
+			name: "simple request from unknown origin", cors: allowList,
+			method: http.MethodGet, origin: "https://evil.test",
+			status: http.StatusOK,
+		},
+		{
+			name: "request without origin", cors: allowList,
+			method: http.MethodGet,
+			status: http.StatusOK,
+		},
+		{
+			name: "any origin without credentials", cors: anyOrigin,
+			method: http.MethodOptions, origin: "https://anywhere.test", request: "GET",
+			status: http.StatusNoContent, allowOrigin: "*", allowMethod: "GET, POST",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/products", nil)
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			if tt.request != "" {
+				req.Header.Set("Access-Control-Request-Method", tt.request)
+			}
+
+			rec := httptest.NewRecorder()
+			newCORSTestRouter(tt.cors).ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Errorf("status %d, want %d", rec.Code, tt.status)
+			}
+
+			headers := map[string]string{
+				"Access-Control-Allow-Origin":      tt.allowOrigin,
+				"Access-Control-Allow-Credentials": tt.credentials,
+				"Access-Control-Allow-Methods":     tt.allowMethod,
+				"Access-Control-Expose-Headers":    tt.exposed,
+			}
+			for name, want := range headers {
+				if got := rec.Header().Get(name); got != want {
+					t.Errorf("%s = %q, want %q", name, got, want)
+				}
+			}
+
+			if vary := rec.Header().Values("Vary"); len(vary) == 0 || vary[0] != "Origin" {
+				t.Errorf("expected Vary: Origin, got %v", vary)
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joefazee/learning-go-shop/internal/config"
+	"github.com/joefazee/learning-go-shop/internal/models"
+	"github.com/joefazee/learning-go-shop/internal/services"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newIdempotencyTestRouter serves /register and /other, which both count
+// their calls and answer with a token, with only /register configured
+func newIdempotencyTestRouter(t *testing.T) (*gin.Engine, *int) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("open test database: %v", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("open test database: %v", err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+	if err := db.AutoMigrate(&models.IdempotencyKey{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	s := &Server{
+		config:             &config.Config{Idempotency: config.IdempotencyConfig{Routes: []string{"/register"}}},
+		idempotencyService: services.NewIdempotencyService(db, time.Hour),
+	}
+
+	calls := 0
+	handler := func(c *gin.Context) {
+		calls++
+		c.JSON(http.StatusCreated, gin.H{"data": gin.H{"id": calls, "access_token": "secret"}})
+	}
+
+	router := gin.New()
+	router.Use(s.idempotency())
+	router.POST("/register", handler)
+	router.POST("/other", handler)
+
+	return router, &calls
+}
+
+func postWithKey(router *gin.Engine, path string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(`{"email":"a@example.com"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Idempotency-Key", "retry-1")
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestIdempotencyReplaysWithoutTokens(t *testing.T) {
+	router, calls := newIdempotencyTestRouter(t)
+
+	first := postWithKey(router, "/register")
+	if !strings.Contains(first.Body.String(), "secret") {
+		t.Fatalf("expected the first response to carry the token, got %s", first.Body)
+	}
+
+	replayed := postWithKey(router, "/register")
+	if *calls != 1 {
+		t.Errorf("expected the handler to run once, ran %d times", *calls)
+	}
+	if replayed.Code != http.StatusCreated || replayed.Header().Get("Idempotent-Replayed") != "true" {
+		t.Errorf("expected a replayed 201, got %d", replayed.Code)
+	}
+	if body := replayed.Body.String(); strings.Contains(body, "access_token") || !strings.Contains(body, `"id":1`) {
+		t.Errorf("expected the replay without the token, got %s", body)
+	}
+}
+
+func TestIdempotencyIgnoresUnconfiguredRoutes(t *testing.T) {
+	router, calls := newIdempotencyTestRouter(t)
+
+	postWithKey(router, "/other")
+	if rec := postWithKey(router, "/other"); rec.Header().Get("Idempotent-Replayed") != "" {
+		t.Error("unconfigured route was replayed")
+	}
+	if *calls != 2 {
+		t.Errorf("expected the handler to run twice, ran %d times", *calls)
+	}
+}
@@ -0,0 +1,142 @@
+package server
+
+import (
+	"errors"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joefazee/learning-go-shop/internal/dto"
+	"github.com/joefazee/learning-go-shop/internal/services"
+	"github.com/joefazee/learning-go-shop/internal/utils"
+)
+
+// ================== ORDERS ==================
+
+func (s *Server) createOrder(c *gin.Context) {
+	if s.orderService == nil {
+		utils.InternalServerErrorResponse(c, "orderService not initialized", nil)
+		return
+	}
+
+	userID := c.GetUint("user_id")
+	order, err := s.orderService.CreateOrder(c.Request.Context(), userID)
+	if err != nil {
+		var changed *services.CartChangedError
+		if errors.As(err, &changed) {
+			utils.ConflictResponse(c, changed.Error(), changed.Changes)
+			return
+		}
+		utils.ServiceErrorResponse(c, "Failed to create order", err)
+		return
+	}
+
+	utils.CreatedResponse(c, "Order created successfully", order)
+}
+
+func (s *Server) getOrders(c *gin.Context) {
+	if s.orderService == nil {
+		utils.InternalServerErrorResponse(c, "orderService not initialized", nil)
+		return
+	}
+
+	userID := c.GetUint("user_id")
+	page := parseIntQuery(c, "page", 1, 1, 1_000_000)
+	limit := parseIntQuery(c, "limit", 10, 1, 100)
+
+	orders, meta, err := s.orderService.GetOrders(c.Request.Context(), userID, page, limit)
+	if err != nil {
+		utils.ServiceErrorResponse(c, "Failed to fetch orders", err)
+		return
+	}
+
+	utils.PaginatedSuccessResponse(c, "Orders retrieved successfully", orders, *meta)
+}
+
+func (s *Server) getOrder(c *gin.Context) {
+	if s.orderService == nil {
+		utils.InternalServerErrorResponse(c, "orderService not initialized", nil)
+		return
+	}
+
+	id, err := parseUintParam(c, "id")
+	if err != nil {
+		utils.BadRequestResponse(c, "Invalid order ID", err)
+		return
+	}
+
+	userID := c.GetUint("user_id")
+	order, err := s.orderService.GetOrder(c.Request.Context(), userID, id)
+	if err != nil {
+		utils.ServiceErrorResponse(c, "Failed to fetch order", err)
+		return
+	}
+
+	utils.SuccessResponse(c, "Order retrieved successfully", order)
+}
+
+func (s *Server) claimGuestOrders(c *gin.Context) {
+	if s.orderService == nil {
+		utils.InternalServerErrorResponse(c, "orderService not initialized", nil)
+		return
+	}
+
+	var req dto.ClaimGuestOrdersRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequestResponse(c, "Invalid request data", err)
+		return
+	}
+
+	userID := c.GetUint("user_id")
+	email := c.GetString("user_email")
+
+	claimed, err := s.orderService.ClaimGuestOrders(c.Request.Context(), userID, email, req.LookupToken)
+	if err != nil {
+		utils.ServiceErrorResponse(c, "Failed to claim guest orders", err)
+		return
+	}
+
+	utils.SuccessResponse(c, "Guest orders claimed successfully", dto.ClaimGuestOrdersResponse{Claimed: claimed})
+}
+
+// ================== GUEST CHECKOUT ==================
+
+func (s *Server) guestCheckout(c *gin.Context) {
+	if s.orderService == nil {
+		utils.InternalServerErrorResponse(c, "orderService not initialized", nil)
+		return
+	}
+
+	var req dto.GuestCheckoutRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequestResponse(c, "Invalid request data", err)
+		return
+	}
+
+	response, err := s.orderService.CreateGuestOrder(c.Request.Context(), &req)
+	if err != nil {
+		utils.ServiceErrorResponse(c, "Failed to create order", err)
+		return
+	}
+
+	utils.CreatedResponse(c, "Order created successfully", response)
+}
+
+func (s *Server) getGuestOrder(c *gin.Context) {
+	if s.orderService == nil {
+		utils.InternalServerErrorResponse(c, "orderService not initialized", nil)
+		return
+	}
+
+	token := c.Query("token")
+	if token == "" {
+		utils.BadRequestResponse(c, "Lookup token required", nil)
+		return
+	}
+
+	order, err := s.orderService.GetGuestOrder(c.Request.Context(), token)
+	if err != nil {
+		utils.ServiceErrorResponse(c, "Failed to fetch order", err)
+		return
+	}
+
+	utils.SuccessResponse(c, "Order retrieved successfully", order)
+}
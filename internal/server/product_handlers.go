@@ -22,9 +22,9 @@ func (s *Server) createCategory(c *gin.Context) {
 		return
 	}
 
-	category, err := s.productService.CreateCategory(&req)
+	category, err := s.productService.CreateCategory(c.Request.Context(), &req)
 	if err != nil {
-		utils.InternalServerErrorResponse(c, "Failed to create category", err)
+		utils.ServiceErrorResponse(c, "Failed to create category", err)
 		return
 	}
 
@@ -37,9 +37,9 @@ func (s *Server) getCategories(c *gin.Context) {
 		return
 	}
 
-	categories, err := s.productService.GetCategories()
+	categories, err := s.productService.GetCategories(c.Request.Context())
 	if err != nil {
-		utils.InternalServerErrorResponse(c, "Failed to fetch categories", err)
+		utils.ServiceErrorResponse(c, "Failed to fetch categories", err)
 		return
 	}
 
@@ -64,9 +64,9 @@ func (s *Server) updateCategory(c *gin.Context) {
 		return
 	}
 
-	category, err := s.productService.UpdateCategory(id, &req)
+	category, err := s.productService.UpdateCategory(c.Request.Context(), id, &req)
 	if err != nil {
-		utils.InternalServerErrorResponse(c, "Failed to update category", err)
+		utils.ServiceErrorResponse(c, "Failed to update category", err)
 		return
 	}
 
@@ -85,8 +85,8 @@ func (s *Server) deleteCategory(c *gin.Context) {
 		return
 	}
 
-	if err := s.productService.DeleteCategory(id); err != nil {
-		utils.InternalServerErrorResponse(c, "Failed to delete category", err)
+	if err := s.productService.DeleteCategory(c.Request.Context(), id); err != nil {
+		utils.ServiceErrorResponse(c, "Failed to delete category", err)
 		return
 	}
 
@@ -107,9 +107,9 @@ func (s *Server) createProduct(c *gin.Context) {
 		return
 	}
 
-	product, err := s.productService.CreateProduct(&req)
+	product, err := s.productService.CreateProduct(c.Request.Context(), &req)
 	if err != nil {
-		utils.InternalServerErrorResponse(c, "Failed to create product", err)
+		utils.ServiceErrorResponse(c, "Failed to create product", err)
 		return
 	}
 
@@ -125,9 +125,9 @@ func (s *Server) getProducts(c *gin.Context) {
 	page := parseIntQuery(c, "page", 1, 1, 1_000_000)
 	limit := parseIntQuery(c, "limit", 10, 1, 1000)
 
-	products, meta, err := s.productService.GetProducts(page, limit)
+	products, meta, err := s.productService.GetProducts(c.Request.Context(), page, limit)
 	if err != nil {
-		utils.InternalServerErrorResponse(c, "Failed to fetch products", err)
+		utils.ServiceErrorResponse(c, "Failed to fetch products", err)
 		return
 	}
 
@@ -152,9 +152,9 @@ func (s *Server) getProduct(c *gin.Context) {
 		return
 	}
 
-	product, err := s.productService.GetProduct(id)
+	product, err := s.productService.GetProduct(c.Request.Context(), id)
 	if err != nil {
-		utils.NotFoundResponse(c, "Product not found")
+		utils.ServiceErrorResponse(c, "Failed to fetch product", err)
 		return
 	}
 
@@ -179,9 +179,9 @@ func (s *Server) updateProduct(c *gin.Context) {
 		return
 	}
 
-	product, err := s.productService.UpdateProduct(id, &req)
+	product, err := s.productService.UpdateProduct(c.Request.Context(), id, &req)
 	if err != nil {
-		utils.InternalServerErrorResponse(c, "Failed to update product", err)
+		utils.ServiceErrorResponse(c, "Failed to update product", err)
 		return
 	}
 
@@ -200,8 +200,8 @@ func (s *Server) deleteProduct(c *gin.Context) {
 		return
 	}
 
-	if err := s.productService.DeleteProduct(id); err != nil {
-		utils.InternalServerErrorResponse(c, "Failed to delete product", err)
+	if err := s.productService.DeleteProduct(c.Request.Context(), id); err != nil {
+		utils.ServiceErrorResponse(c, "Failed to delete product", err)
 		return
 	}
 
@@ -233,14 +233,14 @@ func (s *Server) uploadProductImage(c *gin.Context) {
 		return
 	}
 
-	url, err := s.uploadService.UploadProductImage(id, file)
+	url, err := s.uploadService.UploadProductImage(c.Request.Context(), id, file)
 	if err != nil {
-		utils.InternalServerErrorResponse(c, "Failed to upload image", err)
+		utils.ServiceErrorResponse(c, "Failed to upload image", err)
 		return
 	}
 
-	if err := s.productService.AddProductImage(id, url, file.Filename); err != nil {
-		utils.InternalServerErrorResponse(c, "Failed to save image record", err)
+	if err := s.productService.AddProductImage(c.Request.Context(), id, url, file.Filename); err != nil {
+		utils.ServiceErrorResponse(c, "Failed to save image record", err)
 		return
 	}
 
@@ -0,0 +1,55 @@
+package server
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joefazee/learning-go-shop/internal/utils"
+)
+
+const reportDateFormat = "2006-01-02"
+
+// ================== ADMIN REPORTS ==================
+
+func (s *Server) getAbandonedCartReport(c *gin.Context) {
+	if s.abandonedCartService == nil {
+		utils.InternalServerErrorResponse(c, "abandonedCartService not initialized", nil)
+		return
+	}
+
+	// default: 30 วันล่าสุด
+	to := time.Now()
+	from := to.AddDate(0, 0, -30)
+
+	if v := c.Query("from"); v != "" {
+		t, err := time.Parse(reportDateFormat, v)
+		if err != nil {
+			utils.BadRequestResponse(c, "Invalid from date, expected YYYY-MM-DD", err)
+			return
+		}
+		from = t
+	}
+
+	if v := c.Query("to"); v != "" {
+		t, err := time.Parse(reportDateFormat, v)
+		if err != nil {
+			utils.BadRequestResponse(c, "Invalid to date, expected YYYY-MM-DD", err)
+			return
+		}
+		// รวมทั้งวันของ to
+		to = t.AddDate(0, 0, 1)
+	}
+
+	if !from.Before(to) {
+		utils.BadRequestResponse(c, "from must be before to", nil)
+		return
+	}
+
+	report, err := s.abandonedCartService.GetReport(c.Request.Context(), from, to)
+	if err != nil {
+		utils.ServiceErrorResponse(c, "Failed to build report", err)
+		return
+	}
+
+	utils.SuccessResponse(c, "Report generated successfully", report)
+}
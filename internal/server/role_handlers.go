@@ -0,0 +1,134 @@
+package server
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/joefazee/learning-go-shop/internal/dto"
+	"github.com/joefazee/learning-go-shop/internal/utils"
+)
+
+// ================== ADMIN ROLES ==================
+
+func (s *Server) getRoles(c *gin.Context) {
+	if s.roleService == nil {
+		utils.InternalServerErrorResponse(c, "roleService not initialized", nil)
+		return
+	}
+
+	roles, err := s.roleService.ListRoles(c.Request.Context())
+	if err != nil {
+		utils.ServiceErrorResponse(c, "Failed to fetch roles", err)
+		return
+	}
+
+	utils.SuccessResponse(c, "Roles retrieved successfully", roles)
+}
+
+func (s *Server) getPermissions(c *gin.Context) {
+	if s.roleService == nil {
+		utils.InternalServerErrorResponse(c, "roleService not initialized", nil)
+		return
+	}
+
+	permissions, err := s.roleService.ListPermissions(c.Request.Context())
+	if err != nil {
+		utils.ServiceErrorResponse(c, "Failed to fetch permissions", err)
+		return
+	}
+
+	utils.SuccessResponse(c, "Permissions retrieved successfully", permissions)
+}
+
+func (s *Server) createRole(c *gin.Context) {
+	if s.roleService == nil {
+		utils.InternalServerErrorResponse(c, "roleService not initialized", nil)
+		return
+	}
+
+	var req dto.CreateRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequestResponse(c, "Invalid request data", err)
+		return
+	}
+
+	role, err := s.roleService.CreateRole(c.Request.Context(), &req)
+	if err != nil {
+		utils.ServiceErrorResponse(c, "Failed to create role", err)
+		return
+	}
+
+	utils.CreatedResponse(c, "Role created successfully", role)
+}
+
+func (s *Server) updateRole(c *gin.Context) {
+	if s.roleService == nil {
+		utils.InternalServerErrorResponse(c, "roleService not initialized", nil)
+		return
+	}
+
+	id, err := parseUintParam(c, "id")
+	if err != nil {
+		utils.BadRequestResponse(c, "Invalid role ID", err)
+		return
+	}
+
+	var req dto.UpdateRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequestResponse(c, "Invalid request data", err)
+		return
+	}
+
+	role, err := s.roleService.UpdateRole(c.Request.Context(), id, &req)
+	if err != nil {
+		utils.ServiceErrorResponse(c, "Failed to update role", err)
+		return
+	}
+
+	utils.SuccessResponse(c, "Role updated successfully", role)
+}
+
+func (s *Server) deleteRole(c *gin.Context) {
+	if s.roleService == nil {
+		utils.InternalServerErrorResponse(c, "roleService not initialized", nil)
+		return
+	}
+
+	id, err := parseUintParam(c, "id")
+	if err != nil {
+		utils.BadRequestResponse(c, "Invalid role ID", err)
+		return
+	}
+
+	if err := s.roleService.DeleteRole(c.Request.Context(), id); err != nil {
+		utils.ServiceErrorResponse(c, "Failed to delete role", err)
+		return
+	}
+
+	utils.SuccessResponse(c, "Role deleted successfully", nil)
+}
+
+func (s *Server) assignRole(c *gin.Context) {
+	if s.roleService == nil {
+		utils.InternalServerErrorResponse(c, "roleService not initialized", nil)
+		return
+	}
+
+	userID, err := parseUintParam(c, "id")
+	if err != nil {
+		utils.BadRequestResponse(c, "Invalid user ID", err)
+		return
+	}
+
+	var req dto.AssignRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequestResponse(c, "Invalid request data", err)
+		return
+	}
+
+	user, err := s.roleService.AssignRole(c.Request.Context(), c.GetUint("user_id"), userID, req.Role)
+	if err != nil {
+		utils.ServiceErrorResponse(c, "Failed to assign role", err)
+		return
+	}
+
+	utils.SuccessResponse(c, "Role assigned successfully", user)
+}
@@ -1,12 +1,20 @@
 package server
 
 import (
+	"fmt"
 	"net/http"
+	"strings"
+	"sync/atomic"
 
 	"github.com/gin-gonic/gin"
 	"github.com/joefazee/learning-go-shop/internal/config"
+	"github.com/joefazee/learning-go-shop/internal/interfaces"
+	"github.com/joefazee/learning-go-shop/internal/models"
 	"github.com/joefazee/learning-go-shop/internal/services"
+	"github.com/joefazee/learning-go-shop/internal/telemetry"
+	"github.com/joefazee/learning-go-shop/internal/utils"
 	"github.com/rs/zerolog"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 	"gorm.io/gorm"
 )
 
@@ -14,52 +22,138 @@ type Server struct {
 	config *config.Config
 	db     *gorm.DB
 	logger *zerolog.Logger
+	keys   *utils.KeySet
 
 	// Injected services
 	authService    *services.AuthService
 	productService *services.ProductService
 	userService    *services.UserService
 	uploadService  *services.UploadService
+	orderService   *services.OrderService
+	cartService    *services.CartService
+	mfaService     *services.MFAService
+	sessionService *services.SessionService
+
+	abandonedCartService *services.AbandonedCartService
+	tokenVersionService  *services.TokenVersionService
+	roleService          *services.RoleService
+	adminUserService     *services.AdminUserService
+	identityService      *services.IdentityService
+	apiKeyService        *services.APIKeyService
+	loginThrottleService *services.LoginThrottleService
+	idempotencyService   *services.IdempotencyService
+	healthService        *services.HealthService
+
+	rateLimitStore interfaces.RateLimitStore
+
+	// nil เมื่อปิด metrics
+	metrics *telemetry.Metrics
+
+	// true ระหว่าง graceful shutdown ให้ /health/ready ตอบ 503
+	draining atomic.Bool
 }
 
 func New(
 	cfg *config.Config,
 	db *gorm.DB,
 	logger *zerolog.Logger,
+	keys *utils.KeySet,
 	authService *services.AuthService,
 	productService *services.ProductService,
 	userService *services.UserService,
 	uploadService *services.UploadService,
+	orderService *services.OrderService,
+	cartService *services.CartService,
+	mfaService *services.MFAService,
+	sessionService *services.SessionService,
+	abandonedCartService *services.AbandonedCartService,
+	tokenVersionService *services.TokenVersionService,
+	roleService *services.RoleService,
+	adminUserService *services.AdminUserService,
+	identityService *services.IdentityService,
+	apiKeyService *services.APIKeyService,
+	loginThrottleService *services.LoginThrottleService,
+	idempotencyService *services.IdempotencyService,
+	healthService *services.HealthService,
+	rateLimitStore interfaces.RateLimitStore,
+	metrics *telemetry.Metrics,
 ) *Server {
 	return &Server{
 		config:         cfg,
 		db:             db,
 		logger:         logger,
+		keys:           keys,
 		authService:    authService,
 		productService: productService,
 		userService:    userService,
 		uploadService:  uploadService,
+		orderService:   orderService,
+		cartService:    cartService,
+		mfaService:     mfaService,
+		sessionService: sessionService,
+
+		abandonedCartService: abandonedCartService,
+		tokenVersionService:  tokenVersionService,
+		roleService:          roleService,
+		adminUserService:     adminUserService,
+		identityService:      identityService,
+		apiKeyService:        apiKeyService,
+		loginThrottleService: loginThrottleService,
+		idempotencyService:   idempotencyService,
+		healthService:        healthService,
+
+		rateLimitStore: rateLimitStore,
+
+		metrics: metrics,
 	}
 }
 
-func (s *Server) SetupRoutes() *gin.Engine {
+func (s *Server) SetupRoutes() (*gin.Engine, error) {
 	router := gin.New()
 
+	// c.ClientIP() ใช้ X-Forwarded-For เฉพาะเมื่อมาจาก proxy ที่ตั้งไว้เท่านั้น
+	if err := router.SetTrustedProxies(s.config.Server.TrustedProxies); err != nil {
+		return nil, fmt.Errorf("invalid TRUSTED_PROXIES: %w", err)
+	}
+
+	// validation error บอกชื่อ field ตาม json ที่ client ส่งมา
+	utils.RegisterJSONFieldNames()
+
 	// Marker log
 	if s.logger != nil {
 		s.logger.Info().Msg("routes loaded: /api/v1/* enabled")
 	}
 
 	// Middlewares
-	router.Use(gin.Logger())
-	router.Use(gin.Recovery())
+	if s.config.Tracing.Enabled {
+		// ต่อ trace จาก traceparent ของ caller และไม่ trace การ scrape metrics / health probe
+		router.Use(otelgin.Middleware(s.config.Tracing.ServiceName, otelgin.WithFilter(func(r *http.Request) bool {
+			return r.URL.Path != "/metrics" && !strings.HasPrefix(r.URL.Path, "/health")
+		})))
+	}
+	router.Use(s.requestLogger())
+	if s.metrics != nil {
+		router.Use(s.httpMetrics())
+	}
+	router.Use(s.recovery())
+	router.Use(s.requestTimeout())
 	router.Use(s.corsMiddleware())
 
 	// Static files for uploaded images
 	router.Static("/uploads", "./uploads")
 
-	// Health
-	router.GET("/health", s.healthCheck)
+	// Health: live = process ยังทำงาน, ready = พร้อมรับ traffic (DB, migration, upload)
+	router.GET("/health", s.healthLive)
+	router.GET("/health/live", s.healthLive)
+	router.GET("/health/ready", s.healthReady)
+
+	// Prometheus metrics
+	if s.metrics != nil {
+		router.GET("/metrics", s.metricsAuth(), gin.WrapH(s.metrics.Handler()))
+	}
+
+	// Public keys for services that verify our access tokens
+	router.GET("/.well-known/jwks.json", s.jwks)
 
 	// Debug: list all routes
 	router.GET("/__routes", func(c *gin.Context) {
@@ -78,49 +172,163 @@ func (s *Server) SetupRoutes() *gin.Engine {
 	api := router.Group("/api/v1")
 	{
 		// ===== AUTH (PUBLIC) =====
+		// เข้มกับ /auth กันเดารหัสผ่าน/ยิงอีเมล ผ่อนกับการอ่านข้อมูลสาธารณะ
+		publicLimit := s.rateLimit("public")
+
 		auth := api.Group("/auth")
+		auth.Use(s.rateLimit("auth"), s.idempotency())
 		{
 			auth.POST("/register", s.register)
 			auth.POST("/login", s.login)
+			auth.POST("/login/mfa", s.loginWithMFA)
 			auth.POST("/refresh", s.refreshToken)
 			auth.POST("/logout", s.logout)
+			auth.POST("/verify-email", s.verifyEmail)
+			auth.POST("/resend-verification", s.resendVerification)
+			auth.POST("/forgot-password", s.forgotPassword)
+			auth.POST("/reset-password", s.resetPassword)
+
+			auth.GET("/oidc/providers", s.getIdentityProviders)
+			auth.POST("/oidc/:provider/start", s.startOIDCLogin)
+			auth.POST("/oidc/callback", s.completeOIDCLogin)
 		}
 
 		// ===== PROTECTED =====
 		protected := api.Group("/")
-		protected.Use(s.authMiddleware())
+		protected.Use(s.authMiddleware(), s.rateLimit("api"), s.idempotency())
 		{
 			// ---- USERS ----
 			users := protected.Group("/users")
 			{
 				users.GET("/profile", s.getProfile)
 				users.PUT("/profile", s.updateProfile)
+				users.PUT("/password", s.changePassword)
+
+				users.POST("/2fa/setup", s.setupTwoFactor)
+				users.POST("/2fa/enable", s.enableTwoFactor)
+				users.POST("/2fa/disable", s.disableTwoFactor)
+				users.POST("/2fa/recovery-codes", s.regenerateRecoveryCodes)
+
+				users.GET("/sessions", s.getSessions)
+				users.DELETE("/sessions", s.revokeOtherSessions)
+				users.DELETE("/sessions/:id", s.revokeSession)
+
+				users.GET("/identities", s.getIdentities)
+				users.POST("/identities/:provider/start", s.startIdentityLink)
+				users.POST("/identities/callback", s.completeIdentityLink)
+				users.DELETE("/identities/:id", s.unlinkIdentity)
+			}
+
+			// ---- CART ----
+			cart := protected.Group("/cart")
+			{
+				cart.GET("", s.getCart)
+				cart.POST("/items", s.addToCart)
+				cart.PUT("/items/:id", s.updateCartItem)
+				cart.DELETE("/items/:id", s.removeFromCart)
+				cart.POST("/acknowledge", s.acknowledgeCartChanges)
 			}
 
-			// ---- CATEGORIES (ADMIN ONLY WRITE) ----
-			categories := protected.Group("/categories")
+			// ---- ORDERS ----
+			orders := protected.Group("/orders")
 			{
-				categories.POST("", s.adminMiddleware(), s.createCategory)
-				categories.PUT("/:id", s.adminMiddleware(), s.updateCategory)
-				categories.DELETE("/:id", s.adminMiddleware(), s.deleteCategory)
+				orders.POST("", s.checkoutMiddleware(), s.createOrder)
+				orders.GET("", s.getOrders)
+				orders.GET("/:id", s.getOrder)
+
+				// ต้องยืนยันอีเมลก่อน ไม่งั้นใครก็สมัครด้วยอีเมลคนอื่นแล้วเอา order ไปได้
+				orders.POST("/claim", s.verifiedEmailMiddleware(), s.claimGuestOrders)
+			}
+		}
+
+		// ===== STAFF (PERMISSION BASED, BEARER TOKEN OR X-API-Key) =====
+		staff := api.Group("/")
+		staff.Use(s.staffAuthMiddleware(), s.rateLimit("api"), s.idempotency())
+		{
+			// ---- CATEGORIES (CATALOG WRITE) ----
+			categories := staff.Group("/categories")
+			categories.Use(s.requirePermission(models.PermissionCatalogWrite))
+			{
+				categories.POST("", s.createCategory)
+				categories.PUT("/:id", s.updateCategory)
+				categories.DELETE("/:id", s.deleteCategory)
 			}
 
-			// ---- PRODUCTS (ADMIN ONLY WRITE) ----
-			products := protected.Group("/products")
+			// ---- PRODUCTS (CATALOG WRITE) ----
+			products := staff.Group("/products")
+			products.Use(s.requirePermission(models.PermissionCatalogWrite))
 			{
-				products.POST("", s.adminMiddleware(), s.createProduct)
-				products.PUT("/:id", s.adminMiddleware(), s.updateProduct)
-				products.DELETE("/:id", s.adminMiddleware(), s.deleteProduct)
+				products.POST("", s.createProduct)
+				products.PUT("/:id", s.updateProduct)
+				products.DELETE("/:id", s.deleteProduct)
 
 				// Upload product image
-				products.POST("/:id/images", s.adminMiddleware(), s.uploadProductImage)
+				products.POST("/:id/images", s.uploadProductImage)
+			}
+
+			// ---- ADMIN ----
+			admin := staff.Group("/admin")
+			{
+				admin.GET("/reports/abandoned-carts", s.requirePermission(models.PermissionReportsRead), s.getAbandonedCartReport)
+
+				adminOrders := admin.Group("/orders")
+				adminOrders.Use(s.requirePermission(models.PermissionOrdersManage))
+				{
+					adminOrders.GET("", s.getAdminOrders)
+					adminOrders.GET("/:id", s.getAdminOrder)
+					adminOrders.PATCH("/:id/status", s.updateOrderStatus)
+				}
+
+				adminUsers := admin.Group("/users")
+				adminUsers.Use(s.requirePermission(models.PermissionUsersManage))
+				{
+					adminUsers.GET("", s.getAdminUsers)
+					adminUsers.GET("/:id", s.getAdminUser)
+					adminUsers.PATCH("/:id", s.updateAdminUser)
+					adminUsers.POST("/:id/logout", s.forceLogoutUser)
+					adminUsers.POST("/:id/unlock", s.unlockUser)
+				}
+
+				lockouts := admin.Group("")
+				lockouts.Use(s.requirePermission(models.PermissionUsersManage))
+				{
+					lockouts.DELETE("/ip-locks/:ip", s.unlockIP)
+					lockouts.GET("/audit-events", s.getAuditEvents)
+				}
+
+				roles := admin.Group("")
+				roles.Use(s.requirePermission(models.PermissionRolesManage))
+				{
+					roles.GET("/roles", s.getRoles)
+					roles.POST("/roles", s.createRole)
+					roles.PUT("/roles/:id", s.updateRole)
+					roles.DELETE("/roles/:id", s.deleteRole)
+					roles.GET("/permissions", s.getPermissions)
+					roles.PUT("/users/:id/role", s.assignRole)
+				}
+
+				apiKeys := admin.Group("/api-keys")
+				apiKeys.Use(s.requirePermission(models.PermissionAPIKeysManage))
+				{
+					apiKeys.GET("", s.getAPIKeys)
+					apiKeys.POST("", s.createAPIKey)
+					apiKeys.DELETE("/:id", s.revokeAPIKey)
+				}
 			}
 		}
 
 		// ===== PUBLIC READ =====
-		api.GET("/categories", s.getCategories)
-		api.GET("/products", s.getProducts)
-		api.GET("/products/:id", s.getProduct)
+		api.GET("/categories", publicLimit, s.getCategories)
+		api.GET("/products", publicLimit, s.getProducts)
+		api.GET("/products/:id", publicLimit, s.getProduct)
+
+		// ===== GUEST CHECKOUT (PUBLIC) =====
+		guest := api.Group("/guest")
+		guest.Use(publicLimit, s.idempotency())
+		{
+			guest.POST("/checkout", s.guestCheckout)
+			guest.GET("/orders", s.getGuestOrder)
+		}
 	}
 
 	// Custom 404 handler
@@ -132,25 +340,10 @@ func (s *Server) SetupRoutes() *gin.Engine {
 		})
 	})
 
-	return router
+	return router, nil
 }
 
-func (s *Server) healthCheck(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{"status": "ok"})
-}
-
-func (s *Server) corsMiddleware() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		c.Header("Access-Control-Allow-Origin", "*")
-		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Header("Access-Control-Allow-Headers", "Content-Type, Authorization")
-		c.Header("Access-Control-Max-Age", "86400")
-
-		if c.Request.Method == http.MethodOptions {
-			c.AbortWithStatus(http.StatusNoContent)
-			return
-		}
-
-		c.Next()
-	}
+func (s *Server) jwks(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, s.keys.JWKS())
 }
@@ -0,0 +1,133 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"github.com/joefazee/learning-go-shop/internal/config"
+	"github.com/joefazee/learning-go-shop/internal/dto"
+	"github.com/joefazee/learning-go-shop/internal/interfaces"
+	"github.com/joefazee/learning-go-shop/internal/models"
+	"gorm.io/gorm"
+)
+
+type AbandonedCartService struct {
+	db       *gorm.DB
+	config   *config.CartConfig
+	notifier interfaces.Notifier
+}
+
+func NewAbandonedCartService(db *gorm.DB, cfg *config.CartConfig, notifier interfaces.Notifier) *AbandonedCartService {
+	return &AbandonedCartService{
+		db:       db,
+		config:   cfg,
+		notifier: notifier,
+	}
+}
+
+// DetectAbandonedCarts records carts whose items have not been touched since
+// now - AbandonAfter and sends a reminder for each one. A cart is recorded at
+// most once per period of inactivity.
+func (s *AbandonedCartService) DetectAbandonedCarts(ctx context.Context, now time.Time) (*dto.AbandonedCartRunResult, error) {
+	cutoff := now.Add(-s.config.AbandonAfter)
+
+	var carts []models.Cart
+	// กรอง user ที่ปิดหรือถูกลบใน SQL ถ้าข้ามทีหลัง cart พวกนี้จะกลับมาเต็ม batch ทุกรอบ
+	if err := s.db.WithContext(ctx).Preload("User").Preload("CartItems.Product").
+		Joins("JOIN users u ON u.id = carts.user_id AND u.is_active = ? AND u.deleted_at IS NULL", true).
+		Where("carts.updated_at < ?", cutoff).
+		Where("EXISTS (SELECT 1 FROM cart_items ci WHERE ci.cart_id = carts.id AND ci.deleted_at IS NULL)").
+		Where("NOT EXISTS (SELECT 1 FROM cart_abandonments a WHERE a.cart_id = carts.id AND a.cart_updated_at >= carts.updated_at)").
+		Order("carts.updated_at").
+		Limit(s.config.AbandonBatchSize).
+		Find(&carts).Error; err != nil {
+		return nil, err
+	}
+
+	result := &dto.AbandonedCartRunResult{}
+	for i := range carts {
+		cart := &carts[i]
+		// user ถูกลบระหว่าง query กับ preload
+		if cart.User == nil {
+			continue
+		}
+
+		notification := &interfaces.AbandonedCartNotification{
+			UserID:    cart.UserID,
+			Email:     cart.User.Email,
+			FirstName: cart.User.FirstName,
+			Items:     make([]interfaces.AbandonedCartItem, len(cart.CartItems)),
+		}
+		for j := range cart.CartItems {
+			item := &cart.CartItems[j]
+			notification.CartValue += float64(item.Quantity) * item.Product.Price
+			notification.Items[j] = interfaces.AbandonedCartItem{
+				ProductName: item.Product.Name,
+				Quantity:    item.Quantity,
+				Price:       item.Product.Price,
+			}
+		}
+
+		abandonment := models.CartAbandonment{
+			CartID:        cart.ID,
+			UserID:        cart.UserID,
+			ItemCount:     len(cart.CartItems),
+			CartValue:     notification.CartValue,
+			CartUpdatedAt: cart.UpdatedAt,
+			DetectedAt:    now,
+		}
+		if err := s.db.WithContext(ctx).Create(&abandonment).Error; err != nil {
+			return result, err
+		}
+		result.Detected++
+
+		// ส่งไม่สำเร็จก็ยังเก็บ event ไว้ รอบหน้าจะไม่ส่งซ้ำ
+		if err := s.notifier.NotifyAbandonedCart(ctx, notification); err != nil {
+			result.ReminderFailures++
+			continue
+		}
+
+		sentAt := time.Now()
+		if err := s.db.WithContext(ctx).Model(&abandonment).Update("reminder_sent_at", sentAt).Error; err != nil {
+			return result, err
+		}
+		result.RemindersSent++
+	}
+
+	return result, nil
+}
+
+// GetReport summarizes abandoned carts detected in [from, to)
+func (s *AbandonedCartService) GetReport(ctx context.Context, from, to time.Time) (*dto.AbandonedCartReport, error) {
+	report := dto.AbandonedCartReport{
+		From: from.Format(defaultDateFormat),
+		To:   to.Format(defaultDateFormat),
+	}
+
+	if err := s.db.WithContext(ctx).Model(&models.CartAbandonment{}).
+		Select(`COUNT(*) AS abandoned_count,
+			COALESCE(SUM(cart_value), 0) AS abandoned_value,
+			COUNT(recovered_at) AS recovered_count,
+			COALESCE(SUM(cart_value) FILTER (WHERE recovered_at IS NOT NULL), 0) AS recovered_value,
+			COUNT(reminder_sent_at) AS reminders_sent`).
+		Where("detected_at >= ? AND detected_at < ?", from, to).
+		Scan(&report).Error; err != nil {
+		return nil, err
+	}
+
+	if report.AbandonedCount > 0 {
+		report.RecoveryRate = float64(report.RecoveredCount) / float64(report.AbandonedCount)
+	}
+
+	return &report, nil
+}
+
+// markCartRecovered closes the open abandonment of a cart once it turns into an order
+func markCartRecovered(tx *gorm.DB, cartID, orderID uint) error {
+	return tx.Model(&models.CartAbandonment{}).
+		Where("cart_id = ? AND recovered_at IS NULL", cartID).
+		Updates(map[string]interface{}{
+			"recovered_at": time.Now(),
+			"order_id":     orderID,
+		}).Error
+}
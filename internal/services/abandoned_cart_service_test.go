@@ -0,0 +1,86 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/joefazee/learning-go-shop/internal/config"
+	"github.com/joefazee/learning-go-shop/internal/interfaces"
+	"github.com/joefazee/learning-go-shop/internal/models"
+	"gorm.io/gorm"
+)
+
+type recordingNotifier struct {
+	notifications []*interfaces.AbandonedCartNotification
+}
+
+func (n *recordingNotifier) NotifyAbandonedCart(_ context.Context, notification *interfaces.AbandonedCartNotification) error {
+	n.notifications = append(n.notifications, notification)
+	return nil
+}
+
+// fillAbandonedCart puts a product into the cart of user and backdates the
+// cart to updatedAt
+func fillAbandonedCart(t *testing.T, db *gorm.DB, product *models.Product, userID uint, updatedAt time.Time) {
+	t.Helper()
+
+	var cart models.Cart
+	if err := db.Where("user_id = ?", userID).First(&cart).Error; err != nil {
+		t.Fatalf("load cart: %v", err)
+	}
+	if err := db.Create(&models.CartItem{CartID: cart.ID, ProductID: product.ID, Quantity: 1, Price: product.Price}).Error; err != nil {
+		t.Fatalf("add cart item: %v", err)
+	}
+	if err := db.Model(&cart).UpdateColumn("updated_at", updatedAt).Error; err != nil {
+		t.Fatalf("backdate cart: %v", err)
+	}
+}
+
+func TestDetectAbandonedCartsSkipsInactiveAndDeletedUsers(t *testing.T) {
+	db := newTestDB(t)
+	auth := newTestAuthService(t, db, newTestConfig())
+	now := time.Now()
+
+	product := models.Product{CategoryID: 1, Name: "Mug", Price: 12.5, Stock: 10, SKU: "MUG-1", IsActive: true}
+	if err := db.Create(&product).Error; err != nil {
+		t.Fatalf("create product: %v", err)
+	}
+
+	// the carts of the inactive and deleted users are the oldest, so with a
+	// batch of two they would be picked before the active user's cart
+	inactive := registerTestUser(t, auth, "inactive@example.com").User
+	deleted := registerTestUser(t, auth, "deleted@example.com").User
+	active := registerTestUser(t, auth, "active@example.com").User
+	fillAbandonedCart(t, db, &product, inactive.ID, now.Add(-72*time.Hour))
+	fillAbandonedCart(t, db, &product, deleted.ID, now.Add(-71*time.Hour))
+	fillAbandonedCart(t, db, &product, active.ID, now.Add(-48*time.Hour))
+
+	db.Model(&models.User{}).Where("id = ?", inactive.ID).Update("is_active", false)
+	db.Delete(&models.User{}, deleted.ID)
+
+	notifier := &recordingNotifier{}
+	carts := NewAbandonedCartService(db, &config.CartConfig{AbandonAfter: 24 * time.Hour, AbandonBatchSize: 2}, notifier)
+
+	for run := range 2 {
+		result, err := carts.DetectAbandonedCarts(context.Background(), now)
+		if err != nil {
+			t.Fatalf("DetectAbandonedCarts: %v", err)
+		}
+
+		want := 1
+		if run > 0 {
+			want = 0 // already recorded
+		}
+		if result.Detected != want {
+			t.Fatalf("run %d detected %d carts, want %d", run+1, result.Detected, want)
+		}
+	}
+
+	if len(notifier.notifications) != 1 || notifier.notifications[0].UserID != active.ID {
+		t.Fatalf("expected one reminder to user %d, got %+v", active.ID, notifier.notifications)
+	}
+	if notifier.notifications[0].CartValue != 12.5 {
+		t.Errorf("cart value %v, want 12.5", notifier.notifications[0].CartValue)
+	}
+}
@@ -0,0 +1,296 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/joefazee/learning-go-shop/internal/dto"
+	"github.com/joefazee/learning-go-shop/internal/models"
+	"github.com/joefazee/learning-go-shop/internal/utils"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrOwnAccountChange = utils.NewValidationError("own_account_change", "you cannot deactivate or sign out your own account here")
+
+	ErrAdminUserExists        = utils.NewConflictError("user_exists", "a user with this email already exists; pass -promote to make it an admin")
+	ErrAdminPromotePassword   = utils.NewValidationError("promote_password", "the password of an existing user cannot be set here; leave -password and ADMIN_PASSWORD empty when promoting")
+	ErrAdminPromoteUnverified = utils.NewForbiddenError("promote_unverified", "only users with a verified email can be promoted to admin")
+)
+
+// AdminUserService lets staff find, deactivate and sign out users
+type AdminUserService struct {
+	db            *gorm.DB
+	tokenVersions *TokenVersionService
+}
+
+func NewAdminUserService(db *gorm.DB, tokenVersions *TokenVersionService) *AdminUserService {
+	return &AdminUserService{db: db, tokenVersions: tokenVersions}
+}
+
+// ListUsers searches users by email or name, newest first
+func (s *AdminUserService) ListUsers(ctx context.Context, query *dto.AdminUserListQuery) ([]dto.AdminUserResponse, *utils.PaginationMeta, error) {
+	page, limit := query.Page, query.Limit
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 {
+		limit = 20
+	}
+
+	db := s.db.WithContext(ctx).Model(&models.User{})
+	if search := strings.TrimSpace(query.Search); search != "" {
+		like := "%" + strings.ToLower(search) + "%"
+		db = db.Where("LOWER(email) LIKE ? OR LOWER(first_name || ' ' || last_name) LIKE ?", like, like)
+	}
+	if query.Role != "" {
+		db = db.Where("role = ?", query.Role)
+	}
+	if query.IsActive != nil {
+		db = db.Where("is_active = ?", *query.IsActive)
+	}
+
+	var total int64
+	if err := db.Count(&total).Error; err != nil {
+		return nil, nil, err
+	}
+
+	var users []models.User
+	if err := db.Order("created_at DESC").Order("id DESC").
+		Offset((page - 1) * limit).Limit(limit).
+		Find(&users).Error; err != nil {
+		return nil, nil, err
+	}
+
+	sessions, err := s.activeSessionCounts(ctx, users)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	response := make([]dto.AdminUserResponse, len(users))
+	for i := range users {
+		response[i] = toAdminUserResponse(&users[i], sessions[users[i].ID])
+	}
+
+	meta := &utils.PaginationMeta{
+		Page:       page,
+		Limit:      limit,
+		Total:      total,
+		TotalPages: int((total + int64(limit) - 1) / int64(limit)),
+	}
+
+	return response, meta, nil
+}
+
+func (s *AdminUserService) GetUser(ctx context.Context, id uint) (*dto.AdminUserResponse, error) {
+	var user models.User
+	if err := s.db.WithContext(ctx).First(&user, id).Error; err != nil {
+		return nil, err
+	}
+
+	sessions, err := s.activeSessionCounts(ctx, []models.User{user})
+	if err != nil {
+		return nil, err
+	}
+
+	response := toAdminUserResponse(&user, sessions[user.ID])
+	return &response, nil
+}
+
+// UpdateUser activates/deactivates a user and changes their role. Any change
+// revokes the user's access tokens; deactivation also ends every session.
+func (s *AdminUserService) UpdateUser(ctx context.Context, actorID, id uint, req *dto.AdminUpdateUserRequest) (*dto.AdminUserResponse, error) {
+	if actorID == id && req.IsActive != nil && !*req.IsActive {
+		return nil, ErrOwnAccountChange
+	}
+	if actorID == id && req.Role != nil {
+		return nil, ErrOwnRoleChange
+	}
+
+	var user models.User
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&user, id).Error; err != nil {
+			return err
+		}
+
+		changed := false
+
+		if req.Role != nil {
+			roleChanged, err := setUserRole(tx, &user, *req.Role)
+			if err != nil {
+				return err
+			}
+			changed = changed || roleChanged
+		}
+
+		if req.IsActive != nil && *req.IsActive != user.IsActive {
+			if err := tx.Model(&models.User{}).Where("id = ?", user.ID).Update("is_active", *req.IsActive).Error; err != nil {
+				return err
+			}
+			user.IsActive = *req.IsActive
+			changed = true
+
+			if !user.IsActive {
+				if err := revokeRefreshTokens(tx, user.ID); err != nil {
+					return err
+				}
+			}
+		}
+
+		if !changed {
+			return nil
+		}
+
+		return bumpTokenVersion(tx, user.ID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.tokenVersions.Invalidate(user.ID)
+
+	return s.GetUser(ctx, user.ID)
+}
+
+// ForceLogout ends every session of a user and revokes their access tokens
+func (s *AdminUserService) ForceLogout(ctx context.Context, actorID, id uint) (int64, error) {
+	if actorID == id {
+		return 0, ErrOwnAccountChange
+	}
+
+	var revoked int64
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var user models.User
+		if err := tx.Select("id").First(&user, id).Error; err != nil {
+			return err
+		}
+
+		result := tx.Where("user_id = ?", user.ID).Delete(&models.RefreshToken{})
+		if result.Error != nil {
+			return result.Error
+		}
+		revoked = result.RowsAffected
+
+		return bumpTokenVersion(tx, user.ID)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	s.tokenVersions.Invalidate(id)
+	return revoked, nil
+}
+
+// CreateAdmin creates an admin account. Used to bootstrap the first admin.
+// An existing user with the same email is promoted and reactivated only when
+// promote is set and the user has verified the email; otherwise whoever
+// registered the address first would become admin.
+func (s *AdminUserService) CreateAdmin(ctx context.Context, email, password, firstName, lastName string, promote bool) (*dto.UserResponse, bool, error) {
+	email = strings.TrimSpace(email)
+
+	var user models.User
+	created := false
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("LOWER(email) = ?", normalizeEmail(email)).First(&user).Error
+		if err == nil {
+			switch {
+			case !promote:
+				return ErrAdminUserExists
+			case password != "":
+				return ErrAdminPromotePassword
+			case user.EmailVerifiedAt == nil:
+				return ErrAdminPromoteUnverified
+			}
+
+			if _, err := setUserRole(tx, &user, string(models.UserRoleAdmin)); err != nil {
+				return err
+			}
+			if err := tx.Model(&models.User{}).Where("id = ?", user.ID).Update("is_active", true).Error; err != nil {
+				return err
+			}
+			user.IsActive = true
+
+			return bumpTokenVersion(tx, user.ID)
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		if len(password) < 8 {
+			return utils.NewValidationError("password_too_short", "password must be at least 8 characters")
+		}
+
+		hashedPassword, err := utils.HashPassword(password)
+		if err != nil {
+			return err
+		}
+
+		// อีเมลของ admin ที่สร้างจาก CLI ถือว่ายืนยันแล้ว
+		now := time.Now()
+		user = models.User{
+			Email:           email,
+			Password:        hashedPassword,
+			FirstName:       firstName,
+			LastName:        lastName,
+			Role:            models.UserRoleAdmin,
+			IsActive:        true,
+			EmailVerifiedAt: &now,
+			TokenVersion:    1,
+		}
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		created = true
+
+		return tx.Create(&models.Cart{UserID: user.ID}).Error
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	s.tokenVersions.Invalidate(user.ID)
+
+	response := toUserResponse(&user)
+	return &response, created, nil
+}
+
+// activeSessionCounts returns the number of live sessions per user
+func (s *AdminUserService) activeSessionCounts(ctx context.Context, users []models.User) (map[uint]int64, error) {
+	counts := make(map[uint]int64, len(users))
+	if len(users) == 0 {
+		return counts, nil
+	}
+
+	ids := make([]uint, len(users))
+	for i := range users {
+		ids[i] = users[i].ID
+	}
+
+	var rows []struct {
+		UserID   uint
+		Sessions int64
+	}
+	if err := s.db.WithContext(ctx).Model(&models.RefreshToken{}).
+		Select("user_id, COUNT(DISTINCT family_id) AS sessions").
+		Where("user_id IN ? AND expires_at > ?", ids, time.Now()).
+		Group("user_id").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	for _, row := range rows {
+		counts[row.UserID] = row.Sessions
+	}
+
+	return counts, nil
+}
+
+func toAdminUserResponse(user *models.User, sessions int64) dto.AdminUserResponse {
+	return dto.AdminUserResponse{
+		UserResponse:   toUserResponse(user),
+		CreatedAt:      user.CreatedAt.Format(defaultDateFormat),
+		ActiveSessions: sessions,
+	}
+}
@@ -0,0 +1,71 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/joefazee/learning-go-shop/internal/models"
+)
+
+func TestCreateAdmin(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing bool
+		verified bool
+		password string
+		promote  bool
+
+		wantErr     error
+		wantCreated bool
+	}{
+		{name: "new account", password: "correct horse battery", wantCreated: true},
+		{name: "existing user without promote", existing: true, verified: true, wantErr: ErrAdminUserExists},
+		{name: "promote verified user", existing: true, verified: true, promote: true},
+		{name: "promote unverified user", existing: true, promote: true, wantErr: ErrAdminPromoteUnverified},
+		{name: "promote with a password", existing: true, verified: true, password: "another password", promote: true, wantErr: ErrAdminPromotePassword},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			cfg := newTestConfig()
+			db.Create(&models.Role{Name: string(models.UserRoleAdmin)})
+			db.Create(&models.Role{Name: string(models.UserRoleCustomer)})
+
+			if tt.existing {
+				user := registerTestUser(t, newTestAuthService(t, db, cfg), "owner@example.com").User
+				if tt.verified {
+					db.Model(&models.User{}).Where("id = ?", user.ID).Update("email_verified_at", time.Now())
+				}
+			}
+
+			admins := NewAdminUserService(db, NewTokenVersionService(db, cfg.Auth.TokenVersionCacheTTL))
+			user, created, err := admins.CreateAdmin(context.Background(), "Owner@example.com", tt.password, "Admin", "User", tt.promote)
+
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("expected %v, got %v", tt.wantErr, err)
+				}
+
+				var role string
+				db.Model(&models.User{}).Select("role").Where("email = ?", "owner@example.com").Scan(&role)
+				if role == string(models.UserRoleAdmin) {
+					t.Error("the existing user must not be promoted")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("CreateAdmin: %v", err)
+			}
+			if created != tt.wantCreated {
+				t.Errorf("created = %v, want %v", created, tt.wantCreated)
+			}
+			if user.Role != string(models.UserRoleAdmin) {
+				t.Errorf("role %q, want admin", user.Role)
+			}
+		})
+	}
+}
@@ -0,0 +1,218 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/joefazee/learning-go-shop/internal/dto"
+	"github.com/joefazee/learning-go-shop/internal/models"
+	"github.com/joefazee/learning-go-shop/internal/utils"
+	"gorm.io/gorm"
+)
+
+const (
+	apiKeyPrefix   = "gsk_"
+	apiKeyIDLength = 12 // hex chars
+
+	// last_used_at is written at most this often per key
+	apiKeyTouchEvery = time.Minute
+)
+
+var (
+	ErrInvalidAPIKey     = utils.NewUnauthorizedError("invalid_api_key", "invalid or expired api key")
+	ErrAPIKeyScopeDenied = utils.NewForbiddenError("api_key_scope_denied", "api key scopes must be permissions you have yourself")
+)
+
+// APIKeyService issues and checks API keys. A key looks like
+// gsk_<prefix>_<secret>; the prefix finds the row and the secret is compared
+// by hash.
+type APIKeyService struct {
+	db    *gorm.DB
+	roles *RoleService
+}
+
+func NewAPIKeyService(db *gorm.DB, roles *RoleService) *APIKeyService {
+	return &APIKeyService{db: db, roles: roles}
+}
+
+// CreateAPIKey issues a key limited to scopes, which must all be granted to
+// the role of the user creating it
+func (s *APIKeyService) CreateAPIKey(ctx context.Context, creatorID uint, creatorRole string, req *dto.CreateAPIKeyRequest) (*dto.CreatedAPIKeyResponse, error) {
+	if _, err := findPermissions(s.db.WithContext(ctx), req.Scopes); err != nil {
+		return nil, err
+	}
+
+	allowed, err := s.roles.HasPermissions(ctx, creatorRole, req.Scopes...)
+	if err != nil {
+		return nil, err
+	}
+	if !allowed {
+		return nil, ErrAPIKeyScopeDenied
+	}
+
+	idBytes := make([]byte, apiKeyIDLength/2)
+	if _, err := rand.Read(idBytes); err != nil {
+		return nil, err
+	}
+	prefix := hex.EncodeToString(idBytes)
+
+	secret, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return nil, err
+	}
+
+	key := models.APIKey{
+		Name:        req.Name,
+		Prefix:      prefix,
+		SecretHash:  utils.HashToken(secret),
+		Scopes:      strings.Join(req.Scopes, " "),
+		CreatedByID: &creatorID,
+	}
+	if req.ExpiresInDays > 0 {
+		expiresAt := time.Now().Add(time.Duration(req.ExpiresInDays) * 24 * time.Hour)
+		key.ExpiresAt = &expiresAt
+	}
+
+	if err := s.db.WithContext(ctx).Create(&key).Error; err != nil {
+		return nil, err
+	}
+
+	return &dto.CreatedAPIKeyResponse{
+		APIKeyResponse: toAPIKeyResponse(&key),
+		Key:            apiKeyPrefix + prefix + "_" + secret,
+	}, nil
+}
+
+// Authenticate checks a raw key and records its use. It returns the scopes
+// the key may use now: the key acts for its creator, so a scope the creator
+// has lost stops working, and the key stops working altogether once the
+// creator is deactivated or deleted.
+func (s *APIKeyService) Authenticate(ctx context.Context, raw, ipAddress string) (*models.APIKey, []string, error) {
+	rest, ok := strings.CutPrefix(raw, apiKeyPrefix)
+	if !ok || len(rest) <= apiKeyIDLength+1 || rest[apiKeyIDLength] != '_' {
+		return nil, nil, ErrInvalidAPIKey
+	}
+	prefix, secret := rest[:apiKeyIDLength], rest[apiKeyIDLength+1:]
+
+	var key models.APIKey
+	if err := s.db.WithContext(ctx).Where("prefix = ?", prefix).First(&key).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrInvalidAPIKey
+		}
+		return nil, nil, err
+	}
+
+	if subtle.ConstantTimeCompare([]byte(utils.HashToken(secret)), []byte(key.SecretHash)) != 1 {
+		return nil, nil, ErrInvalidAPIKey
+	}
+
+	now := time.Now()
+	if !key.Active(now) {
+		return nil, nil, ErrInvalidAPIKey
+	}
+
+	scopes, err := s.creatorScopes(ctx, &key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// เขียน last_used ไม่เกินนาทีละครั้ง ไม่ให้ทุก request ต้อง write
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= apiKeyTouchEvery {
+		_ = s.db.WithContext(ctx).Model(&models.APIKey{}).Where("id = ?", key.ID).Updates(map[string]interface{}{
+			"last_used_at": now,
+			"last_used_ip": truncate(ipAddress, 45),
+		}).Error
+	}
+
+	return &key, scopes, nil
+}
+
+// creatorScopes returns the scopes of key that its creator's role still grants
+func (s *APIKeyService) creatorScopes(ctx context.Context, key *models.APIKey) ([]string, error) {
+	// creator ถูกลบแล้ว created_by_id จะเป็น NULL
+	if key.CreatedByID == nil {
+		return nil, ErrInvalidAPIKey
+	}
+
+	var creator models.User
+	if err := s.db.WithContext(ctx).Select("id", "role", "is_active").First(&creator, *key.CreatedByID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidAPIKey
+		}
+		return nil, err
+	}
+	if !creator.IsActive {
+		return nil, ErrInvalidAPIKey
+	}
+
+	var scopes []string
+	for _, scope := range key.ScopeList() {
+		allowed, err := s.roles.HasPermissions(ctx, string(creator.Role), scope)
+		if err != nil {
+			return nil, err
+		}
+		if allowed {
+			scopes = append(scopes, scope)
+		}
+	}
+
+	return scopes, nil
+}
+
+func (s *APIKeyService) ListAPIKeys(ctx context.Context) ([]dto.APIKeyResponse, error) {
+	var keys []models.APIKey
+	if err := s.db.WithContext(ctx).Order("created_at DESC").Find(&keys).Error; err != nil {
+		return nil, err
+	}
+
+	response := make([]dto.APIKeyResponse, len(keys))
+	for i := range keys {
+		response[i] = toAPIKeyResponse(&keys[i])
+	}
+
+	return response, nil
+}
+
+// RevokeAPIKey stops a key from working. Revoked keys stay listed for auditing.
+func (s *APIKeyService) RevokeAPIKey(ctx context.Context, id uint) error {
+	result := s.db.WithContext(ctx).Model(&models.APIKey{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func toAPIKeyResponse(key *models.APIKey) dto.APIKeyResponse {
+	return dto.APIKeyResponse{
+		ID:          key.ID,
+		Name:        key.Name,
+		Prefix:      apiKeyPrefix + key.Prefix,
+		Scopes:      key.ScopeList(),
+		CreatedByID: key.CreatedByID,
+		ExpiresAt:   formatOptionalTime(key.ExpiresAt),
+		LastUsedAt:  formatOptionalTime(key.LastUsedAt),
+		LastUsedIP:  key.LastUsedIP,
+		RevokedAt:   formatOptionalTime(key.RevokedAt),
+		CreatedAt:   key.CreatedAt.Format(defaultDateFormat),
+	}
+}
+
+func formatOptionalTime(t *time.Time) *string {
+	if t == nil {
+		return nil
+	}
+
+	formatted := t.Format(defaultDateFormat)
+	return &formatted
+}
@@ -0,0 +1,132 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/joefazee/learning-go-shop/internal/dto"
+	"github.com/joefazee/learning-go-shop/internal/models"
+	"gorm.io/gorm"
+)
+
+// newTestAPIKeyService seeds an admin role with two permissions and returns
+// an admin who can issue keys for both
+func newTestAPIKeyService(t *testing.T) (*APIKeyService, *RoleService, *gorm.DB, *models.User) {
+	t.Helper()
+
+	db := newTestDB(t)
+	cfg := newTestConfig()
+	auth := newTestAuthService(t, db, cfg)
+
+	catalog := models.Permission{Name: models.PermissionCatalogWrite}
+	orders := models.Permission{Name: models.PermissionOrdersManage}
+	admin := models.Role{Name: string(models.UserRoleAdmin), Permissions: []models.Permission{catalog, orders}}
+	if err := db.Create(&admin).Error; err != nil {
+		t.Fatalf("seed admin role: %v", err)
+	}
+	if err := db.Create(&models.Role{Name: string(models.UserRoleCustomer)}).Error; err != nil {
+		t.Fatalf("seed customer role: %v", err)
+	}
+
+	registered := registerTestUser(t, auth, "admin@example.com")
+	var user models.User
+	if err := db.First(&user, registered.User.ID).Error; err != nil {
+		t.Fatalf("load admin: %v", err)
+	}
+	if err := db.Model(&user).Update("role", models.UserRoleAdmin).Error; err != nil {
+		t.Fatalf("promote admin: %v", err)
+	}
+
+	roles := NewRoleService(db, NewTokenVersionService(db, cfg.Auth.TokenVersionCacheTTL), cfg.Auth.PermissionCacheTTL)
+	return NewAPIKeyService(db, roles), roles, db, &user
+}
+
+func createTestAPIKey(t *testing.T, keys *APIKeyService, creator *models.User, scopes ...string) string {
+	t.Helper()
+
+	created, err := keys.CreateAPIKey(context.Background(), creator.ID, string(creator.Role), &dto.CreateAPIKeyRequest{Name: "integration", Scopes: scopes})
+	if err != nil {
+		t.Fatalf("CreateAPIKey: %v", err)
+	}
+	return created.Key
+}
+
+func TestAPIKeyAuthenticateReturnsScopes(t *testing.T) {
+	keys, _, _, admin := newTestAPIKeyService(t)
+	raw := createTestAPIKey(t, keys, admin, models.PermissionCatalogWrite, models.PermissionOrdersManage)
+
+	_, scopes, err := keys.Authenticate(context.Background(), raw, "192.0.2.1")
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	if !slices.Equal(scopes, []string{models.PermissionCatalogWrite, models.PermissionOrdersManage}) {
+		t.Errorf("unexpected scopes %v", scopes)
+	}
+}
+
+func TestAPIKeyScopesFollowCreatorPermissions(t *testing.T) {
+	keys, roles, db, admin := newTestAPIKeyService(t)
+	raw := createTestAPIKey(t, keys, admin, models.PermissionCatalogWrite, models.PermissionOrdersManage)
+
+	// the admin role loses orders:manage after the key was issued
+	var orders models.Permission
+	db.Where("name = ?", models.PermissionOrdersManage).First(&orders)
+	var role models.Role
+	db.Where("name = ?", models.UserRoleAdmin).First(&role)
+	if err := db.Model(&role).Association("Permissions").Delete(&orders); err != nil {
+		t.Fatalf("remove permission: %v", err)
+	}
+	roles.invalidate()
+
+	_, scopes, err := keys.Authenticate(context.Background(), raw, "192.0.2.1")
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	if !slices.Equal(scopes, []string{models.PermissionCatalogWrite}) {
+		t.Errorf("expected only %s, got %v", models.PermissionCatalogWrite, scopes)
+	}
+
+	// demoted to customer, the creator has none of the scopes left
+	db.Model(admin).Update("role", models.UserRoleCustomer)
+
+	_, scopes, err = keys.Authenticate(context.Background(), raw, "192.0.2.1")
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	if len(scopes) != 0 {
+		t.Errorf("expected no scopes, got %v", scopes)
+	}
+}
+
+func TestAPIKeyRejectedWhenCreatorIsGone(t *testing.T) {
+	tests := []struct {
+		name   string
+		remove func(db *gorm.DB, user *models.User)
+	}{
+		{"deactivated", func(db *gorm.DB, user *models.User) {
+			db.Model(user).Update("is_active", false)
+		}},
+		{"soft deleted", func(db *gorm.DB, user *models.User) {
+			db.Delete(user)
+		}},
+		{"deleted", func(db *gorm.DB, user *models.User) {
+			// Postgres sets created_by_id to NULL when the user row goes
+			db.Model(&models.APIKey{}).Where("created_by_id = ?", user.ID).Update("created_by_id", nil)
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys, _, db, admin := newTestAPIKeyService(t)
+			raw := createTestAPIKey(t, keys, admin, models.PermissionCatalogWrite)
+
+			tt.remove(db, admin)
+
+			if _, _, err := keys.Authenticate(context.Background(), raw, "192.0.2.1"); !errors.Is(err, ErrInvalidAPIKey) {
+				t.Fatalf("expected ErrInvalidAPIKey, got %v", err)
+			}
+		})
+	}
+}
@@ -1,35 +1,57 @@
 package services
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"net/url"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/joefazee/learning-go-shop/internal/config"
 	"github.com/joefazee/learning-go-shop/internal/dto"
+	"github.com/joefazee/learning-go-shop/internal/interfaces"
 	"github.com/joefazee/learning-go-shop/internal/models"
 	"github.com/joefazee/learning-go-shop/internal/utils"
 	"gorm.io/gorm"
 )
 
+var (
+	ErrEmailExists         = utils.NewConflictError("email_exists", "email already exists")
+	ErrInvalidCredentials  = utils.NewUnauthorizedError("invalid_credentials", "invalid credentials")
+	ErrInvalidRefreshToken = utils.NewUnauthorizedError("invalid_refresh_token", "refresh token not found or expired")
+	ErrRefreshTokenReused  = utils.NewUnauthorizedError("refresh_token_reused", "refresh token reuse detected")
+)
+
 type AuthService struct {
 	db     *gorm.DB
 	config *config.Config
+	keys   *utils.KeySet
+	mailer interfaces.Mailer
+
+	tokenVersions *TokenVersionService
+	throttle      *LoginThrottleService
 }
 
-func NewAuthService(db *gorm.DB, cfg *config.Config) *AuthService {
+func NewAuthService(db *gorm.DB, cfg *config.Config, keys *utils.KeySet, mailer interfaces.Mailer, tokenVersions *TokenVersionService, throttle *LoginThrottleService) *AuthService {
 	return &AuthService{
 		db:     db,
 		config: cfg,
+		keys:   keys,
+		mailer: mailer,
+
+		tokenVersions: tokenVersions,
+		throttle:      throttle,
 	}
 }
 
-func (s *AuthService) Register(req *dto.RegisterRequest) (*dto.AuthResponse, error) {
+func (s *AuthService) Register(ctx context.Context, req *dto.RegisterRequest, client *dto.ClientInfo) (*dto.AuthResponse, error) {
 	// 1) เช็ค email ซ้ำ (ต้อง "ยอมรับ" ErrRecordNotFound)
 	var existing models.User
-	err := s.db.Where("email = ?", req.Email).First(&existing).Error
+	err := s.db.WithContext(ctx).Where("email = ?", req.Email).First(&existing).Error
 	if err == nil {
 		// เจอ user แล้ว => email ซ้ำ
-		return nil, errors.New("email already exists")
+		return nil, ErrEmailExists
 	}
 	if !errors.Is(err, gorm.ErrRecordNotFound) {
 		// error อื่น ๆ จาก DB
@@ -51,95 +73,442 @@ func (s *AuthService) Register(req *dto.RegisterRequest) (*dto.AuthResponse, err
 		Phone:     req.Phone,
 		Role:      models.UserRoleCustomer,
 		IsActive:  true,
+
+		TokenVersion: 1,
 	}
 
-	if err := s.db.Create(&user).Error; err != nil {
+	if err := s.db.WithContext(ctx).Create(&user).Error; err != nil {
 		return nil, err
 	}
 
 	// 4) Create cart (ถ้าพังให้ fail ไปเลยจะชัดกว่าเงียบ ๆ)
 	cart := models.Cart{UserID: user.ID}
-	if err := s.db.Create(&cart).Error; err != nil {
+	if err := s.db.WithContext(ctx).Create(&cart).Error; err != nil {
 		return nil, err
 	}
 
-	// 5) Generate token response
-	return s.generateAuthResponse(&user)
+	// 5) ส่งอีเมลยืนยัน (ส่งไม่สำเร็จไม่ทำให้สมัครล้ม ผู้ใช้ขอส่งใหม่ได้)
+	_ = s.sendVerificationEmail(ctx, s.db.WithContext(ctx), &user)
+
+	// 6) Generate token response
+	return s.generateAuthResponse(ctx, &user, newSessionState(false), client)
 }
 
-func (s *AuthService) Login(req *dto.LoginRequest) (*dto.AuthResponse, error) {
+func (s *AuthService) Login(ctx context.Context, req *dto.LoginRequest, client *dto.ClientInfo) (*dto.AuthResponse, error) {
+	// เช็คก่อนแตะรหัสผ่าน ระหว่างโดน backoff/lock ลองถูกก็ไม่ผ่าน
+	if err := s.throttle.Check(ctx, req.Email, client.IPAddress); err != nil {
+		return nil, err
+	}
+
 	var user models.User
-	if err := s.db.Where("email = ? AND is_active = ?", req.Email, true).First(&user).Error; err != nil {
-		return nil, errors.New("invalid credentials")
+	if err := s.db.WithContext(ctx).Where("email = ? AND is_active = ?", req.Email, true).First(&user).Error; err != nil {
+		// นับอีเมลที่ไม่มีในระบบด้วย ไม่ให้ใช้ความต่างเดาว่ามีบัญชีไหม
+		// ไม่ผูกกับการยกเลิก request ไม่งั้นตัดการเชื่อมต่อทิ้งก็หนีการนับได้
+		if err := s.throttle.RecordFailure(context.WithoutCancel(ctx), req.Email, client.IPAddress, nil); err != nil {
+			return nil, err
+		}
+		return nil, ErrInvalidCredentials
 	}
 
 	if !utils.CheckPassword(req.Password, user.Password) {
-		return nil, errors.New("invalid credentials")
+		if err := s.throttle.RecordFailure(context.WithoutCancel(ctx), req.Email, client.IPAddress, &user.ID); err != nil {
+			return nil, err
+		}
+		return nil, ErrInvalidCredentials
+	}
+
+	response, err := s.completeLogin(ctx, &user, client)
+	if err != nil {
+		// ยังไม่ reset ถ้ายังต้องผ่าน MFA ไม่งั้นรหัสผ่านที่รั่วจะล้างตัวนับให้เดา code ได้เรื่อย ๆ
+		return nil, err
+	}
+
+	if err := s.throttle.RecordSuccess(ctx, user.Email); err != nil {
+		return nil, err
+	}
+
+	return response, nil
+}
+
+// completeLogin issues tokens for a user who passed the first login step, or
+// an MFARequiredError when the account needs a second factor
+func (s *AuthService) completeLogin(ctx context.Context, user *models.User, client *dto.ClientInfo) (*dto.AuthResponse, error) {
+	if user.TwoFactorEnabled() {
+		mfaToken, err := utils.GenerateMFAChallengeToken(s.keys, user.ID, s.config.Auth.MFAChallengeExpires)
+		if err != nil {
+			return nil, err
+		}
+
+		return nil, &MFARequiredError{Challenge: dto.MFAChallengeResponse{
+			MFARequired: true,
+			MFAToken:    mfaToken,
+			ExpiresIn:   int(s.config.Auth.MFAChallengeExpires.Seconds()),
+		}}
+	}
+
+	return s.generateAuthResponse(ctx, user, newSessionState(false), client)
+}
+
+// LoginWithMFA completes a two-step login with a TOTP or recovery code
+func (s *AuthService) LoginWithMFA(ctx context.Context, req *dto.MFALoginRequest, client *dto.ClientInfo) (*dto.AuthResponse, error) {
+	claims, err := utils.ValidateMFAChallengeToken(req.MFAToken, s.keys)
+	if err != nil {
+		return nil, utils.NewUnauthorizedError("invalid_mfa_token", "invalid or expired mfa token")
+	}
+
+	var user models.User
+	if err := s.db.WithContext(ctx).Where("id = ? AND is_active = ?", claims.ChallengeUserID, true).First(&user).Error; err != nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	if !user.TwoFactorEnabled() {
+		return nil, ErrTwoFactorNotEnabled
+	}
+
+	if err := s.throttle.Check(ctx, user.Email, client.IPAddress); err != nil {
+		return nil, err
 	}
 
-	return s.generateAuthResponse(&user)
+	if err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return verifySecondFactor(tx, &user, req.Code)
+	}); err != nil {
+		if errors.Is(err, errInvalidSecondFactor) {
+			if err := s.throttle.RecordFailure(context.WithoutCancel(ctx), user.Email, client.IPAddress, &user.ID); err != nil {
+				return nil, err
+			}
+		}
+		return nil, err
+	}
+
+	if err := s.throttle.RecordSuccess(ctx, user.Email); err != nil {
+		return nil, err
+	}
+
+	return s.generateAuthResponse(ctx, &user, newSessionState(true), client)
+}
+
+// MFARequiredError is returned by Login when the password was correct but
+// the account needs a second factor
+type MFARequiredError struct {
+	Challenge dto.MFAChallengeResponse
 }
 
-func (s *AuthService) RefreshToken(req *dto.RefreshTokenRequest) (*dto.AuthResponse, error) {
-	claims, err := utils.ValidateToken(req.RefreshToken, s.config.JWT.Secret)
+func (e *MFARequiredError) Error() string {
+	return "two-factor authentication required"
+}
+
+func (s *AuthService) RefreshToken(ctx context.Context, req *dto.RefreshTokenRequest, client *dto.ClientInfo) (*dto.AuthResponse, error) {
+	if _, err := utils.ValidateAccessToken(req.RefreshToken, s.keys, &s.config.JWT); err == nil {
+		return nil, utils.NewUnauthorizedError("invalid_refresh_token", "access token cannot be used as a refresh token")
+	}
+
+	refreshToken, err := s.findRefreshToken(s.db.WithContext(ctx).Unscoped(), req.RefreshToken)
 	if err != nil {
-		return nil, errors.New("invalid refresh token")
+		return nil, ErrInvalidRefreshToken
 	}
 
-	var refreshToken models.RefreshToken
-	if err := s.db.
-		Where("token = ? AND expires_at > ?", req.RefreshToken, time.Now()).
-		First(&refreshToken).Error; err != nil {
-		return nil, errors.New("refresh token not found or expired")
+	// token ที่ rotate ไปแล้วถูกส่งมาอีก => น่าจะถูกขโมย ปิดทั้ง session
+	// ใช้ context ที่ cancel ไม่ได้ ไม่ให้คนส่งตัดการเชื่อมต่อเพื่อหยุดการ revoke
+	revokeCtx := context.WithoutCancel(ctx)
+	if refreshToken.RotatedAt != nil {
+		_ = revokeSession(s.db.WithContext(revokeCtx), refreshToken.UserID, refreshToken.FamilyID)
+		return nil, ErrRefreshTokenReused
+	}
+
+	if refreshToken.DeletedAt.Valid || !refreshToken.ExpiresAt.After(time.Now()) {
+		return nil, ErrInvalidRefreshToken
 	}
 
 	var user models.User
-	if err := s.db.Where("id = ? AND is_active = ?", claims.UserID, true).First(&user).Error; err != nil {
-		return nil, errors.New("user not found")
+	if err := s.db.WithContext(ctx).Where("id = ? AND is_active = ?", refreshToken.UserID, true).First(&user).Error; err != nil {
+		return nil, utils.NewUnauthorizedError("user_not_found", "user not found")
 	}
 
-	// rotate token: ลบของเก่า
-	_ = s.db.Delete(&refreshToken).Error
+	// rotate token: ปิดของเก่า (เงื่อนไข rotated_at IS NULL กันสอง request ใช้ token เดียวกันพร้อมกัน)
+	now := time.Now()
+	result := s.db.WithContext(ctx).Model(&models.RefreshToken{}).
+		Where("id = ? AND rotated_at IS NULL", refreshToken.ID).
+		Updates(map[string]interface{}{"rotated_at": now, "deleted_at": now})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		_ = revokeSession(s.db.WithContext(revokeCtx), refreshToken.UserID, refreshToken.FamilyID)
+		return nil, ErrRefreshTokenReused
+	}
 
-	return s.generateAuthResponse(&user)
+	session := sessionState{
+		FamilyID:  refreshToken.FamilyID,
+		CreatedAt: refreshToken.SessionCreatedAt,
+		MFA:       refreshToken.MFA,
+		Refreshed: true,
+	}
+
+	return s.generateAuthResponse(ctx, &user, session, client)
 }
 
-func (s *AuthService) Logout(refreshToken string) error {
-	return s.db.Where("token = ?", refreshToken).Delete(&models.RefreshToken{}).Error
+// Logout ends the session the refresh token belongs to
+func (s *AuthService) Logout(ctx context.Context, refreshToken string) error {
+	token, err := s.findRefreshToken(s.db.WithContext(ctx), refreshToken)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	return revokeSession(s.db.WithContext(ctx), token.UserID, token.FamilyID)
 }
 
-func (s *AuthService) generateAuthResponse(user *models.User) (*dto.AuthResponse, error) {
-	accessToken, refreshToken, err := utils.GenerateTokenPair(
-		&s.config.JWT,
-		user.ID,
-		user.Email,
-		string(user.Role),
-	)
+// findRefreshToken looks a refresh token up by its hash. During the dual-read
+// period it falls back to the raw token column, which only rows written by
+// the previous release still fill in.
+func (s *AuthService) findRefreshToken(db *gorm.DB, raw string) (*models.RefreshToken, error) {
+	// แยก session ไม่ให้เงื่อนไข token_hash ติดไปกับ query ที่สอง
+	db = db.Session(&gorm.Session{})
+
+	var token models.RefreshToken
+	err := db.Where("token_hash = ?", utils.HashToken(raw)).First(&token).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		err = db.Where("token = ?", raw).First(&token).Error
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	refreshTokenModel := models.RefreshToken{
+	return &token, nil
+}
+
+// VerifyEmail consumes a verification token and marks the email as verified
+func (s *AuthService) VerifyEmail(ctx context.Context, token string) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var verification models.EmailVerificationToken
+		if err := tx.Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", utils.HashToken(token), time.Now()).
+			First(&verification).Error; err != nil {
+			return utils.NewValidationError("invalid_verification_token", "invalid or expired verification token")
+		}
+
+		now := time.Now()
+
+		// single-use: ปิด token ทั้งหมดของ user นี้
+		if err := tx.Model(&models.EmailVerificationToken{}).
+			Where("user_id = ? AND used_at IS NULL", verification.UserID).
+			Update("used_at", now).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(&models.User{}).
+			Where("id = ? AND email_verified_at IS NULL", verification.UserID).
+			Update("email_verified_at", now).Error
+	})
+}
+
+// ResendVerification issues a new verification email. Unknown or already
+// verified addresses are ignored so the endpoint cannot be used to probe accounts.
+func (s *AuthService) ResendVerification(ctx context.Context, email string) error {
+	var user models.User
+	err := s.db.WithContext(ctx).Where("email = ? AND is_active = ? AND email_verified_at IS NULL", email, true).First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.EmailVerificationToken{}).
+			Where("user_id = ? AND used_at IS NULL", user.ID).
+			Update("used_at", time.Now()).Error; err != nil {
+			return err
+		}
+
+		return s.sendVerificationEmail(ctx, tx, &user)
+	})
+}
+
+// ForgotPassword emails a single-use reset link. Unknown addresses are
+// ignored so the endpoint cannot be used to probe accounts.
+func (s *AuthService) ForgotPassword(ctx context.Context, email string) error {
+	var user models.User
+	err := s.db.WithContext(ctx).Where("email = ? AND is_active = ?", email, true).First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	token, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return err
+	}
+
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// ลิงก์เก่าที่ยังไม่ได้ใช้ใช้ไม่ได้อีก
+		if err := tx.Model(&models.PasswordResetToken{}).
+			Where("user_id = ? AND used_at IS NULL", user.ID).
+			Update("used_at", time.Now()).Error; err != nil {
+			return err
+		}
+
+		return tx.Create(&models.PasswordResetToken{
+			UserID:    user.ID,
+			TokenHash: utils.HashToken(token),
+			ExpiresAt: time.Now().Add(s.config.Auth.PasswordResetExpires),
+		}).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/reset-password?token=%s", s.config.Server.FrontendURL, url.QueryEscape(token))
+
+	return s.mailer.Send(ctx, &interfaces.MailMessage{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nWe received a request to reset your password. Open the link below to choose a new one:\n\n%s\n\nThe link expires in %s. If you did not ask for this, you can ignore this email.\n",
+			user.FirstName, link, s.config.Auth.PasswordResetExpires,
+		),
+	})
+}
+
+// ResetPassword sets a new password using a reset token and signs the user
+// out everywhere
+func (s *AuthService) ResetPassword(ctx context.Context, req *dto.ResetPasswordRequest) error {
+	hashedPassword, err := utils.HashPassword(req.NewPassword)
+	if err != nil {
+		return err
+	}
+
+	var userID uint
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var reset models.PasswordResetToken
+		if err := tx.Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", utils.HashToken(req.Token), time.Now()).
+			First(&reset).Error; err != nil {
+			return utils.NewValidationError("invalid_reset_token", "invalid or expired reset token")
+		}
+
+		if err := tx.Model(&models.PasswordResetToken{}).
+			Where("user_id = ? AND used_at IS NULL", reset.UserID).
+			Update("used_at", time.Now()).Error; err != nil {
+			return err
+		}
+
+		userID = reset.UserID
+		return updatePassword(tx, reset.UserID, hashedPassword)
+	})
+	if err != nil {
+		return err
+	}
+
+	s.tokenVersions.Invalidate(userID)
+	return nil
+}
+
+func (s *AuthService) sendVerificationEmail(ctx context.Context, tx *gorm.DB, user *models.User) error {
+	token, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return err
+	}
+
+	verification := models.EmailVerificationToken{
 		UserID:    user.ID,
-		Token:     refreshToken,
-		ExpiresAt: time.Now().Add(s.config.JWT.RefreshTokenExpires),
+		TokenHash: utils.HashToken(token),
+		ExpiresAt: time.Now().Add(s.config.Auth.EmailVerificationExpires),
 	}
+	if err := tx.Create(&verification).Error; err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/verify-email?token=%s", s.config.Server.FrontendURL, url.QueryEscape(token))
+
+	return s.mailer.Send(ctx, &interfaces.MailMessage{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nPlease confirm your email address by opening the link below:\n\n%s\n\nThe link expires in %s.\n",
+			user.FirstName, link, s.config.Auth.EmailVerificationExpires,
+		),
+	})
+}
+
+// sessionState is what a refresh token carries over from the previous token
+// of the same session
+type sessionState struct {
+	FamilyID  string
+	CreatedAt time.Time
+	MFA       bool
+	Refreshed bool
+}
 
-	if err := s.db.Create(&refreshTokenModel).Error; err != nil {
+func newSessionState(mfa bool) sessionState {
+	return sessionState{
+		FamilyID:  uuid.NewString(),
+		CreatedAt: time.Now(),
+		MFA:       mfa,
+	}
+}
+
+func (s *AuthService) generateAuthResponse(ctx context.Context, user *models.User, session sessionState, client *dto.ClientInfo) (*dto.AuthResponse, error) {
+	accessToken, refreshToken, err := utils.GenerateTokenPair(s.keys, &s.config.JWT, &utils.TokenSubject{
+		UserID:    user.ID,
+		Email:     user.Email,
+		Role:      string(user.Role),
+		MFA:       session.MFA,
+		SessionID: session.FamilyID,
+
+		TokenVersion: user.TokenVersion,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	refreshTokenModel := models.RefreshToken{
+		UserID:           user.ID,
+		TokenHash:        utils.HashToken(refreshToken),
+		ExpiresAt:        time.Now().Add(s.config.JWT.RefreshTokenExpires),
+		FamilyID:         session.FamilyID,
+		SessionCreatedAt: session.CreatedAt,
+		MFA:              session.MFA,
+	}
+
+	if client != nil {
+		refreshTokenModel.UserAgent = truncate(client.UserAgent, 512)
+		refreshTokenModel.IPAddress = client.IPAddress
+	}
+
+	if session.Refreshed {
+		now := time.Now()
+		refreshTokenModel.LastUsedAt = &now
+	}
+
+	if err := s.db.WithContext(ctx).Create(&refreshTokenModel).Error; err != nil {
 		return nil, err
 	}
 
 	return &dto.AuthResponse{
-		User: dto.UserResponse{
-			ID:        user.ID,
-			Email:     user.Email,
-			FirstName: user.FirstName,
-			LastName:  user.LastName,
-			Phone:     user.Phone,
-			Role:      string(user.Role),
-			IsActive:  user.IsActive,
-		},
+		User:         toUserResponse(user),
 		AccessToken:  accessToken,
 		RefreshToken: refreshToken,
 	}, nil
 }
+
+// updatePassword stores a new password hash and revokes every access and
+// refresh token of the user
+func updatePassword(tx *gorm.DB, userID uint, hashedPassword string) error {
+	if err := tx.Model(&models.User{}).Where("id = ?", userID).Update("password", hashedPassword).Error; err != nil {
+		return err
+	}
+
+	if err := bumpTokenVersion(tx, userID); err != nil {
+		return err
+	}
+
+	return revokeRefreshTokens(tx, userID)
+}
+
+// revokeRefreshTokens signs the user out of every session
+func revokeRefreshTokens(tx *gorm.DB, userID uint) error {
+	return tx.Where("user_id = ?", userID).Delete(&models.RefreshToken{}).Error
+}
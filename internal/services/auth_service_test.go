@@ -0,0 +1,174 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/joefazee/learning-go-shop/internal/dto"
+	"github.com/joefazee/learning-go-shop/internal/models"
+	"github.com/joefazee/learning-go-shop/internal/utils"
+)
+
+var testClient = &dto.ClientInfo{UserAgent: "go-test", IPAddress: "192.0.2.1"}
+
+func refresh(auth *AuthService, token string) (*dto.AuthResponse, error) {
+	return auth.RefreshToken(context.Background(), &dto.RefreshTokenRequest{RefreshToken: token}, testClient)
+}
+
+func TestRefreshTokenRotates(t *testing.T) {
+	db := newTestDB(t)
+	auth := newTestAuthService(t, db, newTestConfig())
+	registered := registerTestUser(t, auth, "rotate@example.com")
+
+	rotated, err := refresh(auth, registered.RefreshToken)
+	if err != nil {
+		t.Fatalf("RefreshToken: %v", err)
+	}
+	if rotated.RefreshToken == registered.RefreshToken {
+		t.Error("refresh token was not rotated")
+	}
+	if _, err := refresh(auth, rotated.RefreshToken); err != nil {
+		t.Errorf("rotated token rejected: %v", err)
+	}
+}
+
+func TestRefreshTokenRejectsAccessToken(t *testing.T) {
+	db := newTestDB(t)
+	auth := newTestAuthService(t, db, newTestConfig())
+	registered := registerTestUser(t, auth, "access@example.com")
+
+	_, err := refresh(auth, registered.AccessToken)
+
+	var appErr *utils.AppError
+	if !errors.As(err, &appErr) || appErr.Code != "invalid_refresh_token" {
+		t.Fatalf("expected invalid_refresh_token, got %v", err)
+	}
+}
+
+func TestRefreshTokenReuseRevokesSession(t *testing.T) {
+	db := newTestDB(t)
+	auth := newTestAuthService(t, db, newTestConfig())
+	registered := registerTestUser(t, auth, "reuse@example.com")
+
+	rotated, err := refresh(auth, registered.RefreshToken)
+	if err != nil {
+		t.Fatalf("RefreshToken: %v", err)
+	}
+
+	// the old token comes back: someone else holds a copy of it
+	if _, err := refresh(auth, registered.RefreshToken); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("expected ErrRefreshTokenReused, got %v", err)
+	}
+
+	// the whole session is gone, including the legitimate rotated token
+	if _, err := refresh(auth, rotated.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Fatalf("expected rotated token to be revoked, got %v", err)
+	}
+}
+
+func TestRefreshTokenRejectsRevokedSession(t *testing.T) {
+	db := newTestDB(t)
+	auth := newTestAuthService(t, db, newTestConfig())
+	registered := registerTestUser(t, auth, "logout@example.com")
+
+	if err := auth.Logout(context.Background(), registered.RefreshToken); err != nil {
+		t.Fatalf("Logout: %v", err)
+	}
+
+	if _, err := refresh(auth, registered.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Fatalf("expected ErrInvalidRefreshToken, got %v", err)
+	}
+}
+
+func TestRefreshTokenRejectsExpiredToken(t *testing.T) {
+	db := newTestDB(t)
+	auth := newTestAuthService(t, db, newTestConfig())
+	registered := registerTestUser(t, auth, "expired@example.com")
+
+	if err := db.Model(&models.RefreshToken{}).
+		Where("token_hash = ?", utils.HashToken(registered.RefreshToken)).
+		Update("expires_at", time.Now().Add(-time.Minute)).Error; err != nil {
+		t.Fatalf("expire token: %v", err)
+	}
+
+	if _, err := refresh(auth, registered.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Fatalf("expected ErrInvalidRefreshToken, got %v", err)
+	}
+}
+
+func TestSessionOfAnotherUserIsRejected(t *testing.T) {
+	db := newTestDB(t)
+	cfg := newTestConfig()
+	auth := newTestAuthService(t, db, cfg)
+	sessions := NewSessionService(db, cfg.Auth.TokenVersionCacheTTL)
+
+	victim := registerTestUser(t, auth, "victim@example.com")
+	attacker := registerTestUser(t, auth, "attacker@example.com")
+
+	victimClaims, err := utils.ValidateAccessToken(victim.AccessToken, auth.keys, &cfg.JWT)
+	if err != nil {
+		t.Fatalf("ValidateAccessToken: %v", err)
+	}
+	ctx := context.Background()
+
+	// an access token only counts for the user its session belongs to
+	if err := sessions.CheckSession(ctx, attacker.User.ID, victimClaims.SessionID); !errors.Is(err, ErrSessionRevoked) {
+		t.Fatalf("expected ErrSessionRevoked, got %v", err)
+	}
+
+	// and another user cannot sign the victim's session out
+	var appErr *utils.AppError
+	err = sessions.RevokeSession(ctx, attacker.User.ID, victimClaims.SessionID)
+	if !errors.As(err, &appErr) || appErr.Code != "session_not_found" {
+		t.Fatalf("expected session_not_found, got %v", err)
+	}
+	if err := sessions.CheckSession(ctx, victim.User.ID, victimClaims.SessionID); err != nil {
+		t.Fatalf("victim session should still be active: %v", err)
+	}
+	if _, err := refresh(auth, victim.RefreshToken); err != nil {
+		t.Fatalf("victim refresh token should still work: %v", err)
+	}
+}
+
+func TestRevokedSessionRejectsAccessToken(t *testing.T) {
+	db := newTestDB(t)
+	cfg := newTestConfig()
+	auth := newTestAuthService(t, db, cfg)
+	sessions := NewSessionService(db, cfg.Auth.TokenVersionCacheTTL)
+
+	registered := registerTestUser(t, auth, "revoked@example.com")
+	claims, err := utils.ValidateAccessToken(registered.AccessToken, auth.keys, &cfg.JWT)
+	if err != nil {
+		t.Fatalf("ValidateAccessToken: %v", err)
+	}
+	ctx := context.Background()
+
+	if err := sessions.CheckSession(ctx, claims.UserID, claims.SessionID); err != nil {
+		t.Fatalf("CheckSession before revoke: %v", err)
+	}
+	if err := sessions.RevokeSession(ctx, claims.UserID, claims.SessionID); err != nil {
+		t.Fatalf("RevokeSession: %v", err)
+	}
+	if err := sessions.CheckSession(ctx, claims.UserID, claims.SessionID); !errors.Is(err, ErrSessionRevoked) {
+		t.Fatalf("expected ErrSessionRevoked after revoke, got %v", err)
+	}
+}
+
+func TestRefreshTokenAcceptsLegacyRawToken(t *testing.T) {
+	db := newTestDB(t)
+	auth := newTestAuthService(t, db, newTestConfig())
+	registered := registerTestUser(t, auth, "legacy@example.com")
+
+	// a row written by the previous release: raw token only, no hash
+	if err := db.Model(&models.RefreshToken{}).
+		Where("token_hash = ?", utils.HashToken(registered.RefreshToken)).
+		Updates(map[string]any{"token": registered.RefreshToken, "token_hash": nil}).Error; err != nil {
+		t.Fatalf("store legacy token: %v", err)
+	}
+
+	if _, err := refresh(auth, registered.RefreshToken); err != nil {
+		t.Fatalf("legacy token rejected: %v", err)
+	}
+}
@@ -1,13 +1,21 @@
 package services
 
 import (
-	"errors"
+	"context"
+	"time"
 
 	"github.com/joefazee/learning-go-shop/internal/dto"
 	"github.com/joefazee/learning-go-shop/internal/models"
+	"github.com/joefazee/learning-go-shop/internal/utils"
 	"gorm.io/gorm"
 )
 
+var (
+	ErrProductNotFound   = utils.NewNotFoundError("product_not_found", "product not found")
+	ErrCartNotFound      = utils.NewNotFoundError("cart_not_found", "cart not found")
+	ErrInsufficientStock = utils.NewInsufficientStockError("insufficient stock")
+)
+
 type CartService struct {
 	db *gorm.DB
 }
@@ -16,9 +24,9 @@ func NewCartService(db *gorm.DB) *CartService {
 	return &CartService{db: db}
 }
 
-func (s *CartService) GetCart(userID uint) (*dto.CartResponse, error) {
+func (s *CartService) GetCart(ctx context.Context, userID uint) (*dto.CartResponse, error) {
 	var cart models.Cart
-	err := s.db.Preload("CartItems.Product.Category").
+	err := s.db.WithContext(ctx).Preload("CartItems.Product.Category").
 		Where("user_id = ?", userID).First(&cart).Error
 	if err != nil {
 		return nil, err
@@ -27,88 +35,159 @@ func (s *CartService) GetCart(userID uint) (*dto.CartResponse, error) {
 	return s.convertToCartResponse(&cart), nil
 }
 
-func (s *CartService) AddToCart(userID uint, req *dto.AddToCartRequest) (*dto.CartResponse, error) {
+func (s *CartService) AddToCart(ctx context.Context, userID uint, req *dto.AddToCartRequest) (*dto.CartResponse, error) {
 
 	// Check if product exists
 	var product models.Product
-	if err := s.db.First(&product, req.ProductID).Error; err != nil {
-		return nil, errors.New("product not found")
+	if err := s.db.WithContext(ctx).Where("id = ? AND is_active = ?", req.ProductID, true).First(&product).Error; err != nil {
+		return nil, ErrProductNotFound
 	}
 
 	if product.Stock < req.Quantity {
-		return nil, errors.New("insufficient stock")
+		return nil, ErrInsufficientStock
 	}
 
 	// Get or create cart
 	var cart models.Cart
-	if err := s.db.Where("user_id = ?", userID).First(&cart).Error; err != nil {
+	if err := s.db.WithContext(ctx).Where("user_id = ?", userID).First(&cart).Error; err != nil {
 		cart = models.Cart{UserID: userID}
-		if err := s.db.Create(&cart).Error; err != nil {
+		if err := s.db.WithContext(ctx).Create(&cart).Error; err != nil {
 			return nil, err
 		}
 	}
 
 	// Check if item already exists in cart
 	var cartItem models.CartItem
-	if err := s.db.Where("cart_id = ? AND product_id = ?", cart.ID, req.ProductID).First(&cartItem).Error; err != nil {
+	if err := s.db.WithContext(ctx).Where("cart_id = ? AND product_id = ?", cart.ID, req.ProductID).First(&cartItem).Error; err != nil {
 		// Create new cart item
 		cartItem = models.CartItem{
 			CartID:    cart.ID,
 			ProductID: req.ProductID,
 			Quantity:  req.Quantity,
+			Price:     product.Price,
 		}
-		s.db.Create(&cartItem)
+		s.db.WithContext(ctx).Create(&cartItem)
 	} else {
 		// Update existing cart item
 		cartItem.Quantity += req.Quantity
 		if cartItem.Quantity > product.Stock {
-			return nil, errors.New("insufficient stock")
+			return nil, ErrInsufficientStock
 		}
-		s.db.Save(&cartItem)
+		// ผู้ใช้เห็นราคาปัจจุบันตอนกดเพิ่ม
+		cartItem.Price = product.Price
+		s.db.WithContext(ctx).Save(&cartItem)
+	}
+
+	if err := s.touchCart(ctx, cart.ID); err != nil {
+		return nil, err
 	}
 
-	return s.GetCart(userID)
+	return s.GetCart(ctx, userID)
 }
 
-func (s *CartService) UpdateCartItem(userID, itemID uint, req *dto.UpdateCartItemRequest) (*dto.CartResponse, error) {
+func (s *CartService) UpdateCartItem(ctx context.Context, userID, itemID uint, req *dto.UpdateCartItemRequest) (*dto.CartResponse, error) {
 	var cartItem models.CartItem
-	if err := s.db.Joins("JOIN carts ON cart_items.cart_id = carts.id").
+	if err := s.db.WithContext(ctx).Joins("JOIN carts ON cart_items.cart_id = carts.id").
 		Where("cart_items.id = ? AND carts.user_id = ?", itemID, userID).
 		First(&cartItem).Error; err != nil {
-		return nil, errors.New("cart item not found")
+		return nil, utils.NewNotFoundError("cart_item_not_found", "cart item not found")
 	}
 
 	var product models.Product
-	if err := s.db.First(&product, cartItem.ProductID).Error; err != nil {
-		return nil, errors.New("product not found")
+	if err := s.db.WithContext(ctx).First(&product, cartItem.ProductID).Error; err != nil {
+		return nil, ErrProductNotFound
 	}
 
 	if product.Stock < req.Quantity {
-		return nil, errors.New("insufficient stock")
+		return nil, ErrInsufficientStock
 	}
 
 	cartItem.Quantity = req.Quantity
-	if err := s.db.Save(&cartItem).Error; err != nil {
+	if err := s.db.WithContext(ctx).Save(&cartItem).Error; err != nil {
+		return nil, err
+	}
+
+	if err := s.touchCart(ctx, cartItem.CartID); err != nil {
 		return nil, err
 	}
 
-	return s.GetCart(userID)
+	return s.GetCart(ctx, userID)
 }
 
-func (s *CartService) RemoveFromCart(userID, itemID uint) error {
-	return s.db.Where("id = ? AND cart_id IN (?)", itemID,
+func (s *CartService) RemoveFromCart(ctx context.Context, userID, itemID uint) error {
+	if err := s.db.WithContext(ctx).Where("id = ? AND cart_id IN (?)", itemID,
 		s.db.Select("id").Table("carts").
 			Where("user_id = ?", userID)).
-		Delete(&models.CartItem{}).Error
+		Delete(&models.CartItem{}).Error; err != nil {
+		return err
+	}
+
+	return s.db.WithContext(ctx).Model(&models.Cart{}).Where("user_id = ?", userID).Update("updated_at", time.Now()).Error
+}
+
+// AcknowledgeCartChanges applies every pending cart warning: prices are
+// updated to the current ones, unavailable lines are removed and quantities
+// are reduced to the available stock
+func (s *CartService) AcknowledgeCartChanges(ctx context.Context, userID uint) (*dto.CartResponse, error) {
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var cart models.Cart
+		if err := tx.Preload("CartItems.Product").Where("user_id = ?", userID).First(&cart).Error; err != nil {
+			return ErrCartNotFound
+		}
+
+		for i := range cart.CartItems {
+			item := &cart.CartItems[i]
+			warnings := cartItemWarnings(item)
+			if len(warnings) == 0 {
+				continue
+			}
+
+			if warnings[0].Type == dto.CartWarningUnavailable {
+				if err := tx.Unscoped().Delete(&models.CartItem{}, item.ID).Error; err != nil {
+					return err
+				}
+				continue
+			}
+
+			item.Price = item.Product.Price
+			if item.Quantity > item.Product.Stock {
+				item.Quantity = item.Product.Stock
+			}
+
+			if err := tx.Model(&models.CartItem{}).Where("id = ?", item.ID).
+				Updates(map[string]interface{}{"price": item.Price, "quantity": item.Quantity}).Error; err != nil {
+				return err
+			}
+		}
+
+		return tx.Model(&models.Cart{}).Where("id = ?", cart.ID).Update("updated_at", time.Now()).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetCart(ctx, userID)
+}
+
+// touchCart bumps carts.updated_at, which abandoned cart detection relies on
+func (s *CartService) touchCart(ctx context.Context, cartID uint) error {
+	return s.db.WithContext(ctx).Model(&models.Cart{}).Where("id = ?", cartID).Update("updated_at", time.Now()).Error
 }
 
 func (s *CartService) convertToCartResponse(cart *models.Cart) *dto.CartResponse {
 
 	cartItems := make([]dto.CartItemResponse, len(cart.CartItems)) // memory allocation
 	var total float64
+	var hasWarnings bool
 
 	for i := range cart.CartItems {
+		warnings := cartItemWarnings(&cart.CartItems[i])
+		hasWarnings = hasWarnings || len(warnings) > 0
+
 		subtotal := float64(cart.CartItems[i].Quantity) * cart.CartItems[i].Product.Price
+		if len(warnings) > 0 && warnings[0].Type == dto.CartWarningUnavailable {
+			subtotal = 0
+		}
 		total += subtotal
 
 		cartItems[i] = dto.CartItemResponse{
@@ -130,14 +209,77 @@ func (s *CartService) convertToCartResponse(cart *models.Cart) *dto.CartResponse
 				},
 			},
 			Quantity: cart.CartItems[i].Quantity,
+			Price:    cart.CartItems[i].Price,
 			Subtotal: subtotal,
+			Warnings: warnings,
 		}
 	}
 
 	return &dto.CartResponse{
-		ID:        cart.ID,
-		UserID:    cart.UserID,
-		CartItems: cartItems,
-		Total:     total,
+		ID:          cart.ID,
+		UserID:      cart.UserID,
+		CartItems:   cartItems,
+		Total:       total,
+		HasWarnings: hasWarnings,
+	}
+}
+
+// CartChangedError is returned when a cart has changes the client has not
+// acknowledged yet
+type CartChangedError struct {
+	Changes []dto.CartChangesResponse
+}
+
+func (e *CartChangedError) Error() string {
+	return "cart has changed, review and acknowledge the changes before checkout"
+}
+
+// cartChanges collects the warnings of every line in the cart
+func cartChanges(cart *models.Cart) []dto.CartChangesResponse {
+	var changes []dto.CartChangesResponse
+	for i := range cart.CartItems {
+		warnings := cartItemWarnings(&cart.CartItems[i])
+		if len(warnings) == 0 {
+			continue
+		}
+
+		changes = append(changes, dto.CartChangesResponse{
+			CartItemID: cart.CartItems[i].ID,
+			ProductID:  cart.CartItems[i].ProductID,
+			Warnings:   warnings,
+		})
+	}
+
+	return changes
+}
+
+// cartItemWarnings compares a cart line with the current state of its product.
+// An unavailable product yields a single unavailable warning.
+func cartItemWarnings(item *models.CartItem) []dto.CartItemWarning {
+	warnings := []dto.CartItemWarning{}
+
+	product := &item.Product
+	if product.ID == 0 || !product.IsActive || product.Stock <= 0 {
+		return append(warnings, dto.CartItemWarning{Type: dto.CartWarningUnavailable})
 	}
-}
\ No newline at end of file
+
+	if product.Price != item.Price {
+		oldPrice, newPrice := item.Price, product.Price
+		warnings = append(warnings, dto.CartItemWarning{
+			Type:     dto.CartWarningPriceChanged,
+			OldPrice: &oldPrice,
+			NewPrice: &newPrice,
+		})
+	}
+
+	if product.Stock < item.Quantity {
+		requested, available := item.Quantity, product.Stock
+		warnings = append(warnings, dto.CartItemWarning{
+			Type:              dto.CartWarningQuantityReduced,
+			RequestedQuantity: &requested,
+			AvailableQuantity: &available,
+		})
+	}
+
+	return warnings
+}
@@ -0,0 +1,165 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/joefazee/learning-go-shop/internal/dto"
+	"github.com/joefazee/learning-go-shop/internal/interfaces"
+	"github.com/joefazee/learning-go-shop/internal/logger"
+	"gorm.io/gorm"
+)
+
+const (
+	// each dependency gets this long before it counts as down
+	healthCheckTimeout = 2 * time.Second
+
+	// the readiness endpoint is public; probes within this window share one
+	// run of the checks so it cannot be used to hammer the dependencies
+	healthCacheTTL = 5 * time.Second
+)
+
+// HealthService checks the dependencies the API needs to serve traffic
+type HealthService struct {
+	db      *gorm.DB
+	uploads interfaces.UploadProvider
+
+	// migrationVersion is the schema version this build expects, 0 if unknown
+	migrationVersion uint
+
+	mu        sync.Mutex
+	last      *dto.HealthResponse
+	checkedAt time.Time
+}
+
+func NewHealthService(db *gorm.DB, uploads interfaces.UploadProvider, migrationVersion uint) *HealthService {
+	return &HealthService{db: db, uploads: uploads, migrationVersion: migrationVersion}
+}
+
+type healthCheck func(ctx context.Context) (details string, err error)
+
+// Ready runs every check concurrently. The status is ok only when all of
+// them pass. Results are reused for healthCacheTTL; the returned response is
+// shared and must not be modified.
+func (s *HealthService) Ready(ctx context.Context) *dto.HealthResponse {
+	// ถือ lock ระหว่างเช็ค probe ที่มาพร้อมกันจะรอใช้ผลเดียวกัน
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.last != nil && time.Since(s.checkedAt) < healthCacheTTL {
+		return s.last
+	}
+
+	// ผลถูกแชร์กับ probe อื่น ไม่ให้ request แรกที่ยกเลิกทำให้ทุกคนเห็น fail
+	s.last = s.runChecks(context.WithoutCancel(ctx))
+	s.checkedAt = time.Now()
+	return s.last
+}
+
+func (s *HealthService) runChecks(ctx context.Context) *dto.HealthResponse {
+	checks := map[string]healthCheck{
+		"database":   s.checkDatabase,
+		"migrations": s.checkMigrations,
+		"uploads":    s.checkUploads,
+	}
+
+	response := &dto.HealthResponse{
+		Status: dto.HealthStatusOK,
+		Checks: make(map[string]dto.HealthCheckResult, len(checks)),
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, check := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			result := runHealthCheck(ctx, name, check)
+
+			mu.Lock()
+			defer mu.Unlock()
+			response.Checks[name] = result
+			if result.Status != dto.HealthStatusOK {
+				response.Status = dto.HealthStatusFail
+			}
+		}()
+	}
+	wg.Wait()
+
+	return response
+}
+
+// runHealthCheck runs one check and logs what it found. Only the status and
+// latency go into the public response.
+func runHealthCheck(ctx context.Context, name string, check healthCheck) dto.HealthCheckResult {
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+
+	start := time.Now()
+	details, err := check(ctx)
+	latency := time.Since(start)
+	result := dto.HealthCheckResult{
+		Status:    dto.HealthStatusOK,
+		LatencyMS: float64(latency.Microseconds()) / 1000,
+	}
+
+	if err != nil {
+		logger.FromContext(ctx).Warn().Err(err).Str("check", name).Str("details", details).
+			Dur("latency", latency).Msg("readiness check failed")
+		result.Status = dto.HealthStatusFail
+		return result
+	}
+
+	logger.FromContext(ctx).Debug().Str("check", name).Str("details", details).
+		Dur("latency", latency).Msg("readiness check passed")
+	return result
+}
+
+func (s *HealthService) checkDatabase(ctx context.Context) (string, error) {
+	sqlDB, err := s.db.DB()
+	if err != nil {
+		return "", err
+	}
+
+	if err := sqlDB.PingContext(ctx); err != nil {
+		return "", err
+	}
+
+	stats := sqlDB.Stats()
+	return fmt.Sprintf("%d open connections, %d in use", stats.OpenConnections, stats.InUse), nil
+}
+
+// checkMigrations fails when the last migration did not finish (dirty) or the
+// schema is older than this build expects. A newer schema is fine, it is what
+// a rolling deploy looks like while old instances are still running.
+func (s *HealthService) checkMigrations(ctx context.Context) (string, error) {
+	var state struct {
+		Version uint
+		Dirty   bool
+	}
+	result := s.db.WithContext(ctx).Raw("SELECT version, dirty FROM schema_migrations LIMIT 1").Scan(&state)
+	if result.Error != nil {
+		return "", result.Error
+	}
+	if result.RowsAffected == 0 {
+		return "", errors.New("no migrations applied")
+	}
+
+	details := fmt.Sprintf("version %d", state.Version)
+	if state.Dirty {
+		return details, fmt.Errorf("migration %d is dirty, fix it and force the version", state.Version)
+	}
+	if s.migrationVersion != 0 && state.Version < s.migrationVersion {
+		return details, fmt.Errorf("database is at version %d, this build needs %d", state.Version, s.migrationVersion)
+	}
+
+	return details, nil
+}
+
+func (s *HealthService) checkUploads(ctx context.Context) (string, error) {
+	return "", s.uploads.CheckHealth(ctx)
+}
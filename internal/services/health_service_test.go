@@ -0,0 +1,105 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"mime/multipart"
+	"strings"
+	"testing"
+
+	"github.com/joefazee/learning-go-shop/internal/dto"
+)
+
+// fakeUploads counts health checks and fails them while err is set
+type fakeUploads struct {
+	checks int
+	err    error
+}
+
+func (f *fakeUploads) UploadFile(context.Context, *multipart.FileHeader, string) (string, error) {
+	return "", nil
+}
+
+func (f *fakeUploads) DeleteFile(context.Context, string) error {
+	return nil
+}
+
+func (f *fakeUploads) CheckHealth(context.Context) error {
+	f.checks++
+	return f.err
+}
+
+func newTestHealthService(t *testing.T, uploads *fakeUploads) *HealthService {
+	t.Helper()
+
+	db := newTestDB(t)
+	if err := db.Exec("CREATE TABLE schema_migrations (version INTEGER, dirty BOOLEAN)").Error; err != nil {
+		t.Fatalf("create schema_migrations: %v", err)
+	}
+	if err := db.Exec("INSERT INTO schema_migrations VALUES (26, false)").Error; err != nil {
+		t.Fatalf("insert schema version: %v", err)
+	}
+
+	return NewHealthService(db, uploads, 26)
+}
+
+func TestHealthReadyHidesFailureDetails(t *testing.T) {
+	uploads := &fakeUploads{err: errors.New("bucket shop-private-uploads: access denied")}
+	health := newTestHealthService(t, uploads)
+
+	response := health.Ready(context.Background())
+	if response.Status != dto.HealthStatusFail {
+		t.Fatalf("status %q, want %q", response.Status, dto.HealthStatusFail)
+	}
+
+	want := map[string]string{
+		"database":   dto.HealthStatusOK,
+		"migrations": dto.HealthStatusOK,
+		"uploads":    dto.HealthStatusFail,
+	}
+	for name, status := range want {
+		if got := response.Checks[name].Status; got != status {
+			t.Errorf("check %s = %q, want %q", name, got, status)
+		}
+	}
+
+	body, err := json.Marshal(response)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	if strings.Contains(string(body), "bucket") || strings.Contains(string(body), "version") {
+		t.Errorf("public response leaks details: %s", body)
+	}
+	if !strings.Contains(string(body), `"latency_ms"`) {
+		t.Errorf("expected per-check latency in %s", body)
+	}
+}
+
+func TestHealthReadyCachesResults(t *testing.T) {
+	uploads := &fakeUploads{}
+	health := newTestHealthService(t, uploads)
+
+	first := health.Ready(context.Background())
+	uploads.err = errors.New("storage down")
+	second := health.Ready(context.Background())
+
+	if uploads.checks != 1 {
+		t.Errorf("expected the checks to run once, ran %d times", uploads.checks)
+	}
+	if second != first || second.Status != dto.HealthStatusOK {
+		t.Errorf("expected the cached ok response, got %+v", second)
+	}
+}
+
+func TestHealthReadyIgnoresCanceledProbe(t *testing.T) {
+	health := newTestHealthService(t, &fakeUploads{})
+
+	// a probe that hangs up must not cache a failure for everyone else
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if response := health.Ready(ctx); response.Status != dto.HealthStatusOK {
+		t.Errorf("status %q, want %q", response.Status, dto.HealthStatusOK)
+	}
+}
@@ -0,0 +1,121 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/joefazee/learning-go-shop/internal/config"
+	"github.com/joefazee/learning-go-shop/internal/dto"
+	"github.com/joefazee/learning-go-shop/internal/models"
+	"github.com/joefazee/learning-go-shop/internal/providers"
+	"github.com/joefazee/learning-go-shop/internal/utils"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newTestDB opens a private in-memory SQLite database with the tables the
+// services under test need. Production runs on Postgres with the SQL
+// migrations; these tests only rely on portable queries.
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	dsn := fmt.Sprintf("file:%s?mode=memory&cache=shared", strings.ReplaceAll(t.Name(), "/", "_"))
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("open test database: %v", err)
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("open test database: %v", err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+
+	if err := db.AutoMigrate(
+		&models.User{},
+		&models.Cart{},
+		&models.CartItem{},
+		&models.CartAbandonment{},
+		&models.Category{},
+		&models.Product{},
+		&models.Order{},
+		&models.OrderItem{},
+		&models.RefreshToken{},
+		&models.EmailVerificationToken{},
+		&models.PasswordResetToken{},
+		&models.MFARecoveryCode{},
+		&models.AuditEvent{},
+		&models.Role{},
+		&models.Permission{},
+		&models.APIKey{},
+		&models.UserIdentity{},
+		&models.OIDCAuthRequest{},
+	); err != nil {
+		t.Fatalf("migrate test database: %v", err)
+	}
+
+	return db
+}
+
+func newTestConfig() *config.Config {
+	return &config.Config{
+		Server: config.ServerConfig{PublicURL: "http://localhost:8080", FrontendURL: "http://localhost:3000"},
+		JWT: config.JWTConfig{
+			Secret:              "test-secret",
+			ExpiresIn:           15 * time.Minute,
+			RefreshTokenExpires: time.Hour,
+			OrderLookupExpires:  time.Hour,
+			Issuer:              "test-issuer",
+			Audience:            "test-audience",
+		},
+		Auth: config.AuthConfig{
+			EmailVerificationExpires: time.Hour,
+			PasswordResetExpires:     time.Hour,
+			MFAIssuer:                "Test Shop",
+			MFAChallengeExpires:      5 * time.Minute,
+			TokenVersionCacheTTL:     time.Minute,
+			PermissionCacheTTL:       time.Minute,
+			LoginThrottle: config.LoginThrottleConfig{
+				FailureWindow:           time.Hour,
+				BackoffAfter:            3,
+				BackoffBase:             time.Second,
+				BackoffMax:              time.Minute,
+				AccountLockoutThreshold: 10,
+				IPLockoutThreshold:      100,
+				LockoutDuration:         15 * time.Minute,
+			},
+		},
+	}
+}
+
+func newTestAuthService(t *testing.T, db *gorm.DB, cfg *config.Config) *AuthService {
+	t.Helper()
+
+	keys, err := utils.LoadKeySet(&cfg.JWT)
+	if err != nil {
+		t.Fatalf("LoadKeySet: %v", err)
+	}
+
+	throttle := NewLoginThrottleService(db, providers.NewMemoryLoginAttemptStore(), &cfg.Auth.LoginThrottle)
+	return NewAuthService(db, cfg, keys, providers.NewMemoryMailer(), NewTokenVersionService(db, cfg.Auth.TokenVersionCacheTTL), throttle)
+}
+
+// registerTestUser creates a customer through Register and returns its tokens
+func registerTestUser(t *testing.T, auth *AuthService, email string) *dto.AuthResponse {
+	t.Helper()
+
+	response, err := auth.Register(context.Background(), &dto.RegisterRequest{
+		Email:     email,
+		Password:  "correct horse battery",
+		FirstName: "Test",
+		LastName:  "User",
+	}, &dto.ClientInfo{UserAgent: "go-test", IPAddress: "192.0.2.1"})
+	if err != nil {
+		t.Fatalf("Register(%s): %v", email, err)
+	}
+	return response
+}
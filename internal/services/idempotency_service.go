@@ -0,0 +1,103 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"github.com/joefazee/learning-go-shop/internal/models"
+	"github.com/joefazee/learning-go-shop/internal/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// a request that has not finished after this long is assumed to have died
+// with its instance, and a retry may take the key over
+const idempotencyLockTimeout = time.Minute
+
+var (
+	ErrIdempotencyKeyMismatch   = utils.NewUnprocessableError("idempotency_key_reused", "idempotency key was already used with a different request")
+	ErrIdempotencyKeyInProgress = utils.NewConflictError("idempotency_key_in_progress", "a request with this idempotency key is still being processed")
+)
+
+// IdempotencyService stores responses by Idempotency-Key so retried requests
+// are not executed twice
+type IdempotencyService struct {
+	db  *gorm.DB
+	ttl time.Duration
+}
+
+func NewIdempotencyService(db *gorm.DB, ttl time.Duration) *IdempotencyService {
+	return &IdempotencyService{db: db, ttl: ttl}
+}
+
+// Begin claims key for a request. It returns the stored record and true when
+// the request already completed and its response should be replayed, or a
+// new record and false when the caller should run the request and then call
+// Complete or Release.
+func (s *IdempotencyService) Begin(ctx context.Context, scope, key, fingerprint string) (*models.IdempotencyKey, bool, error) {
+	now := time.Now()
+	record := models.IdempotencyKey{
+		Scope:       scope,
+		Key:         key,
+		Fingerprint: fingerprint,
+		ExpiresAt:   now.Add(s.ttl),
+	}
+
+	replay := false
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// ล้าง key ที่หมดอายุไปด้วย ตารางจะได้ไม่โต
+		if err := tx.Where("expires_at < ?", now).Delete(&models.IdempotencyKey{}).Error; err != nil {
+			return err
+		}
+
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&record)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 1 {
+			return nil
+		}
+
+		var existing models.IdempotencyKey
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("scope = ? AND key = ?", scope, key).First(&existing).Error; err != nil {
+			return err
+		}
+
+		if existing.Fingerprint != fingerprint {
+			return ErrIdempotencyKeyMismatch
+		}
+		if existing.StatusCode != nil {
+			record = existing
+			replay = true
+			return nil
+		}
+		if now.Sub(existing.CreatedAt) < idempotencyLockTimeout {
+			return ErrIdempotencyKeyInProgress
+		}
+
+		// request เดิมค้าง (instance ตายกลางทาง) ให้ retry นี้รับช่วงต่อ
+		record = existing
+		return tx.Model(&record).Update("created_at", now).Error
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	return &record, replay, nil
+}
+
+// Complete stores the response of the request that claimed record
+func (s *IdempotencyService) Complete(ctx context.Context, record *models.IdempotencyKey, statusCode int, contentType string, body []byte) error {
+	return s.db.WithContext(ctx).Model(record).Updates(map[string]interface{}{
+		"status_code":   statusCode,
+		"content_type":  contentType,
+		"response_body": body,
+	}).Error
+}
+
+// Release forgets record so the request can be retried, used when it failed
+// in a way that should not be replayed
+func (s *IdempotencyService) Release(ctx context.Context, record *models.IdempotencyKey) error {
+	return s.db.WithContext(ctx).Delete(record).Error
+}
@@ -0,0 +1,335 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/joefazee/learning-go-shop/internal/config"
+	"github.com/joefazee/learning-go-shop/internal/dto"
+	"github.com/joefazee/learning-go-shop/internal/interfaces"
+	"github.com/joefazee/learning-go-shop/internal/models"
+	"github.com/joefazee/learning-go-shop/internal/utils"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrUnknownIdentityProvider = utils.NewNotFoundError("unknown_identity_provider", "unknown identity provider")
+	ErrInvalidOIDCState        = utils.NewValidationError("invalid_oidc_state", "invalid or expired login state")
+	ErrIdentityAlreadyLinked   = utils.NewConflictError("identity_already_linked", "this external account is already linked to a user")
+	ErrIdentityEmailInUse      = utils.NewConflictError("identity_email_in_use", "an account with this email already exists; sign in and link the provider from your profile")
+	ErrIdentityEmailUnverified = utils.NewValidationError("identity_email_unverified", "the identity provider did not confirm the email address")
+)
+
+// IdentityService signs users in with external OpenID Connect providers and
+// manages the identities linked to an account
+type IdentityService struct {
+	db        *gorm.DB
+	config    *config.Config
+	auth      *AuthService
+	providers map[string]interfaces.IdentityProvider
+}
+
+func NewIdentityService(db *gorm.DB, cfg *config.Config, auth *AuthService, providers ...interfaces.IdentityProvider) *IdentityService {
+	byName := make(map[string]interfaces.IdentityProvider, len(providers))
+	for _, p := range providers {
+		byName[p.Name()] = p
+	}
+
+	return &IdentityService{
+		db:        db,
+		config:    cfg,
+		auth:      auth,
+		providers: byName,
+	}
+}
+
+func (s *IdentityService) ListProviders() []dto.OIDCProviderResponse {
+	response := make([]dto.OIDCProviderResponse, 0, len(s.config.OIDC.Providers))
+	for _, p := range s.config.OIDC.Providers {
+		if _, ok := s.providers[p.Name]; ok {
+			response = append(response, dto.OIDCProviderResponse{Name: p.Name})
+		}
+	}
+
+	return response
+}
+
+// StartLogin begins a sign in with provider
+func (s *IdentityService) StartLogin(ctx context.Context, provider string) (*dto.OIDCStartResponse, error) {
+	return s.start(ctx, provider, models.OIDCPurposeLogin, nil)
+}
+
+// StartLink begins linking provider to the signed in user
+func (s *IdentityService) StartLink(ctx context.Context, userID uint, provider string) (*dto.OIDCStartResponse, error) {
+	return s.start(ctx, provider, models.OIDCPurposeLink, &userID)
+}
+
+func (s *IdentityService) start(ctx context.Context, providerName, purpose string, userID *uint) (*dto.OIDCStartResponse, error) {
+	provider, ok := s.providers[providerName]
+	if !ok {
+		return nil, ErrUnknownIdentityProvider
+	}
+
+	state, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	// RFC 7636: verifier ยาว 43-128 ตัวอักษร (32 bytes base64url = 43)
+	verifier, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return nil, err
+	}
+
+	authURL, err := provider.AuthCodeURL(ctx, state, nonce, verifier)
+	if err != nil {
+		return nil, err
+	}
+
+	request := models.OIDCAuthRequest{
+		StateHash:    utils.HashToken(state),
+		Provider:     providerName,
+		Purpose:      purpose,
+		UserID:       userID,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		ExpiresAt:    time.Now().Add(s.config.OIDC.AuthRequestExpires),
+	}
+
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// ล้าง request ที่หมดอายุไปด้วย ตารางจะได้ไม่โต
+		if err := tx.Where("expires_at < ?", time.Now()).Delete(&models.OIDCAuthRequest{}).Error; err != nil {
+			return err
+		}
+
+		return tx.Create(&request).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &dto.OIDCStartResponse{
+		AuthorizationURL: authURL,
+		State:            state,
+		ExpiresIn:        int(s.config.OIDC.AuthRequestExpires.Seconds()),
+	}, nil
+}
+
+// CompleteLogin finishes a sign in. A known identity signs in its user; an
+// unknown one creates a new account unless the email is already registered.
+func (s *IdentityService) CompleteLogin(ctx context.Context, req *dto.OIDCCallbackRequest, client *dto.ClientInfo) (*dto.AuthResponse, error) {
+	request, claims, err := s.complete(ctx, req, models.OIDCPurposeLogin, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var user models.User
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var identity models.UserIdentity
+		err := tx.Where("provider = ? AND subject = ?", request.Provider, claims.Subject).First(&identity).Error
+		if err == nil {
+			if err := tx.Where("id = ? AND is_active = ?", identity.UserID, true).First(&user).Error; err != nil {
+				return ErrInvalidCredentials
+			}
+
+			return tx.Model(&identity).Update("last_login_at", time.Now()).Error
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		return s.createUserFromIdentity(tx, &user, request.Provider, claims)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.auth.completeLogin(ctx, &user, client)
+}
+
+// CompleteLink finishes linking an identity to the signed in user
+func (s *IdentityService) CompleteLink(ctx context.Context, userID uint, req *dto.OIDCCallbackRequest) (*dto.IdentityResponse, error) {
+	request, claims, err := s.complete(ctx, req, models.OIDCPurposeLink, &userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var identity models.UserIdentity
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var existing models.UserIdentity
+		err := tx.Where("provider = ? AND (subject = ? OR user_id = ?)", request.Provider, claims.Subject, userID).First(&existing).Error
+		if err == nil {
+			if existing.UserID == userID && existing.Subject == claims.Subject {
+				identity = existing
+				return nil
+			}
+			return ErrIdentityAlreadyLinked
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		identity = models.UserIdentity{
+			UserID:   userID,
+			Provider: request.Provider,
+			Subject:  claims.Subject,
+			Email:    claims.Email,
+		}
+		return tx.Create(&identity).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	response := toIdentityResponse(&identity)
+	return &response, nil
+}
+
+// complete consumes the stored auth request for state and exchanges the code
+func (s *IdentityService) complete(ctx context.Context, req *dto.OIDCCallbackRequest, purpose string, userID *uint) (*models.OIDCAuthRequest, *interfaces.IdentityClaims, error) {
+	var request models.OIDCAuthRequest
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("state_hash = ? AND purpose = ? AND expires_at > ?", utils.HashToken(req.State), purpose, time.Now()).
+			First(&request).Error; err != nil {
+			return ErrInvalidOIDCState
+		}
+
+		// state ใช้ได้ครั้งเดียว
+		return tx.Delete(&request).Error
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// การ link ต้องจบโดยผู้ใช้คนเดียวกับที่เริ่ม ไม่งั้นโดนหลอกให้ผูกบัญชีคนอื่นได้
+	if userID != nil && (request.UserID == nil || *request.UserID != *userID) {
+		return nil, nil, ErrInvalidOIDCState
+	}
+
+	provider, ok := s.providers[request.Provider]
+	if !ok {
+		return nil, nil, ErrUnknownIdentityProvider
+	}
+
+	claims, err := provider.Exchange(ctx, req.Code, request.CodeVerifier, request.Nonce)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if claims.Subject == "" {
+		return nil, nil, errors.New("oidc: id token has no subject")
+	}
+
+	return &request, claims, nil
+}
+
+func (s *IdentityService) createUserFromIdentity(tx *gorm.DB, user *models.User, provider string, claims *interfaces.IdentityClaims) error {
+	// สร้างบัญชีใหม่เฉพาะอีเมลที่ provider ยืนยันแล้ว ไม่งั้นใครก็จองอีเมลคนอื่นได้
+	if claims.Email == "" || !claims.EmailVerified {
+		return ErrIdentityEmailUnverified
+	}
+
+	var existing int64
+	if err := tx.Model(&models.User{}).Where("LOWER(email) = ?", normalizeEmail(claims.Email)).Count(&existing).Error; err != nil {
+		return err
+	}
+	if existing > 0 {
+		return ErrIdentityEmailInUse
+	}
+
+	// บัญชีจาก OIDC ไม่มีรหัสผ่านที่ใช้ได้ ตั้งเองภายหลังผ่าน forgot password
+	unusable, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return err
+	}
+	hashedPassword, err := utils.HashPassword(unusable)
+	if err != nil {
+		return err
+	}
+
+	firstName, lastName := identityNames(claims)
+	now := time.Now()
+	*user = models.User{
+		Email:           claims.Email,
+		Password:        hashedPassword,
+		FirstName:       firstName,
+		LastName:        lastName,
+		Role:            models.UserRoleCustomer,
+		IsActive:        true,
+		EmailVerifiedAt: &now,
+		TokenVersion:    1,
+	}
+	if err := tx.Create(user).Error; err != nil {
+		return err
+	}
+
+	if err := tx.Create(&models.Cart{UserID: user.ID}).Error; err != nil {
+		return err
+	}
+
+	return tx.Create(&models.UserIdentity{
+		UserID:      user.ID,
+		Provider:    provider,
+		Subject:     claims.Subject,
+		Email:       claims.Email,
+		LastLoginAt: &now,
+	}).Error
+}
+
+func (s *IdentityService) ListIdentities(ctx context.Context, userID uint) ([]dto.IdentityResponse, error) {
+	var identities []models.UserIdentity
+	if err := s.db.WithContext(ctx).Where("user_id = ?", userID).Order("created_at").Find(&identities).Error; err != nil {
+		return nil, err
+	}
+
+	response := make([]dto.IdentityResponse, len(identities))
+	for i := range identities {
+		response[i] = toIdentityResponse(&identities[i])
+	}
+
+	return response, nil
+}
+
+// Unlink removes a linked identity. Users created through OIDC can still get
+// in with a password set through forgot password.
+func (s *IdentityService) Unlink(ctx context.Context, userID, identityID uint) error {
+	result := s.db.WithContext(ctx).Where("id = ? AND user_id = ?", identityID, userID).Delete(&models.UserIdentity{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// identityNames picks first and last name from the ID token claims
+func identityNames(claims *interfaces.IdentityClaims) (string, string) {
+	if claims.GivenName != "" || claims.FamilyName != "" {
+		return claims.GivenName, claims.FamilyName
+	}
+
+	if name := strings.TrimSpace(claims.Name); name != "" {
+		first, last, _ := strings.Cut(name, " ")
+		return first, strings.TrimSpace(last)
+	}
+
+	local, _, _ := strings.Cut(claims.Email, "@")
+	return local, ""
+}
+
+func toIdentityResponse(identity *models.UserIdentity) dto.IdentityResponse {
+	return dto.IdentityResponse{
+		ID:          identity.ID,
+		Provider:    identity.Provider,
+		Email:       identity.Email,
+		CreatedAt:   identity.CreatedAt.Format(defaultDateFormat),
+		LastLoginAt: formatOptionalTime(identity.LastLoginAt),
+	}
+}
@@ -0,0 +1,261 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/joefazee/learning-go-shop/internal/config"
+	"github.com/joefazee/learning-go-shop/internal/dto"
+	"github.com/joefazee/learning-go-shop/internal/models"
+	"github.com/joefazee/learning-go-shop/internal/providers"
+	"gorm.io/gorm"
+)
+
+const testOIDCProvider = "mock"
+
+func newTestIdentityService(t *testing.T) (*IdentityService, *AuthService, *testOIDCIssuer, *gorm.DB) {
+	t.Helper()
+
+	issuer := newTestOIDCIssuer(t)
+	db := newTestDB(t)
+
+	cfg := newTestConfig()
+	providerConfig := config.OIDCProviderConfig{
+		Name:         testOIDCProvider,
+		Issuer:       issuer.URL(),
+		ClientID:     testOIDCClientID,
+		ClientSecret: "shop-test-secret",
+		Scopes:       []string{"openid", "email", "profile"},
+	}
+	cfg.OIDC = config.OIDCConfig{
+		RedirectURL:        "http://localhost:3000/auth/oidc/callback",
+		AuthRequestExpires: 10 * time.Minute,
+		Providers:          []config.OIDCProviderConfig{providerConfig},
+	}
+
+	auth := newTestAuthService(t, db, cfg)
+	identities := NewIdentityService(db, cfg, auth, providers.NewOIDCProvider(providerConfig, cfg.OIDC.RedirectURL))
+
+	return identities, auth, issuer, db
+}
+
+// signInWithIssuer runs a full login as identity and returns the callback
+// request the frontend would send
+func signInWithIssuer(t *testing.T, identities *IdentityService, issuer *testOIDCIssuer, identity testIdentity) *dto.OIDCCallbackRequest {
+	t.Helper()
+
+	start, err := identities.StartLogin(context.Background(), testOIDCProvider)
+	if err != nil {
+		t.Fatalf("StartLogin: %v", err)
+	}
+
+	code, state := issuer.authorize(start.AuthorizationURL, identity)
+	if state != start.State {
+		t.Fatalf("authorization url carries state %q, want %q", state, start.State)
+	}
+
+	return &dto.OIDCCallbackRequest{Code: code, State: state}
+}
+
+func TestOIDCLoginCreatesAndSignsInUser(t *testing.T) {
+	identities, _, issuer, db := newTestIdentityService(t)
+	ctx := context.Background()
+	identity := testIdentity{Subject: "subject-1", Email: "Jane@Example.com", EmailVerified: true, Name: "Jane Doe"}
+
+	first, err := identities.CompleteLogin(ctx, signInWithIssuer(t, identities, issuer, identity), testClient)
+	if err != nil {
+		t.Fatalf("CompleteLogin: %v", err)
+	}
+	if first.AccessToken == "" || first.RefreshToken == "" {
+		t.Fatal("expected a token pair")
+	}
+	if !first.User.EmailVerified || first.User.FirstName != "Jane" || first.User.LastName != "Doe" {
+		t.Errorf("unexpected user %+v", first.User)
+	}
+
+	// the second login finds the linked identity instead of creating a user
+	second, err := identities.CompleteLogin(ctx, signInWithIssuer(t, identities, issuer, identity), testClient)
+	if err != nil {
+		t.Fatalf("second CompleteLogin: %v", err)
+	}
+	if second.User.ID != first.User.ID {
+		t.Errorf("second login signed in user %d, want %d", second.User.ID, first.User.ID)
+	}
+
+	var users int64
+	db.Model(&models.User{}).Count(&users)
+	if users != 1 {
+		t.Errorf("expected 1 user, got %d", users)
+	}
+}
+
+func TestOIDCLoginRejectsUnknownState(t *testing.T) {
+	identities, _, issuer, _ := newTestIdentityService(t)
+
+	callback := signInWithIssuer(t, identities, issuer, testIdentity{Subject: "subject-1", Email: "a@example.com", EmailVerified: true})
+	callback.State = "not-the-state-we-issued"
+
+	if _, err := identities.CompleteLogin(context.Background(), callback, testClient); !errors.Is(err, ErrInvalidOIDCState) {
+		t.Fatalf("expected ErrInvalidOIDCState, got %v", err)
+	}
+}
+
+func TestOIDCLoginRejectsReplayedState(t *testing.T) {
+	identities, _, issuer, _ := newTestIdentityService(t)
+	ctx := context.Background()
+
+	callback := signInWithIssuer(t, identities, issuer, testIdentity{Subject: "subject-1", Email: "a@example.com", EmailVerified: true})
+	if _, err := identities.CompleteLogin(ctx, callback, testClient); err != nil {
+		t.Fatalf("CompleteLogin: %v", err)
+	}
+
+	if _, err := identities.CompleteLogin(ctx, callback, testClient); !errors.Is(err, ErrInvalidOIDCState) {
+		t.Fatalf("expected ErrInvalidOIDCState on replay, got %v", err)
+	}
+}
+
+func TestOIDCLoginRejectsExpiredState(t *testing.T) {
+	identities, _, issuer, db := newTestIdentityService(t)
+
+	callback := signInWithIssuer(t, identities, issuer, testIdentity{Subject: "subject-1", Email: "a@example.com", EmailVerified: true})
+	db.Model(&models.OIDCAuthRequest{}).Where("1 = 1").Update("expires_at", time.Now().Add(-time.Minute))
+
+	if _, err := identities.CompleteLogin(context.Background(), callback, testClient); !errors.Is(err, ErrInvalidOIDCState) {
+		t.Fatalf("expected ErrInvalidOIDCState, got %v", err)
+	}
+}
+
+func TestOIDCLoginRejectsNonceMismatch(t *testing.T) {
+	identities, _, issuer, db := newTestIdentityService(t)
+
+	callback := signInWithIssuer(t, identities, issuer, testIdentity{
+		Subject: "subject-1", Email: "a@example.com", EmailVerified: true,
+		Nonce: "nonce-of-another-login",
+	})
+
+	_, err := identities.CompleteLogin(context.Background(), callback, testClient)
+	if err == nil || !strings.Contains(err.Error(), "nonce") {
+		t.Fatalf("expected a nonce mismatch, got %v", err)
+	}
+
+	var users int64
+	db.Model(&models.User{}).Count(&users)
+	if users != 0 {
+		t.Errorf("no user should be created, got %d", users)
+	}
+}
+
+func TestOIDCLoginRejectsUnverifiedEmail(t *testing.T) {
+	identities, _, issuer, db := newTestIdentityService(t)
+
+	callback := signInWithIssuer(t, identities, issuer, testIdentity{Subject: "subject-1", Email: "a@example.com", EmailVerified: false})
+
+	if _, err := identities.CompleteLogin(context.Background(), callback, testClient); !errors.Is(err, ErrIdentityEmailUnverified) {
+		t.Fatalf("expected ErrIdentityEmailUnverified, got %v", err)
+	}
+
+	var users int64
+	db.Model(&models.User{}).Count(&users)
+	if users != 0 {
+		t.Errorf("no user should be created, got %d", users)
+	}
+}
+
+func TestOIDCLoginDoesNotTakeOverExistingEmail(t *testing.T) {
+	identities, auth, issuer, _ := newTestIdentityService(t)
+	registerTestUser(t, auth, "owner@example.com")
+
+	callback := signInWithIssuer(t, identities, issuer, testIdentity{Subject: "subject-1", Email: "OWNER@example.com", EmailVerified: true})
+
+	if _, err := identities.CompleteLogin(context.Background(), callback, testClient); !errors.Is(err, ErrIdentityEmailInUse) {
+		t.Fatalf("expected ErrIdentityEmailInUse, got %v", err)
+	}
+}
+
+func TestOIDCLinkAndUnlink(t *testing.T) {
+	identities, auth, issuer, _ := newTestIdentityService(t)
+	ctx := context.Background()
+	user := registerTestUser(t, auth, "linker@example.com").User
+	identity := testIdentity{Subject: "subject-1", Email: "someone@provider.test", EmailVerified: true}
+
+	start, err := identities.StartLink(ctx, user.ID, testOIDCProvider)
+	if err != nil {
+		t.Fatalf("StartLink: %v", err)
+	}
+	code, state := issuer.authorize(start.AuthorizationURL, identity)
+
+	linked, err := identities.CompleteLink(ctx, user.ID, &dto.OIDCCallbackRequest{Code: code, State: state})
+	if err != nil {
+		t.Fatalf("CompleteLink: %v", err)
+	}
+	if linked.Provider != testOIDCProvider {
+		t.Errorf("linked provider %q, want %q", linked.Provider, testOIDCProvider)
+	}
+
+	// the linked identity now signs in the existing user, whatever its email
+	signedIn, err := identities.CompleteLogin(ctx, signInWithIssuer(t, identities, issuer, identity), testClient)
+	if err != nil {
+		t.Fatalf("CompleteLogin with linked identity: %v", err)
+	}
+	if signedIn.User.ID != user.ID {
+		t.Errorf("linked identity signed in user %d, want %d", signedIn.User.ID, user.ID)
+	}
+
+	if err := identities.Unlink(ctx, user.ID, linked.ID); err != nil {
+		t.Fatalf("Unlink: %v", err)
+	}
+	list, err := identities.ListIdentities(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("ListIdentities: %v", err)
+	}
+	if len(list) != 0 {
+		t.Errorf("expected no identities after unlink, got %d", len(list))
+	}
+	if err := identities.Unlink(ctx, user.ID, linked.ID); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("expected ErrRecordNotFound unlinking twice, got %v", err)
+	}
+}
+
+func TestOIDCLinkRejectsIdentityOfAnotherUser(t *testing.T) {
+	identities, auth, issuer, _ := newTestIdentityService(t)
+	ctx := context.Background()
+	identity := testIdentity{Subject: "subject-1", Email: "owner@provider.test", EmailVerified: true}
+
+	// the identity already belongs to an account created through OIDC
+	if _, err := identities.CompleteLogin(ctx, signInWithIssuer(t, identities, issuer, identity), testClient); err != nil {
+		t.Fatalf("CompleteLogin: %v", err)
+	}
+
+	other := registerTestUser(t, auth, "other@example.com").User
+	start, err := identities.StartLink(ctx, other.ID, testOIDCProvider)
+	if err != nil {
+		t.Fatalf("StartLink: %v", err)
+	}
+	code, state := issuer.authorize(start.AuthorizationURL, identity)
+
+	if _, err := identities.CompleteLink(ctx, other.ID, &dto.OIDCCallbackRequest{Code: code, State: state}); !errors.Is(err, ErrIdentityAlreadyLinked) {
+		t.Fatalf("expected ErrIdentityAlreadyLinked, got %v", err)
+	}
+}
+
+func TestOIDCLinkMustBeCompletedByTheSameUser(t *testing.T) {
+	identities, auth, issuer, _ := newTestIdentityService(t)
+	ctx := context.Background()
+
+	victim := registerTestUser(t, auth, "victim@example.com").User
+	attacker := registerTestUser(t, auth, "attacker@example.com").User
+
+	start, err := identities.StartLink(ctx, attacker.ID, testOIDCProvider)
+	if err != nil {
+		t.Fatalf("StartLink: %v", err)
+	}
+	code, state := issuer.authorize(start.AuthorizationURL, testIdentity{Subject: "attacker-subject", Email: "x@provider.test", EmailVerified: true})
+
+	// the attacker's callback ends up in the victim's session
+	if _, err := identities.CompleteLink(ctx, victim.ID, &dto.OIDCCallbackRequest{Code: code, State: state}); !errors.Is(err, ErrInvalidOIDCState) {
+		t.Fatalf("expected ErrInvalidOIDCState, got %v", err)
+	}
+}
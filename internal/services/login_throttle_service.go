@@ -0,0 +1,247 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/joefazee/learning-go-shop/internal/config"
+	"github.com/joefazee/learning-go-shop/internal/dto"
+	"github.com/joefazee/learning-go-shop/internal/interfaces"
+	"github.com/joefazee/learning-go-shop/internal/models"
+	"github.com/joefazee/learning-go-shop/internal/utils"
+	"gorm.io/gorm"
+)
+
+var ErrNotLocked = utils.NewNotFoundError("not_locked", "nothing is locked for this key")
+
+// LoginThrottledError is returned while an account or IP has to wait before
+// trying to log in again
+type LoginThrottledError struct {
+	RetryAfter time.Duration
+	Locked     bool // true for a lockout, false for backoff
+}
+
+func (e *LoginThrottledError) Error() string {
+	if e.Locked {
+		return "too many failed login attempts, temporarily locked"
+	}
+	return "too many failed login attempts, slow down"
+}
+
+// LoginThrottleService counts failed logins per account and per IP. After a
+// few failures each further attempt has to wait exponentially longer; past a
+// threshold the key is locked for a while.
+type LoginThrottleService struct {
+	db     *gorm.DB
+	store  interfaces.LoginAttemptStore
+	config *config.LoginThrottleConfig
+}
+
+func NewLoginThrottleService(db *gorm.DB, store interfaces.LoginAttemptStore, cfg *config.LoginThrottleConfig) *LoginThrottleService {
+	return &LoginThrottleService{db: db, store: store, config: cfg}
+}
+
+func accountThrottleKey(email string) string {
+	return "account:" + normalizeEmail(email)
+}
+
+func ipThrottleKey(ip string) string {
+	return "ip:" + ip
+}
+
+// Check returns a LoginThrottledError if email or ip may not try yet
+func (s *LoginThrottleService) Check(ctx context.Context, email, ip string) error {
+	now := time.Now()
+
+	var throttled *LoginThrottledError
+	for _, key := range []string{accountThrottleKey(email), ipThrottleKey(ip)} {
+		attempts, err := s.store.Get(ctx, key)
+		if err != nil {
+			return err
+		}
+
+		if e := s.wait(attempts, now); e != nil && (throttled == nil || e.RetryAfter > throttled.RetryAfter) {
+			throttled = e
+		}
+	}
+
+	if throttled != nil {
+		return throttled
+	}
+	return nil
+}
+
+func (s *LoginThrottleService) wait(attempts *interfaces.LoginAttempts, now time.Time) *LoginThrottledError {
+	if attempts.LockedUntil.After(now) {
+		return &LoginThrottledError{RetryAfter: attempts.LockedUntil.Sub(now), Locked: true}
+	}
+
+	if attempts.Failures < s.config.BackoffAfter || now.Sub(attempts.LastFailureAt) > s.config.FailureWindow {
+		return nil
+	}
+
+	// รอ base * 2^n โดย n นับจาก failure ที่เกิน BackoffAfter
+	delay := s.config.BackoffBase
+	for i := s.config.BackoffAfter; i < attempts.Failures && delay < s.config.BackoffMax; i++ {
+		delay *= 2
+	}
+	delay = min(delay, s.config.BackoffMax)
+
+	if next := attempts.LastFailureAt.Add(delay); next.After(now) {
+		return &LoginThrottledError{RetryAfter: next.Sub(now)}
+	}
+	return nil
+}
+
+// RecordFailure counts a failed login and locks the account or IP once it
+// passes its threshold. userID is set when email belongs to a real account.
+func (s *LoginThrottleService) RecordFailure(ctx context.Context, email, ip string, userID *uint) error {
+	now := time.Now()
+
+	attempts, err := s.store.RecordFailure(ctx, accountThrottleKey(email), now, s.config.FailureWindow)
+	if err != nil {
+		return err
+	}
+	if attempts.Failures >= s.config.AccountLockoutThreshold && !attempts.LockedUntil.After(now) {
+		if err := s.lock(ctx, accountThrottleKey(email), now, models.AuditEvent{
+			Type:      models.AuditAccountLocked,
+			UserID:    userID,
+			Subject:   normalizeEmail(email),
+			IPAddress: ip,
+			Details:   fmt.Sprintf("%d failed login attempts", attempts.Failures),
+		}); err != nil {
+			return err
+		}
+	}
+
+	attempts, err = s.store.RecordFailure(ctx, ipThrottleKey(ip), now, s.config.FailureWindow)
+	if err != nil {
+		return err
+	}
+	if attempts.Failures >= s.config.IPLockoutThreshold && !attempts.LockedUntil.After(now) {
+		if err := s.lock(ctx, ipThrottleKey(ip), now, models.AuditEvent{
+			Type:      models.AuditIPLocked,
+			Subject:   ip,
+			IPAddress: ip,
+			Details:   fmt.Sprintf("%d failed login attempts", attempts.Failures),
+		}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *LoginThrottleService) lock(ctx context.Context, key string, now time.Time, event models.AuditEvent) error {
+	until := now.Add(s.config.LockoutDuration)
+	if err := s.store.Lock(ctx, key, until); err != nil {
+		return err
+	}
+
+	event.Details += fmt.Sprintf(", locked until %s", until.Format(time.RFC3339))
+	return s.db.WithContext(ctx).Create(&event).Error
+}
+
+// RecordSuccess clears the account's failures. The IP keeps its count so one
+// good password does not hide a spray across many accounts.
+func (s *LoginThrottleService) RecordSuccess(ctx context.Context, email string) error {
+	return s.store.Reset(ctx, accountThrottleKey(email))
+}
+
+// UnlockAccount clears the failures and lock of a user's account
+func (s *LoginThrottleService) UnlockAccount(ctx context.Context, actorID, userID uint) error {
+	var user models.User
+	if err := s.db.WithContext(ctx).Select("id", "email").First(&user, userID).Error; err != nil {
+		return err
+	}
+
+	if err := s.store.Reset(ctx, accountThrottleKey(user.Email)); err != nil {
+		return err
+	}
+
+	return s.db.WithContext(ctx).Create(&models.AuditEvent{
+		Type:    models.AuditAccountUnlocked,
+		UserID:  &user.ID,
+		ActorID: optionalID(actorID),
+		Subject: normalizeEmail(user.Email),
+	}).Error
+}
+
+// UnlockIP clears the failures and lock of an IP address
+func (s *LoginThrottleService) UnlockIP(ctx context.Context, actorID uint, ip string) error {
+	attempts, err := s.store.Get(ctx, ipThrottleKey(ip))
+	if err != nil {
+		return err
+	}
+	if attempts.Failures == 0 && attempts.LockedUntil.IsZero() {
+		return ErrNotLocked
+	}
+
+	if err := s.store.Reset(ctx, ipThrottleKey(ip)); err != nil {
+		return err
+	}
+
+	return s.db.WithContext(ctx).Create(&models.AuditEvent{
+		Type:    models.AuditIPUnlocked,
+		ActorID: optionalID(actorID),
+		Subject: ip,
+	}).Error
+}
+
+// optionalID returns nil for 0, the actor of a request made with an API key
+func optionalID(id uint) *uint {
+	if id == 0 {
+		return nil
+	}
+	return &id
+}
+
+func (s *LoginThrottleService) ListAuditEvents(ctx context.Context, query *dto.AuditEventListQuery) ([]dto.AuditEventResponse, *utils.PaginationMeta, error) {
+	page, limit := query.Page, query.Limit
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	db := s.db.WithContext(ctx).Model(&models.AuditEvent{})
+	if query.Type != "" {
+		db = db.Where("type = ?", query.Type)
+	}
+	if query.UserID != 0 {
+		db = db.Where("user_id = ?", query.UserID)
+	}
+
+	var total int64
+	if err := db.Count(&total).Error; err != nil {
+		return nil, nil, err
+	}
+
+	var events []models.AuditEvent
+	if err := db.Order("created_at DESC, id DESC").Offset((page - 1) * limit).Limit(limit).Find(&events).Error; err != nil {
+		return nil, nil, err
+	}
+
+	response := make([]dto.AuditEventResponse, len(events))
+	for i, event := range events {
+		response[i] = dto.AuditEventResponse{
+			ID:        event.ID,
+			Type:      event.Type,
+			UserID:    event.UserID,
+			ActorID:   event.ActorID,
+			Subject:   event.Subject,
+			IPAddress: event.IPAddress,
+			Details:   event.Details,
+			CreatedAt: event.CreatedAt.Format(defaultDateFormat),
+		}
+	}
+
+	return response, &utils.PaginationMeta{
+		Page:       page,
+		Limit:      limit,
+		Total:      total,
+		TotalPages: int((total + int64(limit) - 1) / int64(limit)),
+	}, nil
+}
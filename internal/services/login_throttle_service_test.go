@@ -0,0 +1,220 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/joefazee/learning-go-shop/internal/config"
+	"github.com/joefazee/learning-go-shop/internal/models"
+	"github.com/joefazee/learning-go-shop/internal/providers"
+	"gorm.io/gorm"
+)
+
+const testThrottleIP = "192.0.2.10"
+
+func newTestLoginThrottle(t *testing.T, adjust func(cfg *config.LoginThrottleConfig)) (*LoginThrottleService, *providers.MemoryLoginAttemptStore, *gorm.DB) {
+	t.Helper()
+
+	db := newTestDB(t)
+	cfg := newTestConfig().Auth.LoginThrottle
+	if adjust != nil {
+		adjust(&cfg)
+	}
+
+	store := providers.NewMemoryLoginAttemptStore()
+	return NewLoginThrottleService(db, store, &cfg), store, db
+}
+
+func recordFailures(t *testing.T, throttle *LoginThrottleService, email, ip string, n int) {
+	t.Helper()
+
+	for range n {
+		if err := throttle.RecordFailure(context.Background(), email, ip, nil); err != nil {
+			t.Fatalf("RecordFailure: %v", err)
+		}
+	}
+}
+
+// checkThrottled returns the LoginThrottledError from Check, or nil if the
+// login may go ahead
+func checkThrottled(t *testing.T, throttle *LoginThrottleService, email, ip string) *LoginThrottledError {
+	t.Helper()
+
+	err := throttle.Check(context.Background(), email, ip)
+	if err == nil {
+		return nil
+	}
+
+	var throttled *LoginThrottledError
+	if !errors.As(err, &throttled) {
+		t.Fatalf("Check: %v", err)
+	}
+	return throttled
+}
+
+func countAuditEvents(db *gorm.DB, eventType string) int64 {
+	var n int64
+	db.Model(&models.AuditEvent{}).Where("type = ?", eventType).Count(&n)
+	return n
+}
+
+func TestLoginThrottleBackoff(t *testing.T) {
+	throttle, _, _ := newTestLoginThrottle(t, nil)
+	email := "user@example.com"
+
+	// BackoffAfter is 3: the first failures are free
+	recordFailures(t, throttle, email, testThrottleIP, 2)
+	if throttled := checkThrottled(t, throttle, email, testThrottleIP); throttled != nil {
+		t.Fatalf("expected no backoff after 2 failures, got %v", throttled.RetryAfter)
+	}
+
+	tests := []struct {
+		failures int
+		wait     time.Duration
+	}{
+		{3, time.Second},
+		{4, 2 * time.Second},
+		{5, 4 * time.Second},
+		{9, time.Minute}, // capped at BackoffMax
+	}
+
+	failures := 2
+	for _, tt := range tests {
+		recordFailures(t, throttle, email, testThrottleIP, tt.failures-failures)
+		failures = tt.failures
+
+		throttled := checkThrottled(t, throttle, email, testThrottleIP)
+		if throttled == nil {
+			t.Fatalf("expected backoff after %d failures", tt.failures)
+		}
+		if throttled.Locked {
+			t.Fatalf("expected backoff, not a lockout, after %d failures", tt.failures)
+		}
+		if throttled.RetryAfter > tt.wait || throttled.RetryAfter < tt.wait-time.Second {
+			t.Errorf("after %d failures retry after %v, want about %v", tt.failures, throttled.RetryAfter, tt.wait)
+		}
+	}
+}
+
+func TestLoginThrottleFailuresExpireWithWindow(t *testing.T) {
+	throttle, store, _ := newTestLoginThrottle(t, nil)
+	ctx := context.Background()
+	email := "user@example.com"
+
+	// failures from before the window no longer count
+	old := time.Now().Add(-2 * time.Hour)
+	for range 5 {
+		if _, err := store.RecordFailure(ctx, accountThrottleKey(email), old, time.Hour); err != nil {
+			t.Fatalf("RecordFailure: %v", err)
+		}
+	}
+	if throttled := checkThrottled(t, throttle, email, testThrottleIP); throttled != nil {
+		t.Fatalf("expected stale failures to be ignored, got %+v", throttled)
+	}
+
+	// a new failure starts counting from one again
+	recordFailures(t, throttle, email, testThrottleIP, 1)
+	attempts, err := store.Get(ctx, accountThrottleKey(email))
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if attempts.Failures != 1 {
+		t.Errorf("expected the count to restart at 1, got %d", attempts.Failures)
+	}
+}
+
+func TestLoginThrottleRecordSuccessKeepsIPCount(t *testing.T) {
+	throttle, store, _ := newTestLoginThrottle(t, nil)
+	ctx := context.Background()
+	email := "user@example.com"
+
+	recordFailures(t, throttle, email, testThrottleIP, 3)
+	if err := throttle.RecordSuccess(ctx, email); err != nil {
+		t.Fatalf("RecordSuccess: %v", err)
+	}
+
+	account, _ := store.Get(ctx, accountThrottleKey(email))
+	ip, _ := store.Get(ctx, ipThrottleKey(testThrottleIP))
+	if account.Failures != 0 {
+		t.Errorf("expected account failures to be cleared, got %d", account.Failures)
+	}
+	if ip.Failures != 3 {
+		t.Errorf("expected the IP to keep its 3 failures, got %d", ip.Failures)
+	}
+}
+
+func TestLoginThrottleLocksAccountAndUnlocks(t *testing.T) {
+	throttle, _, db := newTestLoginThrottle(t, nil)
+	auth := newTestAuthService(t, db, newTestConfig())
+	user := registerTestUser(t, auth, "locked@example.com").User
+	ctx := context.Background()
+
+	// another IP each time so only the account reaches its threshold
+	for i := range 10 {
+		if err := throttle.RecordFailure(ctx, user.Email, fmt.Sprintf("192.0.2.%d", 20+i), &user.ID); err != nil {
+			t.Fatalf("RecordFailure: %v", err)
+		}
+	}
+
+	throttled := checkThrottled(t, throttle, user.Email, testThrottleIP)
+	if throttled == nil || !throttled.Locked {
+		t.Fatalf("expected the account to be locked, got %+v", throttled)
+	}
+	if throttled.RetryAfter > 15*time.Minute || throttled.RetryAfter < 14*time.Minute {
+		t.Errorf("expected about 15m lockout, got %v", throttled.RetryAfter)
+	}
+	if n := countAuditEvents(db, models.AuditAccountLocked); n != 1 {
+		t.Errorf("expected 1 account locked event, got %d", n)
+	}
+
+	// the lock follows the normalized email
+	if throttled := checkThrottled(t, throttle, "LOCKED@example.com", testThrottleIP); throttled == nil || !throttled.Locked {
+		t.Errorf("expected the lock to ignore email case, got %+v", throttled)
+	}
+
+	if err := throttle.UnlockAccount(ctx, 0, user.ID); err != nil {
+		t.Fatalf("UnlockAccount: %v", err)
+	}
+	if throttled := checkThrottled(t, throttle, user.Email, testThrottleIP); throttled != nil {
+		t.Fatalf("expected the account to be unlocked, got %+v", throttled)
+	}
+	if n := countAuditEvents(db, models.AuditAccountUnlocked); n != 1 {
+		t.Errorf("expected 1 account unlocked event, got %d", n)
+	}
+}
+
+func TestLoginThrottleLocksIPAndUnlocks(t *testing.T) {
+	throttle, _, db := newTestLoginThrottle(t, func(cfg *config.LoginThrottleConfig) {
+		cfg.IPLockoutThreshold = 5
+	})
+	ctx := context.Background()
+
+	// a spray across accounts from one address
+	for i := range 5 {
+		recordFailures(t, throttle, fmt.Sprintf("user%d@example.com", i), testThrottleIP, 1)
+	}
+
+	throttled := checkThrottled(t, throttle, "fresh@example.com", testThrottleIP)
+	if throttled == nil || !throttled.Locked {
+		t.Fatalf("expected the IP to be locked, got %+v", throttled)
+	}
+	if throttled := checkThrottled(t, throttle, "fresh@example.com", "192.0.2.99"); throttled != nil {
+		t.Errorf("expected other IPs to be allowed, got %+v", throttled)
+	}
+	if n := countAuditEvents(db, models.AuditIPLocked); n != 1 {
+		t.Errorf("expected 1 IP locked event, got %d", n)
+	}
+
+	if err := throttle.UnlockIP(ctx, 0, testThrottleIP); err != nil {
+		t.Fatalf("UnlockIP: %v", err)
+	}
+	if throttled := checkThrottled(t, throttle, "fresh@example.com", testThrottleIP); throttled != nil {
+		t.Fatalf("expected the IP to be unlocked, got %+v", throttled)
+	}
+	if err := throttle.UnlockIP(ctx, 0, testThrottleIP); !errors.Is(err, ErrNotLocked) {
+		t.Errorf("expected ErrNotLocked unlocking twice, got %v", err)
+	}
+}
@@ -0,0 +1,245 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"strings"
+	"time"
+
+	"github.com/joefazee/learning-go-shop/internal/config"
+	"github.com/joefazee/learning-go-shop/internal/dto"
+	"github.com/joefazee/learning-go-shop/internal/models"
+	"github.com/joefazee/learning-go-shop/internal/utils"
+	"gorm.io/gorm"
+)
+
+const recoveryCodeCount = 10
+
+var (
+	ErrTwoFactorNotEnabled     = utils.NewValidationError("two_factor_not_enabled", "two-factor authentication is not enabled")
+	ErrTwoFactorAlreadyEnabled = utils.NewConflictError("two_factor_already_enabled", "two-factor authentication is already enabled")
+	ErrIncorrectPassword       = utils.NewValidationError("incorrect_password", "password is incorrect")
+
+	errInvalidSecondFactor = utils.NewUnauthorizedError("invalid_second_factor", "invalid two-factor code")
+)
+
+type MFAService struct {
+	db     *gorm.DB
+	config *config.Config
+}
+
+func NewMFAService(db *gorm.DB, cfg *config.Config) *MFAService {
+	return &MFAService{
+		db:     db,
+		config: cfg,
+	}
+}
+
+// SetupTwoFactor generates a new TOTP secret for the user. 2FA is not active
+// until the user confirms a code with EnableTwoFactor.
+func (s *MFAService) SetupTwoFactor(ctx context.Context, userID uint) (*dto.TwoFactorSetupResponse, error) {
+	var user models.User
+	if err := s.db.WithContext(ctx).First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+
+	if user.TwoFactorEnabled() {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.db.WithContext(ctx).Model(&user).Update("totp_secret", secret).Error; err != nil {
+		return nil, err
+	}
+
+	return &dto.TwoFactorSetupResponse{
+		Secret:          secret,
+		ProvisioningURI: utils.TOTPProvisioningURI(s.config.Auth.MFAIssuer, user.Email, secret),
+	}, nil
+}
+
+// EnableTwoFactor confirms the pending secret with a code from the
+// authenticator app and returns a fresh set of recovery codes
+func (s *MFAService) EnableTwoFactor(ctx context.Context, userID uint, code string) (*dto.RecoveryCodesResponse, error) {
+	var user models.User
+	if err := s.db.WithContext(ctx).First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+
+	if user.TwoFactorEnabled() {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+	if user.TOTPSecret == "" {
+		return nil, utils.NewValidationError("two_factor_setup_not_started", "two-factor setup has not been started")
+	}
+
+	step, ok := utils.ValidateTOTP(user.TOTPSecret, code, time.Now())
+	if !ok {
+		return nil, errInvalidSecondFactor
+	}
+
+	var codes []string
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Updates(map[string]interface{}{
+			"totp_enabled_at": time.Now(),
+			"totp_last_step":  step,
+		}).Error; err != nil {
+			return err
+		}
+
+		var err error
+		codes, err = replaceRecoveryCodes(tx, user.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &dto.RecoveryCodesResponse{RecoveryCodes: codes}, nil
+}
+
+// DisableTwoFactor turns 2FA off after checking the password and a second factor
+func (s *MFAService) DisableTwoFactor(ctx context.Context, userID uint, req *dto.DisableTwoFactorRequest) error {
+	var user models.User
+	if err := s.db.WithContext(ctx).First(&user, userID).Error; err != nil {
+		return err
+	}
+
+	if !user.TwoFactorEnabled() {
+		return ErrTwoFactorNotEnabled
+	}
+
+	if !utils.CheckPassword(req.Password, user.Password) {
+		return ErrIncorrectPassword
+	}
+
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := verifySecondFactor(tx, &user, req.Code); err != nil {
+			return err
+		}
+
+		if err := tx.Model(&user).Updates(map[string]interface{}{
+			"totp_secret":     nil,
+			"totp_enabled_at": nil,
+			"totp_last_step":  0,
+		}).Error; err != nil {
+			return err
+		}
+
+		return tx.Where("user_id = ?", user.ID).Delete(&models.MFARecoveryCode{}).Error
+	})
+}
+
+// RegenerateRecoveryCodes replaces every recovery code of the user
+func (s *MFAService) RegenerateRecoveryCodes(ctx context.Context, userID uint, code string) (*dto.RecoveryCodesResponse, error) {
+	var user models.User
+	if err := s.db.WithContext(ctx).First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+
+	if !user.TwoFactorEnabled() {
+		return nil, ErrTwoFactorNotEnabled
+	}
+
+	var codes []string
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := verifyTOTP(tx, &user, code); err != nil {
+			return err
+		}
+
+		var err error
+		codes, err = replaceRecoveryCodes(tx, user.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &dto.RecoveryCodesResponse{RecoveryCodes: codes}, nil
+}
+
+// verifySecondFactor accepts either a TOTP code or an unused recovery code
+func verifySecondFactor(tx *gorm.DB, user *models.User, code string) error {
+	if err := verifyTOTP(tx, user, code); err == nil {
+		return nil
+	}
+
+	result := tx.Model(&models.MFARecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", user.ID, utils.HashToken(normalizeRecoveryCode(code))).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errInvalidSecondFactor
+	}
+
+	return nil
+}
+
+// verifyTOTP checks a TOTP code and records its step so it cannot be replayed
+func verifyTOTP(tx *gorm.DB, user *models.User, code string) error {
+	step, ok := utils.ValidateTOTP(user.TOTPSecret, strings.TrimSpace(code), time.Now())
+	if !ok {
+		return errInvalidSecondFactor
+	}
+
+	result := tx.Model(&models.User{}).
+		Where("id = ? AND totp_last_step < ?", user.ID, step).
+		Update("totp_last_step", step)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errInvalidSecondFactor
+	}
+
+	return nil
+}
+
+func replaceRecoveryCodes(tx *gorm.DB, userID uint) ([]string, error) {
+	if err := tx.Where("user_id = ?", userID).Delete(&models.MFARecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, recoveryCodeCount)
+	records := make([]models.MFARecoveryCode, recoveryCodeCount)
+	for i := range codes {
+		code, err := generateRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+
+		codes[i] = code
+		records[i] = models.MFARecoveryCode{
+			UserID:   userID,
+			CodeHash: utils.HashToken(normalizeRecoveryCode(code)),
+		}
+	}
+
+	if err := tx.Create(&records).Error; err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// generateRecoveryCode returns a code formatted as xxxxx-xxxxx
+func generateRecoveryCode() (string, error) {
+	b := make([]byte, 7)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	code := strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b))[:10]
+	return code[:5] + "-" + code[5:], nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+}
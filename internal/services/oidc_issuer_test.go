@@ -0,0 +1,188 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testOIDCClientID = "shop-test-client"
+	testOIDCKeyID    = "test-key"
+)
+
+// testIdentity is what the mock issuer puts into the ID token
+type testIdentity struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+
+	// Nonce overrides the nonce of the authorization request when set
+	Nonce string
+}
+
+type pendingCode struct {
+	identity  testIdentity
+	nonce     string
+	challenge string
+}
+
+// testOIDCIssuer is an OpenID Connect issuer on httptest serving discovery,
+// JWKS and the token endpoint. The user agent part of the flow is skipped:
+// authorize plays the user signing in and returns the code and state the
+// provider would redirect back with.
+type testOIDCIssuer struct {
+	t      *testing.T
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]pendingCode
+}
+
+func newTestOIDCIssuer(t *testing.T) *testOIDCIssuer {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate issuer key: %v", err)
+	}
+
+	issuer := &testOIDCIssuer{t: t, key: key, codes: map[string]pendingCode{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", issuer.discovery)
+	mux.HandleFunc("GET /jwks", issuer.jwks)
+	mux.HandleFunc("POST /token", issuer.token)
+
+	issuer.server = httptest.NewServer(mux)
+	t.Cleanup(issuer.server.Close)
+
+	return issuer
+}
+
+func (i *testOIDCIssuer) URL() string {
+	return i.server.URL
+}
+
+// authorize approves the authorization request in authURL as identity
+func (i *testOIDCIssuer) authorize(authURL string, identity testIdentity) (code, state string) {
+	i.t.Helper()
+
+	u, err := url.Parse(authURL)
+	if err != nil {
+		i.t.Fatalf("parse authorization url: %v", err)
+	}
+	query := u.Query()
+
+	if query.Get("client_id") != testOIDCClientID || query.Get("code_challenge_method") != "S256" {
+		i.t.Fatalf("unexpected authorization request %s", authURL)
+	}
+
+	nonce := query.Get("nonce")
+	if identity.Nonce != "" {
+		nonce = identity.Nonce
+	}
+
+	code = rand.Text()
+	i.mu.Lock()
+	i.codes[code] = pendingCode{identity: identity, nonce: nonce, challenge: query.Get("code_challenge")}
+	i.mu.Unlock()
+
+	return code, query.Get("state")
+}
+
+func (i *testOIDCIssuer) discovery(w http.ResponseWriter, _ *http.Request) {
+	writeTestJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                                i.URL(),
+		"authorization_endpoint":                i.URL() + "/authorize",
+		"token_endpoint":                        i.URL() + "/token",
+		"jwks_uri":                              i.URL() + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+	})
+}
+
+func (i *testOIDCIssuer) jwks(w http.ResponseWriter, _ *http.Request) {
+	pub := i.key.PublicKey
+	writeTestJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": testOIDCKeyID,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}},
+	})
+}
+
+func (i *testOIDCIssuer) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeTestJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+
+	// a code can be redeemed once
+	i.mu.Lock()
+	pending, ok := i.codes[r.PostForm.Get("code")]
+	delete(i.codes, r.PostForm.Get("code"))
+	i.mu.Unlock()
+	if !ok {
+		writeTestJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if base64.RawURLEncoding.EncodeToString(sum[:]) != pending.challenge {
+		writeTestJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant", "error_description": "PKCE verification failed"})
+		return
+	}
+
+	now := time.Now()
+	idToken := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":            i.URL(),
+		"aud":            testOIDCClientID,
+		"sub":            pending.identity.Subject,
+		"email":          pending.identity.Email,
+		"email_verified": pending.identity.EmailVerified,
+		"name":           pending.identity.Name,
+		"nonce":          pending.nonce,
+		"iat":            now.Unix(),
+		"exp":            now.Add(5 * time.Minute).Unix(),
+	})
+	idToken.Header["kid"] = testOIDCKeyID
+
+	signed, err := idToken.SignedString(i.key)
+	if err != nil {
+		i.t.Errorf("sign id token: %v", err)
+		writeTestJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+
+	writeTestJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": rand.Text(),
+		"token_type":   "Bearer",
+		"expires_in":   300,
+		"id_token":     signed,
+	})
+}
+
+func writeTestJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
@@ -1,11 +1,17 @@
 package services
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"net/url"
+	"slices"
+	"strings"
 
+	"github.com/joefazee/learning-go-shop/internal/config"
 	"github.com/joefazee/learning-go-shop/internal/dto"
 	"github.com/joefazee/learning-go-shop/internal/models"
+	"github.com/joefazee/learning-go-shop/internal/telemetry"
 	"github.com/joefazee/learning-go-shop/internal/utils"
 	"gorm.io/gorm"
 )
@@ -15,91 +21,254 @@ const (
 )
 
 type OrderService struct {
-	db *gorm.DB
+	db      *gorm.DB
+	config  *config.Config
+	keys    *utils.KeySet
+	metrics *telemetry.Metrics
 }
 
-// NewOrderService creates the order service type
-func NewOrderService(db *gorm.DB) *OrderService {
-	return &OrderService{db: db}
+// NewOrderService creates the order service type. metrics may be nil.
+func NewOrderService(db *gorm.DB, cfg *config.Config, keys *utils.KeySet, metrics *telemetry.Metrics) *OrderService {
+	return &OrderService{db: db, config: cfg, keys: keys, metrics: metrics}
 }
 
-func (s *OrderService) CreateOrder(userID uint) (*dto.OrderResponse, error) {
+// orderLine is a product/quantity pair waiting to be turned into an order item
+type orderLine struct {
+	Product  *models.Product
+	Quantity int
+}
+
+func (s *OrderService) CreateOrder(ctx context.Context, userID uint) (*dto.OrderResponse, error) {
+	ctx, span := telemetry.StartSpan(ctx, "OrderService.CreateOrder")
+	defer span.End()
+
 	var orderResponse *dto.OrderResponse
 
-	err := s.db.Transaction(func(tx *gorm.DB) error {
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
 
 		var cart models.Cart
 		if err := tx.Preload("CartItems.Product").Where("user_id = ?", userID).First(&cart).Error; err != nil {
-			return errors.New("cart not found")
+			return ErrCartNotFound
 		}
 
 		if len(cart.CartItems) == 0 {
-			return errors.New("cart is empty")
+			return utils.NewValidationError("cart_empty", "cart is empty")
 		}
 
-		// Calculate total and validate stock
-		var totalAmount float64
-		var orderItems []models.OrderItem
+		if changes := cartChanges(&cart); len(changes) > 0 {
+			return &CartChangedError{Changes: changes}
+		}
 
+		lines := make([]orderLine, len(cart.CartItems))
 		for i := range cart.CartItems {
-			cartItem := &cart.CartItems[i]
-
-			if cartItem.Product.Stock < cartItem.Quantity {
-				return fmt.Errorf("insufficient stock for product: %s", cartItem.Product.Name)
+			lines[i] = orderLine{
+				Product:  &cart.CartItems[i].Product,
+				Quantity: cart.CartItems[i].Quantity,
 			}
+		}
 
-			itemTotal := float64(cartItem.Quantity) * cartItem.Product.Price
-			totalAmount += itemTotal
+		order := models.Order{UserID: &userID}
+		if err := s.placeOrder(ctx, tx, &order, lines); err != nil {
+			return err
+		}
 
-			orderItems = append(orderItems, models.OrderItem{
-				ProductID: cartItem.ProductID,
-				Quantity:  cartItem.Quantity,
-				Price:     cartItem.Product.Price,
-			})
+		// Clear cart
+		if err := tx.Unscoped().Where("cart_id = ?", cart.ID).Delete(&models.CartItem{}).Error; err != nil {
+			return err
+		}
 
-			// Update product stock
-			cartItem.Product.Stock -= cartItem.Quantity
-			if err := tx.Save(&cartItem.Product).Error; err != nil {
-				return err
-			}
+		if err := markCartRecovered(tx, cart.ID, order.ID); err != nil {
+			return err
+		}
 
-			// Create order
-			order := models.Order{
-				UserID:      userID,
-				Status:      models.OrderStatusPending,
-				TotalAmount: totalAmount,
-				OrderItems:  orderItems,
-			}
+		response, err := s.getOrderResponse(tx, order.ID)
+		if err != nil {
+			return err
+		}
 
-			if err := tx.Create(&order).Error; err != nil {
-				return err
-			}
+		orderResponse = response
+		return nil // Transaction successful
+	})
 
-			// Clear cart
-			if err := tx.Unscoped().Where("cart_id = ?", cart.ID).Delete(&models.CartItem{}).Error; err != nil {
-				return err
-			}
+	if err != nil {
+		telemetry.RecordError(span, err)
+		s.metrics.CheckoutFailed("user", checkoutFailureReason(err))
+		return nil, err
+	}
 
-			response, err := s.getOrderResponse(tx, order.ID)
-			if err != nil {
-				return err
+	s.metrics.OrderCreated("user")
+	return orderResponse, nil
+
+}
+
+// CreateGuestOrder places an order without an account, using the items sent
+// in the request instead of a stored cart
+func (s *OrderService) CreateGuestOrder(ctx context.Context, req *dto.GuestCheckoutRequest) (*dto.GuestCheckoutResponse, error) {
+	ctx, span := telemetry.StartSpan(ctx, "OrderService.CreateGuestOrder")
+	defer span.End()
+
+	email := normalizeEmail(req.Email)
+
+	// รวมจำนวนของสินค้าที่ส่งมาซ้ำ
+	quantities := make(map[uint]int, len(req.Items))
+	productIDs := make([]uint, 0, len(req.Items))
+	for _, item := range req.Items {
+		if _, ok := quantities[item.ProductID]; !ok {
+			productIDs = append(productIDs, item.ProductID)
+		}
+		quantities[item.ProductID] += item.Quantity
+	}
+
+	var orderResponse *dto.OrderResponse
+
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var products []models.Product
+		if err := tx.Where("id IN ? AND is_active = ?", productIDs, true).Find(&products).Error; err != nil {
+			return err
+		}
+
+		if len(products) != len(productIDs) {
+			return ErrProductNotFound
+		}
+
+		lines := make([]orderLine, len(products))
+		for i := range products {
+			lines[i] = orderLine{
+				Product:  &products[i],
+				Quantity: quantities[products[i].ID],
 			}
+		}
 
-			orderResponse = response
+		order := models.Order{
+			GuestEmail:      email,
+			ShippingAddress: shippingAddressFromRequest(&req.ShippingAddress),
+		}
+		if err := s.placeOrder(ctx, tx, &order, lines); err != nil {
+			return err
 		}
 
-		return nil // Transaction successful
+		response, err := s.getOrderResponse(tx, order.ID)
+		if err != nil {
+			return err
+		}
+
+		orderResponse = response
+		return nil
 	})
 
 	if err != nil {
+		telemetry.RecordError(span, err)
+		s.metrics.CheckoutFailed("guest", checkoutFailureReason(err))
 		return nil, err
 	}
 
-	return orderResponse, nil
+	s.metrics.OrderCreated("guest")
+
+	token, err := utils.GenerateOrderLookupToken(s.keys, &s.config.JWT, orderResponse.ID, email)
+	if err != nil {
+		return nil, err
+	}
+
+	return &dto.GuestCheckoutResponse{
+		Order:       *orderResponse,
+		LookupToken: token,
+		LookupURL:   fmt.Sprintf("%s/api/v1/guest/orders?token=%s", s.config.Server.PublicURL, url.QueryEscape(token)),
+	}, nil
+}
+
+// GetGuestOrder returns the order referenced by a signed lookup token
+func (s *OrderService) GetGuestOrder(ctx context.Context, token string) (*dto.OrderResponse, error) {
+	claims, err := utils.ValidateOrderLookupToken(token, s.keys)
+	if err != nil {
+		return nil, utils.NewNotFoundError("order_not_found", "invalid order lookup token")
+	}
+
+	// ผูกกับ email ด้วย เผื่อ order ถูก claim ไปแล้วก็ยังดูได้ แต่ email ต้องตรง
+	var order models.Order
+	if err := s.db.WithContext(ctx).Preload("OrderItems.Product.Category").
+		Where("id = ? AND LOWER(guest_email) = ?", claims.OrderID, claims.Email).
+		First(&order).Error; err != nil {
+		return nil, err
+	}
+
+	response := s.convertToOrderResponse(&order)
+
+	return &response, nil
+}
+
+// ClaimGuestOrders moves guest orders placed with email onto the user's account.
+// lookupToken must be a lookup token issued for the same email: it was only
+// handed to whoever placed the order, so registering with someone else's
+// email is not enough to take their orders.
+func (s *OrderService) ClaimGuestOrders(ctx context.Context, userID uint, email, lookupToken string) (int64, error) {
+	claims, err := utils.ValidateOrderLookupToken(lookupToken, s.keys)
+	if err != nil {
+		return 0, utils.NewForbiddenError("invalid_lookup_token", "invalid order lookup token")
+	}
+	if claims.Email != normalizeEmail(email) {
+		return 0, utils.NewForbiddenError("invalid_lookup_token", "order lookup token belongs to another email")
+	}
+
+	result := s.db.WithContext(ctx).Model(&models.Order{}).
+		Where("user_id IS NULL AND LOWER(guest_email) = ?", normalizeEmail(email)).
+		Update("user_id", userID)
+
+	return result.RowsAffected, result.Error
+}
+
+// checkoutFailureReason is the metrics label of a failed checkout. AppError
+// codes are a fixed set, so they are safe to use as label values.
+func checkoutFailureReason(err error) string {
+	var cartChanged *CartChangedError
+	if errors.As(err, &cartChanged) {
+		return "cart_changed"
+	}
+
+	var appErr *utils.AppError
+	if errors.As(err, &appErr) {
+		return appErr.Code
+	}
 
+	return "internal"
 }
 
-func (s *OrderService) GetOrders(userID uint, page, limit int) ([]dto.OrderResponse, *utils.PaginationMeta, error) {
+// placeOrder validates stock, decrements it and creates the order with its items
+func (s *OrderService) placeOrder(ctx context.Context, tx *gorm.DB, order *models.Order, lines []orderLine) error {
+	ctx, span := telemetry.StartSpan(ctx, "OrderService.placeOrder")
+	defer span.End()
+	tx = tx.WithContext(ctx)
+
+	var totalAmount float64
+	orderItems := make([]models.OrderItem, 0, len(lines))
+
+	for _, line := range lines {
+		if line.Product.Stock < line.Quantity {
+			return utils.NewInsufficientStockError(fmt.Sprintf("insufficient stock for product: %s", line.Product.Name))
+		}
+
+		totalAmount += float64(line.Quantity) * line.Product.Price
+
+		orderItems = append(orderItems, models.OrderItem{
+			ProductID: line.Product.ID,
+			Quantity:  line.Quantity,
+			Price:     line.Product.Price,
+		})
+
+		// Update product stock
+		line.Product.Stock -= line.Quantity
+		if err := tx.Save(line.Product).Error; err != nil {
+			return err
+		}
+	}
+
+	order.Status = models.OrderStatusPending
+	order.TotalAmount = totalAmount
+	order.OrderItems = orderItems
+
+	return tx.Create(order).Error
+}
+
+func (s *OrderService) GetOrders(ctx context.Context, userID uint, page, limit int) ([]dto.OrderResponse, *utils.PaginationMeta, error) {
 	if page < 1 {
 		page = 1
 	}
@@ -116,9 +285,9 @@ func (s *OrderService) GetOrders(userID uint, page, limit int) ([]dto.OrderRespo
 	var orders []models.Order
 	var total int64
 
-	s.db.Model(&models.Order{}).Where("user_id = ?", userID).Count(&total)
+	s.db.WithContext(ctx).Model(&models.Order{}).Where("user_id = ?", userID).Count(&total)
 
-	if err := s.db.Preload("OrderItems.Product.Category").
+	if err := s.db.WithContext(ctx).Preload("OrderItems.Product.Category").
 		Where("user_id = ?", userID).
 		Order("created_at DESC").
 		Offset(offset).Limit(limit).
@@ -143,9 +312,9 @@ func (s *OrderService) GetOrders(userID uint, page, limit int) ([]dto.OrderRespo
 	return response, meta, nil
 }
 
-func (s *OrderService) GetOrder(userID, orderID uint) (*dto.OrderResponse, error) {
+func (s *OrderService) GetOrder(ctx context.Context, userID, orderID uint) (*dto.OrderResponse, error) {
 	var order models.Order
-	if err := s.db.Preload("OrderItems.Product.Category").
+	if err := s.db.WithContext(ctx).Preload("OrderItems.Product.Category").
 		Where("id = ? AND user_id = ?", orderID, userID).
 		First(&order).Error; err != nil {
 		return nil, err
@@ -156,6 +325,111 @@ func (s *OrderService) GetOrder(userID, orderID uint) (*dto.OrderResponse, error
 	return &response, nil
 }
 
+// orderStatusTransitions lists the statuses staff may move an order to
+var orderStatusTransitions = map[models.OrderStatus][]models.OrderStatus{
+	models.OrderStatusPending:   {models.OrderStatusConfirmed, models.OrderStatusCancelled},
+	models.OrderStatusConfirmed: {models.OrderStatusShipped, models.OrderStatusCancelled},
+	models.OrderStatusShipped:   {models.OrderStatusDelivered},
+}
+
+// ListAllOrders returns the orders of every customer for staff, newest first
+func (s *OrderService) ListAllOrders(ctx context.Context, query *dto.AdminOrderListQuery) ([]dto.OrderResponse, *utils.PaginationMeta, error) {
+	page, limit := query.Page, query.Limit
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	db := s.db.WithContext(ctx).Model(&models.Order{})
+	if query.Status != "" {
+		db = db.Where("status = ?", query.Status)
+	}
+	if query.UserID != 0 {
+		db = db.Where("user_id = ?", query.UserID)
+	}
+	if email := normalizeEmail(query.Email); email != "" {
+		db = db.Where("(LOWER(guest_email) = ? OR user_id IN (SELECT id FROM users WHERE LOWER(email) = ?))", email, email)
+	}
+
+	var total int64
+	if err := db.Count(&total).Error; err != nil {
+		return nil, nil, err
+	}
+
+	var orders []models.Order
+	if err := db.Preload("OrderItems.Product.Category").
+		Order("created_at DESC").Order("id DESC").
+		Offset((page - 1) * limit).Limit(limit).
+		Find(&orders).Error; err != nil {
+		return nil, nil, err
+	}
+
+	response := make([]dto.OrderResponse, len(orders))
+	for i := range orders {
+		response[i] = s.convertToOrderResponse(&orders[i])
+	}
+
+	return response, &utils.PaginationMeta{
+		Page:       page,
+		Limit:      limit,
+		Total:      total,
+		TotalPages: int((total + int64(limit) - 1) / int64(limit)),
+	}, nil
+}
+
+// GetAnyOrder returns an order of any customer for staff
+func (s *OrderService) GetAnyOrder(ctx context.Context, orderID uint) (*dto.OrderResponse, error) {
+	return s.getOrderResponse(s.db.WithContext(ctx), orderID)
+}
+
+// UpdateOrderStatus moves an order along pending -> confirmed -> shipped ->
+// delivered. Pending and confirmed orders can be cancelled, which puts their
+// items back in stock.
+func (s *OrderService) UpdateOrderStatus(ctx context.Context, orderID uint, status string) (*dto.OrderResponse, error) {
+	next := models.OrderStatus(status)
+
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var order models.Order
+		if err := tx.Preload("OrderItems").First(&order, orderID).Error; err != nil {
+			return err
+		}
+
+		if !slices.Contains(orderStatusTransitions[order.Status], next) {
+			return utils.NewConflictError("invalid_status_transition",
+				fmt.Sprintf("order cannot change from %s to %s", order.Status, next))
+		}
+
+		// เงื่อนไข status เดิมกันสอง request เปลี่ยนพร้อมกัน (เช่น cancel ซ้ำแล้วคืน stock สองรอบ)
+		result := tx.Model(&models.Order{}).
+			Where("id = ? AND status = ?", order.ID, order.Status).
+			Update("status", next)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return utils.NewConflictError("order_changed", "order was changed by another request, try again")
+		}
+
+		if next != models.OrderStatusCancelled {
+			return nil
+		}
+		for _, item := range order.OrderItems {
+			if err := tx.Model(&models.Product{}).Where("id = ?", item.ProductID).
+				UpdateColumn("stock", gorm.Expr("stock + ?", item.Quantity)).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetAnyOrder(ctx, orderID)
+}
+
 func (s *OrderService) getOrderResponse(tx *gorm.DB, orderID uint) (*dto.OrderResponse, error) {
 	var order models.Order
 	if err := tx.Preload("OrderItems.Product.Category").First(&order, orderID).Error; err != nil {
@@ -195,12 +469,46 @@ func (s *OrderService) convertToOrderResponse(order *models.Order) dto.OrderResp
 		}
 	}
 
-	return dto.OrderResponse{
+	response := dto.OrderResponse{
 		ID:          order.ID,
 		UserID:      order.UserID,
+		GuestEmail:  order.GuestEmail,
 		Status:      string(order.Status),
 		TotalAmount: order.TotalAmount,
 		OrderItems:  orderItems,
 		CreatedAt:   order.CreatedAt.Format(defaultDateFormat),
 	}
-}
\ No newline at end of file
+
+	if order.ShippingAddress != (models.ShippingAddress{}) {
+		address := order.ShippingAddress
+		response.ShippingAddress = &dto.ShippingAddressResponse{
+			FullName:     address.FullName,
+			Phone:        address.Phone,
+			AddressLine1: address.AddressLine1,
+			AddressLine2: address.AddressLine2,
+			City:         address.City,
+			State:        address.State,
+			PostalCode:   address.PostalCode,
+			Country:      address.Country,
+		}
+	}
+
+	return response
+}
+
+func shippingAddressFromRequest(req *dto.ShippingAddressRequest) models.ShippingAddress {
+	return models.ShippingAddress{
+		FullName:     req.FullName,
+		Phone:        req.Phone,
+		AddressLine1: req.AddressLine1,
+		AddressLine2: req.AddressLine2,
+		City:         req.City,
+		State:        req.State,
+		PostalCode:   req.PostalCode,
+		Country:      req.Country,
+	}
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
@@ -0,0 +1,161 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/joefazee/learning-go-shop/internal/dto"
+	"github.com/joefazee/learning-go-shop/internal/models"
+	"github.com/joefazee/learning-go-shop/internal/utils"
+	"gorm.io/gorm"
+)
+
+func newTestOrderService(t *testing.T) (*OrderService, *gorm.DB) {
+	t.Helper()
+
+	db := newTestDB(t)
+	cfg := newTestConfig()
+	keys, err := utils.LoadKeySet(&cfg.JWT)
+	if err != nil {
+		t.Fatalf("LoadKeySet: %v", err)
+	}
+
+	return NewOrderService(db, cfg, keys, nil), db
+}
+
+// placeTestOrder creates a pending order of quantity units of product, taking
+// them out of stock like checkout does
+func placeTestOrder(t *testing.T, db *gorm.DB, product *models.Product, quantity int, userID *uint, guestEmail string) *models.Order {
+	t.Helper()
+
+	order := models.Order{
+		UserID:      userID,
+		GuestEmail:  guestEmail,
+		Status:      models.OrderStatusPending,
+		TotalAmount: float64(quantity) * product.Price,
+		OrderItems:  []models.OrderItem{{ProductID: product.ID, Quantity: quantity, Price: product.Price}},
+	}
+	if err := db.Create(&order).Error; err != nil {
+		t.Fatalf("create order: %v", err)
+	}
+	if err := db.Model(product).UpdateColumn("stock", gorm.Expr("stock - ?", quantity)).Error; err != nil {
+		t.Fatalf("take stock: %v", err)
+	}
+
+	return &order
+}
+
+func createTestProduct(t *testing.T, db *gorm.DB, sku string, stock int) *models.Product {
+	t.Helper()
+
+	product := models.Product{CategoryID: 1, Name: sku, Price: 10, Stock: stock, SKU: sku, IsActive: true}
+	if err := db.Create(&product).Error; err != nil {
+		t.Fatalf("create product: %v", err)
+	}
+	return &product
+}
+
+func productStock(db *gorm.DB, id uint) int {
+	var product models.Product
+	db.First(&product, id)
+	return product.Stock
+}
+
+func TestUpdateOrderStatusTransitions(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    []string
+		wantErr bool
+	}{
+		{name: "fulfilment", path: []string{"confirmed", "shipped", "delivered"}},
+		{name: "cancel pending", path: []string{"cancelled"}},
+		{name: "cancel confirmed", path: []string{"confirmed", "cancelled"}},
+		{name: "skip confirmation", path: []string{"shipped"}, wantErr: true},
+		{name: "cancel shipped", path: []string{"confirmed", "shipped", "cancelled"}, wantErr: true},
+		{name: "cancel twice", path: []string{"cancelled", "cancelled"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			orders, db := newTestOrderService(t)
+			product := createTestProduct(t, db, "MUG-1", 10)
+			order := placeTestOrder(t, db, product, 3, nil, "guest@example.com")
+
+			var err error
+			for _, status := range tt.path {
+				if _, err = orders.UpdateOrderStatus(context.Background(), order.ID, status); err != nil {
+					break
+				}
+			}
+
+			if !tt.wantErr {
+				if err != nil {
+					t.Fatalf("UpdateOrderStatus: %v", err)
+				}
+				return
+			}
+
+			var appErr *utils.AppError
+			if !errors.As(err, &appErr) || appErr.Code != "invalid_status_transition" {
+				t.Fatalf("expected invalid_status_transition, got %v", err)
+			}
+		})
+	}
+}
+
+func TestCancelOrderRestocksOnce(t *testing.T) {
+	orders, db := newTestOrderService(t)
+	product := createTestProduct(t, db, "MUG-1", 10)
+	order := placeTestOrder(t, db, product, 3, nil, "guest@example.com")
+
+	if _, err := orders.UpdateOrderStatus(context.Background(), order.ID, "cancelled"); err != nil {
+		t.Fatalf("UpdateOrderStatus: %v", err)
+	}
+	if stock := productStock(db, product.ID); stock != 10 {
+		t.Fatalf("stock %d after cancel, want 10", stock)
+	}
+
+	if _, err := orders.UpdateOrderStatus(context.Background(), order.ID, "cancelled"); err == nil {
+		t.Fatal("expected cancelling twice to fail")
+	}
+	if stock := productStock(db, product.ID); stock != 10 {
+		t.Errorf("stock %d after second cancel, want 10", stock)
+	}
+}
+
+func TestListAllOrdersFilters(t *testing.T) {
+	orders, db := newTestOrderService(t)
+	auth := newTestAuthService(t, db, newTestConfig())
+	product := createTestProduct(t, db, "MUG-1", 100)
+
+	customer := registerTestUser(t, auth, "customer@example.com").User
+	placeTestOrder(t, db, product, 1, &customer.ID, "")
+	placeTestOrder(t, db, product, 1, nil, "Customer@Example.com")
+	placeTestOrder(t, db, product, 1, nil, "someone@example.com")
+	shipped := placeTestOrder(t, db, product, 1, nil, "someone@example.com")
+	db.Model(shipped).Update("status", models.OrderStatusShipped)
+
+	tests := []struct {
+		name  string
+		query dto.AdminOrderListQuery
+		want  int64
+	}{
+		{"all", dto.AdminOrderListQuery{}, 4},
+		{"by status", dto.AdminOrderListQuery{Status: "shipped"}, 1},
+		{"by user", dto.AdminOrderListQuery{UserID: customer.ID}, 1},
+		{"by email covers account and guest orders", dto.AdminOrderListQuery{Email: "CUSTOMER@example.com"}, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			list, meta, err := orders.ListAllOrders(context.Background(), &tt.query)
+			if err != nil {
+				t.Fatalf("ListAllOrders: %v", err)
+			}
+			if meta.Total != tt.want || int64(len(list)) != tt.want {
+				t.Errorf("got %d orders (total %d), want %d", len(list), meta.Total, tt.want)
+			}
+		})
+	}
+}
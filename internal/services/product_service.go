@@ -1,6 +1,7 @@
 package services
 
 import (
+	"context"
 	"errors"
 
 	"github.com/joefazee/learning-go-shop/internal/dto"
@@ -19,13 +20,13 @@ func NewProductService(db *gorm.DB) *ProductService {
 
 // ================== CATEGORY ==================
 
-func (s *ProductService) CreateCategory(req *dto.CreateCategoryRequest) (*dto.CategoryResponse, error) {
+func (s *ProductService) CreateCategory(ctx context.Context, req *dto.CreateCategoryRequest) (*dto.CategoryResponse, error) {
 	category := models.Category{
 		Name:        req.Name,
 		Description: req.Description,
 	}
 
-	if err := s.db.Create(&category).Error; err != nil {
+	if err := s.db.WithContext(ctx).Create(&category).Error; err != nil {
 		return nil, err
 	}
 
@@ -37,9 +38,9 @@ func (s *ProductService) CreateCategory(req *dto.CreateCategoryRequest) (*dto.Ca
 	}, nil
 }
 
-func (s *ProductService) GetCategories() ([]dto.CategoryResponse, error) {
+func (s *ProductService) GetCategories(ctx context.Context) ([]dto.CategoryResponse, error) {
 	var categories []models.Category
-	if err := s.db.Where("is_active = ?", true).Find(&categories).Error; err != nil {
+	if err := s.db.WithContext(ctx).Where("is_active = ?", true).Find(&categories).Error; err != nil {
 		return nil, err
 	}
 
@@ -57,9 +58,9 @@ func (s *ProductService) GetCategories() ([]dto.CategoryResponse, error) {
 }
 
 // PATCH style (ต้องให้ dto.UpdateCategoryRequest ใช้ pointer field)
-func (s *ProductService) UpdateCategory(id uint, req *dto.UpdateCategoryRequest) (*dto.CategoryResponse, error) {
+func (s *ProductService) UpdateCategory(ctx context.Context, id uint, req *dto.UpdateCategoryRequest) (*dto.CategoryResponse, error) {
 	var category models.Category
-	if err := s.db.First(&category, id).Error; err != nil {
+	if err := s.db.WithContext(ctx).First(&category, id).Error; err != nil {
 		return nil, err
 	}
 
@@ -73,7 +74,7 @@ func (s *ProductService) UpdateCategory(id uint, req *dto.UpdateCategoryRequest)
 		category.IsActive = *req.IsActive
 	}
 
-	if err := s.db.Save(&category).Error; err != nil {
+	if err := s.db.WithContext(ctx).Save(&category).Error; err != nil {
 		return nil, err
 	}
 
@@ -86,16 +87,16 @@ func (s *ProductService) UpdateCategory(id uint, req *dto.UpdateCategoryRequest)
 }
 
 // soft delete (ให้สอดคล้องกับ query is_active=true)
-func (s *ProductService) DeleteCategory(id uint) error {
-	return s.db.Model(&models.Category{}).
+func (s *ProductService) DeleteCategory(ctx context.Context, id uint) error {
+	return s.db.WithContext(ctx).Model(&models.Category{}).
 		Where("id = ?", id).
 		Update("is_active", false).Error
 }
 
 // ================== PRODUCT ==================
 
-func (s *ProductService) CreateProduct(req *dto.CreateProductRequest) (*dto.ProductResponse, error) {
-	if err := s.ensureActiveCategory(req.CategoryID); err != nil {
+func (s *ProductService) CreateProduct(ctx context.Context, req *dto.CreateProductRequest) (*dto.ProductResponse, error) {
+	if err := s.ensureActiveCategory(ctx, req.CategoryID); err != nil {
 		return nil, err
 	}
 
@@ -108,14 +109,14 @@ func (s *ProductService) CreateProduct(req *dto.CreateProductRequest) (*dto.Prod
 		SKU:         req.SKU,
 	}
 
-	if err := s.db.Create(&product).Error; err != nil {
+	if err := s.db.WithContext(ctx).Create(&product).Error; err != nil {
 		return nil, err
 	}
 
-	return s.GetProduct(product.ID)
+	return s.GetProduct(ctx, product.ID)
 }
 
-func (s *ProductService) GetProducts(page, limit int) ([]dto.ProductResponse, *utils.PaginationMeta, error) {
+func (s *ProductService) GetProducts(ctx context.Context, page, limit int) ([]dto.ProductResponse, *utils.PaginationMeta, error) {
 	if page < 1 {
 		page = 1
 	}
@@ -127,9 +128,9 @@ func (s *ProductService) GetProducts(page, limit int) ([]dto.ProductResponse, *u
 	var products []models.Product
 	var total int64
 
-	s.db.Model(&models.Product{}).Where("is_active = ?", true).Count(&total)
+	s.db.WithContext(ctx).Model(&models.Product{}).Where("is_active = ?", true).Count(&total)
 
-	if err := s.db.Preload("Category").Preload("Images").
+	if err := s.db.WithContext(ctx).Preload("Category").Preload("Images").
 		Where("is_active = ?", true).
 		Offset(offset).Limit(limit).
 		Find(&products).Error; err != nil {
@@ -152,11 +153,11 @@ func (s *ProductService) GetProducts(page, limit int) ([]dto.ProductResponse, *u
 	return response, meta, nil
 }
 
-func (s *ProductService) GetProduct(id uint) (*dto.ProductResponse, error) {
+func (s *ProductService) GetProduct(ctx context.Context, id uint) (*dto.ProductResponse, error) {
 	var product models.Product
 
 	// consistent: ต้อง active เท่านั้น
-	if err := s.db.Preload("Category").Preload("Images").
+	if err := s.db.WithContext(ctx).Preload("Category").Preload("Images").
 		Where("id = ? AND is_active = ?", id, true).
 		First(&product).Error; err != nil {
 		return nil, err
@@ -167,16 +168,16 @@ func (s *ProductService) GetProduct(id uint) (*dto.ProductResponse, error) {
 }
 
 // PATCH style (ต้องให้ dto.UpdateProductRequest ใช้ pointer field)
-func (s *ProductService) UpdateProduct(id uint, req *dto.UpdateProductRequest) (*dto.ProductResponse, error) {
+func (s *ProductService) UpdateProduct(ctx context.Context, id uint, req *dto.UpdateProductRequest) (*dto.ProductResponse, error) {
 	var product models.Product
 
 	// update เฉพาะตัวที่ active
-	if err := s.db.Where("id = ? AND is_active = ?", id, true).First(&product).Error; err != nil {
+	if err := s.db.WithContext(ctx).Where("id = ? AND is_active = ?", id, true).First(&product).Error; err != nil {
 		return nil, err
 	}
 
 	if req.CategoryID != nil {
-		if err := s.ensureActiveCategory(*req.CategoryID); err != nil {
+		if err := s.ensureActiveCategory(ctx, *req.CategoryID); err != nil {
 			return nil, err
 		}
 		product.CategoryID = *req.CategoryID
@@ -200,24 +201,24 @@ func (s *ProductService) UpdateProduct(id uint, req *dto.UpdateProductRequest) (
 		product.IsActive = *req.IsActive
 	}
 
-	if err := s.db.Save(&product).Error; err != nil {
+	if err := s.db.WithContext(ctx).Save(&product).Error; err != nil {
 		return nil, err
 	}
 
-	return s.GetProduct(id)
+	return s.GetProduct(ctx, id)
 }
 
 // soft delete
-func (s *ProductService) DeleteProduct(id uint) error {
-	return s.db.Model(&models.Product{}).
+func (s *ProductService) DeleteProduct(ctx context.Context, id uint) error {
+	return s.db.WithContext(ctx).Model(&models.Product{}).
 		Where("id = ?", id).
 		Update("is_active", false).Error
 }
 
 // เอามาจากไฟล์ล่าง ✅
-func (s *ProductService) AddProductImage(productID uint, url, altText string) error {
+func (s *ProductService) AddProductImage(ctx context.Context, productID uint, url, altText string) error {
 	var count int64
-	s.db.Model(&models.ProductImage{}).Where("product_id = ?", productID).Count(&count)
+	s.db.WithContext(ctx).Model(&models.ProductImage{}).Where("product_id = ?", productID).Count(&count)
 
 	image := models.ProductImage{
 		ProductID: productID,
@@ -226,7 +227,7 @@ func (s *ProductService) AddProductImage(productID uint, url, altText string) er
 		IsPrimary: count == 0, // รูปแรกเป็น primary
 	}
 
-	return s.db.Create(&image).Error
+	return s.db.WithContext(ctx).Create(&image).Error
 }
 
 func (s *ProductService) convertToProductResponse(product *models.Product) dto.ProductResponse {
@@ -261,14 +262,14 @@ func (s *ProductService) convertToProductResponse(product *models.Product) dto.P
 
 // ================== helpers ==================
 
-func (s *ProductService) ensureActiveCategory(categoryID uint) error {
+func (s *ProductService) ensureActiveCategory(ctx context.Context, categoryID uint) error {
 	var c models.Category
-	err := s.db.Where("id = ? AND is_active = ?", categoryID, true).First(&c).Error
+	err := s.db.WithContext(ctx).Where("id = ? AND is_active = ?", categoryID, true).First(&c).Error
 	if err == nil {
 		return nil
 	}
 	if errors.Is(err, gorm.ErrRecordNotFound) {
-		return gorm.ErrRecordNotFound
+		return utils.NewValidationError("category_not_found", "category not found")
 	}
 	return err
 }
@@ -0,0 +1,332 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/joefazee/learning-go-shop/internal/dto"
+	"github.com/joefazee/learning-go-shop/internal/models"
+	"github.com/joefazee/learning-go-shop/internal/utils"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrBuiltInRole       = utils.NewValidationError("built_in_role", "built-in roles cannot be changed")
+	ErrRoleExists        = utils.NewConflictError("role_exists", "role already exists")
+	ErrRoleInUse         = utils.NewConflictError("role_in_use", "role is assigned to users")
+	ErrUnknownRole       = utils.NewValidationError("unknown_role", "unknown role")
+	ErrUnknownPermission = utils.NewValidationError("unknown_permission", "unknown permission")
+	ErrOwnRoleChange     = utils.NewValidationError("own_role_change", "you cannot change your own role")
+	ErrInvalidRoleName   = utils.NewValidationError("invalid_role_name", "role name may only contain lowercase letters, digits and underscores")
+)
+
+var roleNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// RoleService manages roles and resolves the permissions of a role. The
+// role -> permissions map is small, so it is cached whole and reloaded after
+// ttl or whenever this instance changes a role.
+type RoleService struct {
+	db            *gorm.DB
+	tokenVersions *TokenVersionService
+	ttl           time.Duration
+
+	mu          sync.Mutex
+	permissions map[string]map[string]bool
+	loadedAt    time.Time
+}
+
+func NewRoleService(db *gorm.DB, tokenVersions *TokenVersionService, ttl time.Duration) *RoleService {
+	return &RoleService{
+		db:            db,
+		tokenVersions: tokenVersions,
+		ttl:           ttl,
+	}
+}
+
+// HasPermissions reports whether role grants every one of permissions
+func (s *RoleService) HasPermissions(ctx context.Context, role string, permissions ...string) (bool, error) {
+	all, err := s.rolePermissions(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	granted := all[role]
+	for _, p := range permissions {
+		if !granted[p] {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+func (s *RoleService) rolePermissions(ctx context.Context) (map[string]map[string]bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.permissions != nil && time.Since(s.loadedAt) < s.ttl {
+		return s.permissions, nil
+	}
+
+	var roles []models.Role
+	if err := s.db.WithContext(ctx).Preload("Permissions").Find(&roles).Error; err != nil {
+		return nil, err
+	}
+
+	permissions := make(map[string]map[string]bool, len(roles))
+	for _, role := range roles {
+		granted := make(map[string]bool, len(role.Permissions))
+		for _, p := range role.Permissions {
+			granted[p.Name] = true
+		}
+		permissions[role.Name] = granted
+	}
+
+	s.permissions = permissions
+	s.loadedAt = time.Now()
+	return permissions, nil
+}
+
+func (s *RoleService) invalidate() {
+	s.mu.Lock()
+	s.permissions = nil
+	s.mu.Unlock()
+}
+
+func (s *RoleService) ListRoles(ctx context.Context) ([]dto.RoleResponse, error) {
+	var roles []models.Role
+	if err := s.db.WithContext(ctx).Preload("Permissions").Order("name").Find(&roles).Error; err != nil {
+		return nil, err
+	}
+
+	response := make([]dto.RoleResponse, len(roles))
+	for i := range roles {
+		response[i] = toRoleResponse(&roles[i])
+	}
+
+	return response, nil
+}
+
+func (s *RoleService) ListPermissions(ctx context.Context) ([]dto.PermissionResponse, error) {
+	var permissions []models.Permission
+	if err := s.db.WithContext(ctx).Order("name").Find(&permissions).Error; err != nil {
+		return nil, err
+	}
+
+	response := make([]dto.PermissionResponse, len(permissions))
+	for i, p := range permissions {
+		response[i] = dto.PermissionResponse{Name: p.Name, Description: p.Description}
+	}
+
+	return response, nil
+}
+
+func (s *RoleService) CreateRole(ctx context.Context, req *dto.CreateRoleRequest) (*dto.RoleResponse, error) {
+	if !roleNamePattern.MatchString(req.Name) {
+		return nil, ErrInvalidRoleName
+	}
+
+	role := models.Role{
+		Name:        req.Name,
+		Description: req.Description,
+	}
+
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var existing int64
+		if err := tx.Model(&models.Role{}).Where("name = ?", req.Name).Count(&existing).Error; err != nil {
+			return err
+		}
+		if existing > 0 {
+			return ErrRoleExists
+		}
+
+		permissions, err := findPermissions(tx, req.Permissions)
+		if err != nil {
+			return err
+		}
+		role.Permissions = permissions
+
+		return tx.Create(&role).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.invalidate()
+
+	response := toRoleResponse(&role)
+	return &response, nil
+}
+
+// UpdateRole changes the description and, when given, replaces the permissions of a role
+func (s *RoleService) UpdateRole(ctx context.Context, id uint, req *dto.UpdateRoleRequest) (*dto.RoleResponse, error) {
+	var role models.Role
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Preload("Permissions").First(&role, id).Error; err != nil {
+			return err
+		}
+
+		if role.BuiltIn {
+			return ErrBuiltInRole
+		}
+
+		if req.Description != nil {
+			role.Description = *req.Description
+			if err := tx.Model(&role).Update("description", role.Description).Error; err != nil {
+				return err
+			}
+		}
+
+		if req.Permissions != nil {
+			permissions, err := findPermissions(tx, req.Permissions)
+			if err != nil {
+				return err
+			}
+
+			if err := tx.Model(&role).Association("Permissions").Replace(permissions); err != nil {
+				return err
+			}
+			role.Permissions = permissions
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.invalidate()
+
+	response := toRoleResponse(&role)
+	return &response, nil
+}
+
+// DeleteRole removes a custom role that no user has
+func (s *RoleService) DeleteRole(ctx context.Context, id uint) error {
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var role models.Role
+		if err := tx.First(&role, id).Error; err != nil {
+			return err
+		}
+
+		if role.BuiltIn {
+			return ErrBuiltInRole
+		}
+
+		var users int64
+		if err := tx.Model(&models.User{}).Where("role = ?", role.Name).Count(&users).Error; err != nil {
+			return err
+		}
+		if users > 0 {
+			return ErrRoleInUse
+		}
+
+		return tx.Select("Permissions").Delete(&role).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	s.invalidate()
+	return nil
+}
+
+// AssignRole gives a user a role and revokes the access tokens that carry the old one
+func (s *RoleService) AssignRole(ctx context.Context, actorID, userID uint, roleName string) (*dto.UserResponse, error) {
+	if actorID == userID {
+		return nil, ErrOwnRoleChange
+	}
+
+	var user models.User
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&user, userID).Error; err != nil {
+			return err
+		}
+
+		changed, err := setUserRole(tx, &user, roleName)
+		if err != nil || !changed {
+			return err
+		}
+
+		return bumpTokenVersion(tx, user.ID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.tokenVersions.Invalidate(user.ID)
+
+	response := toUserResponse(&user)
+	return &response, nil
+}
+
+// setUserRole changes the role of user if it differs. The caller must bump the
+// token version when it reports a change.
+func setUserRole(tx *gorm.DB, user *models.User, roleName string) (bool, error) {
+	var role models.Role
+	if err := tx.Where("name = ?", roleName).First(&role).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return false, ErrUnknownRole
+		}
+		return false, err
+	}
+
+	if user.Role == models.UserRole(role.Name) {
+		return false, nil
+	}
+
+	if err := tx.Model(&models.User{}).Where("id = ?", user.ID).Update("role", role.Name).Error; err != nil {
+		return false, err
+	}
+	user.Role = models.UserRole(role.Name)
+
+	return true, nil
+}
+
+// findPermissions loads permissions by name and rejects unknown names
+func findPermissions(tx *gorm.DB, names []string) ([]models.Permission, error) {
+	permissions := []models.Permission{}
+	if len(names) == 0 {
+		return permissions, nil
+	}
+
+	if err := tx.Where("name IN ?", names).Find(&permissions).Error; err != nil {
+		return nil, err
+	}
+
+	found := make(map[string]bool, len(permissions))
+	for _, p := range permissions {
+		found[p.Name] = true
+	}
+	for _, name := range names {
+		if !found[name] {
+			return nil, &utils.AppError{
+				Kind:    utils.KindValidation,
+				Code:    ErrUnknownPermission.Code,
+				Message: fmt.Sprintf("%s: %s", ErrUnknownPermission.Message, name),
+				Err:     ErrUnknownPermission,
+			}
+		}
+	}
+
+	return permissions, nil
+}
+
+func toRoleResponse(role *models.Role) dto.RoleResponse {
+	permissions := make([]string, len(role.Permissions))
+	for i, p := range role.Permissions {
+		permissions[i] = p.Name
+	}
+
+	return dto.RoleResponse{
+		ID:          role.ID,
+		Name:        role.Name,
+		Description: role.Description,
+		BuiltIn:     role.BuiltIn,
+		Permissions: permissions,
+	}
+}
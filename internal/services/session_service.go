@@ -0,0 +1,163 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/joefazee/learning-go-shop/internal/dto"
+	"github.com/joefazee/learning-go-shop/internal/models"
+	"github.com/joefazee/learning-go-shop/internal/utils"
+	"gorm.io/gorm"
+)
+
+// ErrSessionRevoked is returned for access tokens whose session was signed out
+var ErrSessionRevoked = utils.NewUnauthorizedError("session_revoked", "session has been revoked")
+
+type sessionEntry struct {
+	userID    uint
+	active    bool
+	expiresAt time.Time
+}
+
+// SessionService manages the sessions (refresh token families) of a user.
+// Session checks on access tokens are cached in process for a short TTL, like
+// token versions, so a sign out on another instance takes effect within it.
+type SessionService struct {
+	db  *gorm.DB
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[string]sessionEntry
+}
+
+func NewSessionService(db *gorm.DB, ttl time.Duration) *SessionService {
+	return &SessionService{
+		db:      db,
+		ttl:     ttl,
+		entries: make(map[string]sessionEntry),
+	}
+}
+
+// CheckSession returns ErrSessionRevoked when the session an access token was
+// issued for has been signed out or has expired
+func (s *SessionService) CheckSession(ctx context.Context, userID uint, sessionID string) error {
+	now := time.Now()
+
+	s.mu.Lock()
+	entry, ok := s.entries[sessionID]
+	s.mu.Unlock()
+
+	if !ok || !now.Before(entry.expiresAt) || entry.userID != userID {
+		var count int64
+		if err := s.db.WithContext(ctx).Model(&models.RefreshToken{}).
+			Where("user_id = ? AND family_id = ? AND expires_at > ?", userID, sessionID, now).
+			Count(&count).Error; err != nil {
+			return err
+		}
+
+		entry = sessionEntry{userID: userID, active: count > 0, expiresAt: now.Add(s.ttl)}
+
+		s.mu.Lock()
+		if len(s.entries) >= tokenVersionCacheSweepSize {
+			for id, e := range s.entries {
+				if !now.Before(e.expiresAt) {
+					delete(s.entries, id)
+				}
+			}
+		}
+		s.entries[sessionID] = entry
+		s.mu.Unlock()
+	}
+
+	if !entry.active {
+		return ErrSessionRevoked
+	}
+
+	return nil
+}
+
+// invalidate drops cached session checks of a user, except keep
+func (s *SessionService) invalidate(userID uint, keep string) {
+	s.mu.Lock()
+	for id, e := range s.entries {
+		if e.userID == userID && id != keep {
+			delete(s.entries, id)
+		}
+	}
+	s.mu.Unlock()
+}
+
+// ListSessions returns the active sessions of a user, most recently used first
+func (s *SessionService) ListSessions(ctx context.Context, userID uint, currentSessionID string) ([]dto.SessionResponse, error) {
+	var tokens []models.RefreshToken
+	if err := s.db.WithContext(ctx).Where("user_id = ? AND expires_at > ?", userID, time.Now()).
+		Order("COALESCE(last_used_at, session_created_at) DESC").
+		Find(&tokens).Error; err != nil {
+		return nil, err
+	}
+
+	response := make([]dto.SessionResponse, len(tokens))
+	for i := range tokens {
+		token := &tokens[i]
+
+		lastUsedAt := token.SessionCreatedAt
+		if token.LastUsedAt != nil {
+			lastUsedAt = *token.LastUsedAt
+		}
+
+		response[i] = dto.SessionResponse{
+			ID:         token.FamilyID,
+			UserAgent:  token.UserAgent,
+			IPAddress:  token.IPAddress,
+			CreatedAt:  token.SessionCreatedAt.Format(defaultDateFormat),
+			LastUsedAt: lastUsedAt.Format(defaultDateFormat),
+			ExpiresAt:  token.ExpiresAt.Format(defaultDateFormat),
+			Current:    token.FamilyID == currentSessionID,
+		}
+	}
+
+	return response, nil
+}
+
+// RevokeSession signs one session out
+func (s *SessionService) RevokeSession(ctx context.Context, userID uint, sessionID string) error {
+	result := s.db.WithContext(ctx).Where("user_id = ? AND family_id = ?", userID, sessionID).Delete(&models.RefreshToken{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return utils.NewNotFoundError("session_not_found", "session not found")
+	}
+
+	s.invalidate(userID, "")
+	return nil
+}
+
+// RevokeOtherSessions signs out every session except the current one
+func (s *SessionService) RevokeOtherSessions(ctx context.Context, userID uint, currentSessionID string) (int64, error) {
+	result := s.db.WithContext(ctx).Where("user_id = ? AND family_id <> ?", userID, currentSessionID).Delete(&models.RefreshToken{})
+	if result.Error != nil {
+		return 0, result.Error
+	}
+
+	s.invalidate(userID, currentSessionID)
+	return result.RowsAffected, nil
+}
+
+// revokeSession deletes every live token of a refresh token family
+func revokeSession(tx *gorm.DB, userID uint, familyID string) error {
+	return tx.Where("user_id = ? AND family_id = ?", userID, familyID).Delete(&models.RefreshToken{}).Error
+}
+
+// truncate cuts s to at most max bytes without splitting a UTF-8 character
+func truncate(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	for max > 0 && !utf8.RuneStart(s[max]) {
+		max--
+	}
+	return s[:max]
+}
@@ -0,0 +1,114 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/joefazee/learning-go-shop/internal/models"
+	"github.com/joefazee/learning-go-shop/internal/utils"
+	"gorm.io/gorm"
+)
+
+// ErrTokenRevoked is returned for access tokens issued before the user's
+// token version was bumped, or for users who are no longer active
+var ErrTokenRevoked = utils.NewUnauthorizedError("token_revoked", "token has been revoked")
+
+// tokenVersionCacheSweepSize is how large the cache may grow before expired
+// entries are swept
+const tokenVersionCacheSweepSize = 10000
+
+type tokenVersionEntry struct {
+	version   int
+	active    bool
+	expiresAt time.Time
+}
+
+// TokenVersionService checks access tokens against the current token version
+// of their user. Lookups are cached in process for a short TTL, so changes made
+// by another instance take effect within that TTL.
+type TokenVersionService struct {
+	db  *gorm.DB
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[uint]tokenVersionEntry
+}
+
+func NewTokenVersionService(db *gorm.DB, ttl time.Duration) *TokenVersionService {
+	return &TokenVersionService{
+		db:      db,
+		ttl:     ttl,
+		entries: make(map[uint]tokenVersionEntry),
+	}
+}
+
+// Check returns ErrTokenRevoked unless the user is active and version is current
+func (s *TokenVersionService) Check(ctx context.Context, userID uint, version int) error {
+	entry, err := s.lookup(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if !entry.active || entry.version != version {
+		return ErrTokenRevoked
+	}
+
+	return nil
+}
+
+// Invalidate drops the cached version of a user. Call it after committing a
+// change that bumped the version.
+func (s *TokenVersionService) Invalidate(userID uint) {
+	s.mu.Lock()
+	delete(s.entries, userID)
+	s.mu.Unlock()
+}
+
+func (s *TokenVersionService) lookup(ctx context.Context, userID uint) (tokenVersionEntry, error) {
+	now := time.Now()
+
+	s.mu.Lock()
+	entry, ok := s.entries[userID]
+	s.mu.Unlock()
+	if ok && now.Before(entry.expiresAt) {
+		return entry, nil
+	}
+
+	var user models.User
+	err := s.db.WithContext(ctx).Select("id", "is_active", "token_version").First(&user, userID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		// ผู้ใช้ถูกลบไปแล้ว ถือว่า token ใช้ไม่ได้
+		return tokenVersionEntry{}, ErrTokenRevoked
+	}
+	if err != nil {
+		return tokenVersionEntry{}, err
+	}
+
+	entry = tokenVersionEntry{
+		version:   user.TokenVersion,
+		active:    user.IsActive,
+		expiresAt: now.Add(s.ttl),
+	}
+
+	s.mu.Lock()
+	if len(s.entries) >= tokenVersionCacheSweepSize {
+		for id, e := range s.entries {
+			if !now.Before(e.expiresAt) {
+				delete(s.entries, id)
+			}
+		}
+	}
+	s.entries[userID] = entry
+	s.mu.Unlock()
+
+	return entry, nil
+}
+
+// bumpTokenVersion invalidates every access token already issued to the user.
+// Call it whenever IsActive, Role or the password changes.
+func bumpTokenVersion(tx *gorm.DB, userID uint) error {
+	return tx.Model(&models.User{}).Where("id = ?", userID).
+		UpdateColumn("token_version", gorm.Expr("token_version + 1")).Error
+}
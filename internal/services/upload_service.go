@@ -1,6 +1,7 @@
 package services
 
 import (
+	"context"
 	"fmt"
 	"mime/multipart"
 	"path/filepath"
@@ -9,6 +10,7 @@ import (
 	"github.com/google/uuid"
 
 	"github.com/joefazee/learning-go-shop/internal/interfaces"
+	"github.com/joefazee/learning-go-shop/internal/utils"
 )
 
 type UploadService struct {
@@ -19,16 +21,16 @@ func NewUploadService(provider interfaces.UploadProvider) *UploadService {
 	return &UploadService{provider: provider}
 }
 
-func (s *UploadService) UploadProductImage(productID uint, file *multipart.FileHeader) (string, error) {
+func (s *UploadService) UploadProductImage(ctx context.Context, productID uint, file *multipart.FileHeader) (string, error) {
 
 	ext := strings.ToLower(filepath.Ext(file.Filename))
 	if !isValidImageExt(ext) {
-		return "", fmt.Errorf("invalid file type: %s", ext)
+		return "", utils.NewValidationError("invalid_file_type", fmt.Sprintf("invalid file type: %s", ext))
 	}
 
 	path := fmt.Sprintf("products/%d/%s%s", productID, uuid.New().String(), ext)
 
-	return s.provider.UploadFile(file, path)
+	return s.provider.UploadFile(ctx, file, path)
 }
 
 func isValidImageExt(ext string) bool {
@@ -1,49 +1,99 @@
 package services
 
 import (
+	"context"
+
 	"github.com/joefazee/learning-go-shop/internal/dto"
 	"github.com/joefazee/learning-go-shop/internal/models"
+	"github.com/joefazee/learning-go-shop/internal/utils"
 	"gorm.io/gorm"
 )
 
 type UserService struct {
-	db *gorm.DB
+	db            *gorm.DB
+	tokenVersions *TokenVersionService
 }
 
-func NewUserService(db *gorm.DB) *UserService {
-	return &UserService{db: db}
+func NewUserService(db *gorm.DB, tokenVersions *TokenVersionService) *UserService {
+	return &UserService{db: db, tokenVersions: tokenVersions}
 }
 
-func (s *UserService) GetProfile(userID uint) (*dto.UserResponse, error) {
+func (s *UserService) GetProfile(ctx context.Context, userID uint) (*dto.UserResponse, error) {
 	var user models.User
-	if err := s.db.First(&user, userID).Error; err != nil {
+	if err := s.db.WithContext(ctx).First(&user, userID).Error; err != nil {
 		return nil, err
 	}
 
-	return &dto.UserResponse{
-		ID:        user.ID,
-		Email:     user.Email,
-		FirstName: user.FirstName,
-		LastName:  user.LastName,
-		Phone:     user.Phone,
-		Role:      string(user.Role),
-		IsActive:  user.IsActive,
-	}, nil
+	response := toUserResponse(&user)
+	return &response, nil
 }
 
-func (s *UserService) UpdateProfile(userID uint, req *dto.UpdateProfileRequest) (*dto.UserResponse, error) {
+func (s *UserService) UpdateProfile(ctx context.Context, userID uint, req *dto.UpdateProfileRequest) (*dto.UserResponse, error) {
 	var user models.User
-	if err := s.db.First(&user, userID).Error; err != nil {
+	if err := s.db.WithContext(ctx).First(&user, userID).Error; err != nil {
 		return nil, err
 	}
 
-	user.FirstName = req.FirstName
-	user.LastName = req.LastName
-	user.Phone = req.Phone
-
-	if err := s.db.Save(&user).Error; err != nil {
+	// อัปเดตเฉพาะข้อมูลโปรไฟล์ Save จะเขียน token_version/is_active ค่าเก่าทับการ revoke ที่เกิดพร้อมกัน
+	if err := s.db.WithContext(ctx).Model(&user).Updates(map[string]interface{}{
+		"first_name": req.FirstName,
+		"last_name":  req.LastName,
+		"phone":      req.Phone,
+	}).Error; err != nil {
 		return nil, err
 	}
 
-	return s.GetProfile(userID)
-}
\ No newline at end of file
+	return s.GetProfile(ctx, userID)
+}
+
+// ChangePassword replaces the password after checking the current one and
+// revokes every refresh token of the user
+func (s *UserService) ChangePassword(ctx context.Context, userID uint, req *dto.ChangePasswordRequest) error {
+	var user models.User
+	if err := s.db.WithContext(ctx).First(&user, userID).Error; err != nil {
+		return err
+	}
+
+	if !utils.CheckPassword(req.CurrentPassword, user.Password) {
+		return utils.NewValidationError("incorrect_password", "current password is incorrect")
+	}
+
+	hashedPassword, err := utils.HashPassword(req.NewPassword)
+	if err != nil {
+		return err
+	}
+
+	if err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return updatePassword(tx, user.ID, hashedPassword)
+	}); err != nil {
+		return err
+	}
+
+	s.tokenVersions.Invalidate(user.ID)
+	return nil
+}
+
+// IsEmailVerified reports whether the user has confirmed their email address
+func (s *UserService) IsEmailVerified(ctx context.Context, userID uint) (bool, error) {
+	var user models.User
+	if err := s.db.WithContext(ctx).Select("id", "email_verified_at").First(&user, userID).Error; err != nil {
+		return false, err
+	}
+
+	return user.EmailVerifiedAt != nil, nil
+}
+
+func toUserResponse(user *models.User) dto.UserResponse {
+	return dto.UserResponse{
+		ID:            user.ID,
+		Email:         user.Email,
+		FirstName:     user.FirstName,
+		LastName:      user.LastName,
+		Phone:         user.Phone,
+		Role:          string(user.Role),
+		IsActive:      user.IsActive,
+		EmailVerified: user.EmailVerifiedAt != nil,
+
+		TwoFactorEnabled: user.TwoFactorEnabled(),
+	}
+}
@@ -0,0 +1,203 @@
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/joefazee/learning-go-shop/internal/models"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"gorm.io/gorm"
+)
+
+const (
+	metricsNamespace = "shop"
+
+	// a slow database must not make /metrics hang; the gauge reads NaN instead
+	lowStockQueryTimeout = 2 * time.Second
+)
+
+// Metrics holds the Prometheus collectors of the application. A nil *Metrics
+// is valid and records nothing, so callers do not need to check whether
+// metrics are enabled.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	httpRequests        *prometheus.CounterVec
+	httpRequestDuration *prometheus.HistogramVec
+	dbQueryDuration     *prometheus.HistogramVec
+	ordersCreated       *prometheus.CounterVec
+	checkoutFailures    *prometheus.CounterVec
+}
+
+func NewMetrics() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+
+		httpRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "http_requests_total",
+			Help:      "HTTP requests handled, by route template and status code.",
+		}, []string{"method", "route", "status"}),
+
+		httpRequestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Time spent handling HTTP requests, by route template and status code.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route", "status"}),
+
+		dbQueryDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "db_query_duration_seconds",
+			Help:      "Time spent in GORM queries, by operation and table.",
+			Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+		}, []string{"operation", "table"}),
+
+		ordersCreated: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "orders_created_total",
+			Help:      "Orders placed, by checkout channel (user or guest).",
+		}, []string{"channel"}),
+
+		checkoutFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "checkout_failures_total",
+			Help:      "Checkouts that did not create an order, by channel and reason.",
+		}, []string{"channel", "reason"}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.httpRequests,
+		m.httpRequestDuration,
+		m.dbQueryDuration,
+		m.ordersCreated,
+		m.checkoutFailures,
+	)
+
+	return m
+}
+
+// InstrumentDB registers connection pool stats, query durations and the
+// low stock gauge for db
+func (m *Metrics) InstrumentDB(db *gorm.DB, lowStockThreshold int) error {
+	if m == nil {
+		return nil
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+
+	lowStock := prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace:   metricsNamespace,
+		Name:        "low_stock_products",
+		Help:        "Active products whose stock is at or below the low stock threshold.",
+		ConstLabels: prometheus.Labels{"threshold": strconv.Itoa(lowStockThreshold)},
+	}, func() float64 {
+		ctx, cancel := context.WithTimeout(context.Background(), lowStockQueryTimeout)
+		defer cancel()
+
+		var count int64
+		if err := db.WithContext(ctx).Model(&models.Product{}).
+			Where("is_active = ? AND stock <= ?", true, lowStockThreshold).
+			Count(&count).Error; err != nil {
+			return math.NaN()
+		}
+		return float64(count)
+	})
+
+	if err := m.registry.Register(collectors.NewDBStatsCollector(sqlDB, "main")); err != nil {
+		return err
+	}
+	if err := m.registry.Register(lowStock); err != nil {
+		return err
+	}
+
+	return registerQueryCallbacks(db, m.dbQueryDuration)
+}
+
+// Handler serves the registry in the Prometheus text format
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{Registry: m.registry})
+}
+
+// ObserveHTTPRequest records one handled request. route is the route
+// template, not the raw path, to keep label cardinality bounded.
+func (m *Metrics) ObserveHTTPRequest(method, route string, status int, duration time.Duration) {
+	if m == nil {
+		return
+	}
+
+	code := strconv.Itoa(status)
+	m.httpRequests.WithLabelValues(method, route, code).Inc()
+	m.httpRequestDuration.WithLabelValues(method, route, code).Observe(duration.Seconds())
+}
+
+// OrderCreated counts an order placed through channel
+func (m *Metrics) OrderCreated(channel string) {
+	if m == nil {
+		return
+	}
+	m.ordersCreated.WithLabelValues(channel).Inc()
+}
+
+// CheckoutFailed counts a checkout through channel that failed for reason
+func (m *Metrics) CheckoutFailed(channel, reason string) {
+	if m == nil {
+		return
+	}
+	m.checkoutFailures.WithLabelValues(channel, reason).Inc()
+}
+
+const queryStartKey = "telemetry:query_start"
+
+// registerQueryCallbacks times every GORM operation with before/after hooks
+func registerQueryCallbacks(db *gorm.DB, histogram *prometheus.HistogramVec) error {
+	before := func(tx *gorm.DB) {
+		tx.InstanceSet(queryStartKey, time.Now())
+	}
+
+	after := func(operation string) func(*gorm.DB) {
+		return func(tx *gorm.DB) {
+			v, ok := tx.InstanceGet(queryStartKey)
+			if !ok {
+				return
+			}
+			start, ok := v.(time.Time)
+			if !ok {
+				return
+			}
+
+			table := tx.Statement.Table
+			if table == "" {
+				table = "unknown"
+			}
+			histogram.WithLabelValues(operation, table).Observe(time.Since(start).Seconds())
+		}
+	}
+
+	cb := db.Callback()
+	return errors.Join(
+		cb.Create().Before("gorm:create").Register("telemetry:before_create", before),
+		cb.Create().After("gorm:create").Register("telemetry:after_create", after("create")),
+		cb.Query().Before("gorm:query").Register("telemetry:before_query", before),
+		cb.Query().After("gorm:query").Register("telemetry:after_query", after("query")),
+		cb.Update().Before("gorm:update").Register("telemetry:before_update", before),
+		cb.Update().After("gorm:update").Register("telemetry:after_update", after("update")),
+		cb.Delete().Before("gorm:delete").Register("telemetry:before_delete", before),
+		cb.Delete().After("gorm:delete").Register("telemetry:after_delete", after("delete")),
+		cb.Row().Before("gorm:row").Register("telemetry:before_row", before),
+		cb.Row().After("gorm:row").Register("telemetry:after_row", after("row")),
+		cb.Raw().Before("gorm:raw").Register("telemetry:before_raw", before),
+		cb.Raw().After("gorm:raw").Register("telemetry:after_raw", after("raw")),
+	)
+}
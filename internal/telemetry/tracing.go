@@ -0,0 +1,151 @@
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/joefazee/learning-go-shop/internal/config"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+const tracerName = "github.com/joefazee/learning-go-shop"
+
+// SetupTracing installs the global tracer provider and the W3C trace context
+// propagator. The returned function flushes buffered spans and must be called
+// on shutdown.
+func SetupTracing(ctx context.Context, cfg *config.TracingConfig) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	if !cfg.Enabled {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch cfg.Exporter {
+	case "otlp":
+		opts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(cfg.OTLPEndpoint)}
+		if cfg.OTLPInsecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		exporter, err = otlptracehttp.New(ctx, opts...)
+	default:
+		exporter, err = stdouttrace.New(stdouttrace.WithPrettyPrint())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s trace exporter: %w", cfg.Exporter, err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName(cfg.ServiceName),
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
+
+// StartSpan starts a span named name as a child of the span in ctx
+func StartSpan(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, opts...)
+}
+
+// RecordError marks span as failed with err
+func RecordError(span trace.Span, err error) {
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
+
+// GormTracing is a GORM plugin that creates a client span for every query,
+// as a child of the span in the statement's context
+type GormTracing struct{}
+
+func (GormTracing) Name() string {
+	return "telemetry:tracing"
+}
+
+const (
+	querySpanKey      = "telemetry:query_span"
+	queryParentCtxKey = "telemetry:query_parent_ctx"
+)
+
+func (GormTracing) Initialize(db *gorm.DB) error {
+	before := func(operation string) func(*gorm.DB) {
+		return func(tx *gorm.DB) {
+			parent := tx.Statement.Context
+			ctx, span := StartSpan(parent, "gorm."+operation, trace.WithSpanKind(trace.SpanKindClient))
+			tx.Statement.Context = ctx
+			tx.InstanceSet(querySpanKey, span)
+			tx.InstanceSet(queryParentCtxKey, parent)
+		}
+	}
+
+	after := func(operation string) func(*gorm.DB) {
+		return func(tx *gorm.DB) {
+			v, ok := tx.InstanceGet(querySpanKey)
+			if !ok {
+				return
+			}
+			span, ok := v.(trace.Span)
+			if !ok {
+				return
+			}
+			defer span.End()
+
+			// statement ที่ chain ต่อ (เช่น Count แล้ว Find) ต้องไม่กลายเป็นลูกของ span นี้
+			if parent, ok := tx.InstanceGet(queryParentCtxKey); ok {
+				tx.Statement.Context = parent.(context.Context)
+			}
+
+			span.SetAttributes(
+				semconv.DBSystemNamePostgreSQL,
+				semconv.DBOperationName(operation),
+				semconv.DBCollectionName(tx.Statement.Table),
+				semconv.DBQueryText(tx.Statement.SQL.String()),
+				semconv.DBResponseReturnedRows(int(tx.Statement.RowsAffected)),
+			)
+			// ไม่เจอ record เป็นเรื่องปกติของ First ไม่นับเป็น error
+			if tx.Error != nil && !errors.Is(tx.Error, gorm.ErrRecordNotFound) {
+				RecordError(span, tx.Error)
+			}
+		}
+	}
+
+	cb := db.Callback()
+	return errors.Join(
+		cb.Create().Before("gorm:create").Register("telemetry:trace_before_create", before("create")),
+		cb.Create().After("gorm:create").Register("telemetry:trace_after_create", after("create")),
+		cb.Query().Before("gorm:query").Register("telemetry:trace_before_query", before("query")),
+		cb.Query().After("gorm:query").Register("telemetry:trace_after_query", after("query")),
+		cb.Update().Before("gorm:update").Register("telemetry:trace_before_update", before("update")),
+		cb.Update().After("gorm:update").Register("telemetry:trace_after_update", after("update")),
+		cb.Delete().Before("gorm:delete").Register("telemetry:trace_before_delete", before("delete")),
+		cb.Delete().After("gorm:delete").Register("telemetry:trace_after_delete", after("delete")),
+		cb.Row().Before("gorm:row").Register("telemetry:trace_before_row", before("row")),
+		cb.Row().After("gorm:row").Register("telemetry:trace_after_row", after("row")),
+		cb.Raw().Before("gorm:raw").Register("telemetry:trace_before_raw", before("raw")),
+		cb.Raw().After("gorm:raw").Register("telemetry:trace_after_raw", after("raw")),
+	)
+}
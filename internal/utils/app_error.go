@@ -0,0 +1,235 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+// ErrorKind groups application errors by how the client should treat them;
+// each kind maps to one HTTP status
+type ErrorKind int
+
+const (
+	KindInternal ErrorKind = iota
+	KindValidation
+	KindUnauthorized
+	KindForbidden
+	KindNotFound
+	KindConflict
+	KindUnprocessable
+	KindInsufficientStock
+	KindTooManyRequests
+	KindTimeout
+)
+
+// AppError is an error whose message is safe to show to clients. Code is a
+// stable machine readable identifier; the message may change wording.
+type AppError struct {
+	Kind    ErrorKind
+	Code    string
+	Message string
+	Fields  []FieldError
+
+	// Err is the underlying cause. It is logged, never sent to the client.
+	Err error
+}
+
+// FieldError describes one invalid field of a request
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *AppError) Error() string {
+	return e.Message
+}
+
+func (e *AppError) Unwrap() error {
+	return e.Err
+}
+
+// HTTPStatus is the status code responses for this error use
+func (e *AppError) HTTPStatus() int {
+	switch e.Kind {
+	case KindValidation:
+		return http.StatusBadRequest
+	case KindUnauthorized:
+		return http.StatusUnauthorized
+	case KindForbidden:
+		return http.StatusForbidden
+	case KindNotFound:
+		return http.StatusNotFound
+	case KindConflict, KindInsufficientStock:
+		return http.StatusConflict
+	case KindUnprocessable:
+		return http.StatusUnprocessableEntity
+	case KindTooManyRequests:
+		return http.StatusTooManyRequests
+	case KindTimeout:
+		return http.StatusGatewayTimeout
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func NewValidationError(code, message string) *AppError {
+	return &AppError{Kind: KindValidation, Code: code, Message: message}
+}
+
+func NewUnauthorizedError(code, message string) *AppError {
+	return &AppError{Kind: KindUnauthorized, Code: code, Message: message}
+}
+
+func NewForbiddenError(code, message string) *AppError {
+	return &AppError{Kind: KindForbidden, Code: code, Message: message}
+}
+
+func NewNotFoundError(code, message string) *AppError {
+	return &AppError{Kind: KindNotFound, Code: code, Message: message}
+}
+
+func NewConflictError(code, message string) *AppError {
+	return &AppError{Kind: KindConflict, Code: code, Message: message}
+}
+
+func NewUnprocessableError(code, message string) *AppError {
+	return &AppError{Kind: KindUnprocessable, Code: code, Message: message}
+}
+
+func NewInsufficientStockError(message string) *AppError {
+	return &AppError{Kind: KindInsufficientStock, Code: "insufficient_stock", Message: message}
+}
+
+// defaultErrorCode is the code of errors that carry none of their own
+func defaultErrorCode(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return "bad_request"
+	case http.StatusUnauthorized:
+		return "unauthorized"
+	case http.StatusForbidden:
+		return "forbidden"
+	case http.StatusNotFound:
+		return "not_found"
+	case http.StatusConflict:
+		return "conflict"
+	case http.StatusUnprocessableEntity:
+		return "unprocessable_entity"
+	case http.StatusTooManyRequests:
+		return "rate_limited"
+	default:
+		if status >= http.StatusInternalServerError {
+			return "internal_error"
+		}
+		return strings.ToLower(strings.ReplaceAll(http.StatusText(status), " ", "_"))
+	}
+}
+
+// bindingError turns request binding errors from gin into field details. It
+// returns nil for anything else.
+func bindingError(err error) *AppError {
+	var validationErrors validator.ValidationErrors
+	if errors.As(err, &validationErrors) {
+		fields := make([]FieldError, len(validationErrors))
+		for i, fe := range validationErrors {
+			fields[i] = FieldError{
+				Field:   fieldPath(fe),
+				Code:    fe.Tag(),
+				Message: validationMessage(fe),
+			}
+		}
+
+		return &AppError{
+			Kind:    KindValidation,
+			Code:    "validation_failed",
+			Message: "request validation failed",
+			Fields:  fields,
+		}
+	}
+
+	var typeError *json.UnmarshalTypeError
+	if errors.As(err, &typeError) {
+		return &AppError{
+			Kind:    KindValidation,
+			Code:    "validation_failed",
+			Message: "request validation failed",
+			Fields: []FieldError{{
+				Field:   typeError.Field,
+				Code:    "type",
+				Message: "must be of type " + typeError.Type.String(),
+			}},
+		}
+	}
+
+	var syntaxError *json.SyntaxError
+	if errors.As(err, &syntaxError) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return NewValidationError("malformed_json", "request body is not valid JSON")
+	}
+
+	return nil
+}
+
+// fieldPath drops the struct name from the namespace, so
+// CreateOrderRequest.items[0].quantity becomes items[0].quantity
+func fieldPath(fe validator.FieldError) string {
+	if _, path, ok := strings.Cut(fe.Namespace(), "."); ok {
+		return path
+	}
+	return fe.Field()
+}
+
+func validationMessage(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "email":
+		return "must be a valid email address"
+	case "min":
+		return fmt.Sprintf("must be at least %s", fe.Param())
+	case "max":
+		return fmt.Sprintf("must be at most %s", fe.Param())
+	case "len":
+		return fmt.Sprintf("must have length %s", fe.Param())
+	case "gt":
+		return fmt.Sprintf("must be greater than %s", fe.Param())
+	case "gte":
+		return fmt.Sprintf("must be at least %s", fe.Param())
+	case "lt":
+		return fmt.Sprintf("must be less than %s", fe.Param())
+	case "lte":
+		return fmt.Sprintf("must be at most %s", fe.Param())
+	case "oneof":
+		return fmt.Sprintf("must be one of: %s", fe.Param())
+	default:
+		return fmt.Sprintf("failed the %s check", fe.Tag())
+	}
+}
+
+// RegisterJSONFieldNames makes gin's validator name fields by their json tag,
+// so validation details use the names clients send
+func RegisterJSONFieldNames() {
+	v, ok := binding.Validator.Engine().(*validator.Validate)
+	if !ok {
+		return
+	}
+
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			return ""
+		}
+		if name == "" {
+			return field.Name
+		}
+		return name
+	})
+}
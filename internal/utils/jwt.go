@@ -2,52 +2,74 @@ package utils
 
 import (
 	"errors"
+	"strconv"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 	"github.com/joefazee/learning-go-shop/internal/config"
 )
 
+// TokenTypeAccess marks access tokens. Refresh tokens are opaque and never
+// carry claims, so a JWT without this type is not accepted as an access token.
+const TokenTypeAccess = "access"
+
 // Claims contains the data for the user
 type Claims struct {
+	TokenType string `json:"token_type"`
+
 	UserID uint   `json:"user_id"`
 	Email  string `json:"email"`
 	Role   string `json:"role"`
+	MFA    bool   `json:"mfa,omitempty"` // session was established with a second factor
+
+	SessionID    string `json:"sid,omitempty"`
+	TokenVersion int    `json:"ver"`
 	jwt.RegisteredClaims
 }
 
-// GenerateTokenPair generates access and refresh token
-func GenerateTokenPair(cfg *config.JWTConfig, userID uint, email, role string) (accessToken, refreshToken string, err error) {
+// TokenSubject is who a token pair is issued to
+type TokenSubject struct {
+	UserID    uint
+	Email     string
+	Role      string
+	MFA       bool
+	SessionID string
+
+	TokenVersion int
+}
+
+// GenerateTokenPair generates a signed access token and an opaque refresh
+// token. Only the hash of the refresh token (HashToken) should be stored.
+func GenerateTokenPair(keys *KeySet, cfg *config.JWTConfig, subject *TokenSubject) (accessToken, refreshToken string, err error) {
 
 	// Access token
 	accessClaims := &Claims{
-		UserID: userID,
-		Email:  email,
-		Role:   role,
+		TokenType: TokenTypeAccess,
+		UserID:    subject.UserID,
+		Email:     subject.Email,
+		Role:      subject.Role,
+		MFA:       subject.MFA,
+		SessionID: subject.SessionID,
+
+		TokenVersion: subject.TokenVersion,
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.NewString(),
+			Issuer:    cfg.Issuer,
+			Subject:   strconv.FormatUint(uint64(subject.UserID), 10),
+			Audience:  jwt.ClaimStrings{cfg.Audience},
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(cfg.ExpiresIn)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
 	}
 
-	at := jwt.NewWithClaims(jwt.SigningMethodHS256, accessClaims)
-	accessTokenString, err := at.SignedString([]byte(cfg.Secret))
+	accessTokenString, err := keys.Sign(accessClaims)
 	if err != nil {
 		return "", "", err
 	}
 
 	// Refresh token
-	refreshClaims := &Claims{
-		UserID: userID,
-		Email:  email,
-		Role:   role,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(cfg.RefreshTokenExpires)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-		},
-	}
-	rt := jwt.NewWithClaims(jwt.SigningMethodHS256, refreshClaims)
-	refreshTokenString, err := rt.SignedString([]byte(cfg.Secret))
+	refreshTokenString, err := GenerateRandomToken(32)
 	if err != nil {
 		return "", "", err
 	}
@@ -55,20 +77,99 @@ func GenerateTokenPair(cfg *config.JWTConfig, userID uint, email, role string) (
 	return accessTokenString, refreshTokenString, nil
 }
 
-// ValidateToken checks if jwt token is valid
-func ValidateToken(tokenString, secret string) (*Claims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		return []byte(secret), nil
-	})
+// ValidateAccessToken checks signature, issuer, audience and token type of an access token
+func ValidateAccessToken(tokenString string, keys *KeySet, cfg *config.JWTConfig) (*Claims, error) {
+	token, err := keys.Parse(tokenString, &Claims{},
+		jwt.WithIssuer(cfg.Issuer),
+		jwt.WithAudience(cfg.Audience),
+		jwt.WithExpirationRequired(),
+	)
 
 	if err != nil {
 		return nil, err
 	}
 
-	if claims, ok := token.Claims.(*Claims); ok && token.Valid {
+	// token_type กัน token ชนิดอื่น (เช่น order lookup, mfa challenge) ที่ sign ด้วย secret เดียวกัน
+	if claims, ok := token.Claims.(*Claims); ok && token.Valid && claims.TokenType == TokenTypeAccess && claims.UserID != 0 {
 		return claims, nil
 	}
 
 	return nil, errors.New("invalid token")
 
-}
\ No newline at end of file
+}
+
+const orderLookupSubject = "order-lookup"
+
+// OrderLookupClaims identifies a single guest order
+type OrderLookupClaims struct {
+	OrderID uint   `json:"order_id"`
+	Email   string `json:"email"`
+	jwt.RegisteredClaims
+}
+
+// GenerateOrderLookupToken signs a token that lets a guest view one order
+func GenerateOrderLookupToken(keys *KeySet, cfg *config.JWTConfig, orderID uint, email string) (string, error) {
+	claims := &OrderLookupClaims{
+		OrderID: orderID,
+		Email:   email,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   orderLookupSubject,
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(cfg.OrderLookupExpires)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	}
+
+	return keys.Sign(claims)
+}
+
+// ValidateOrderLookupToken checks an order lookup token
+func ValidateOrderLookupToken(tokenString string, keys *KeySet) (*OrderLookupClaims, error) {
+	token, err := keys.Parse(tokenString, &OrderLookupClaims{}, jwt.WithSubject(orderLookupSubject), jwt.WithExpirationRequired())
+
+	if err != nil {
+		return nil, err
+	}
+
+	if claims, ok := token.Claims.(*OrderLookupClaims); ok && token.Valid && claims.OrderID != 0 {
+		return claims, nil
+	}
+
+	return nil, errors.New("invalid order lookup token")
+}
+
+const mfaChallengeSubject = "mfa-challenge"
+
+// MFAChallengeClaims identifies a user who passed the password step of login
+type MFAChallengeClaims struct {
+	ChallengeUserID uint `json:"challenge_user_id"`
+	jwt.RegisteredClaims
+}
+
+// GenerateMFAChallengeToken signs a short-lived token for the second login step
+func GenerateMFAChallengeToken(keys *KeySet, userID uint, expiresIn time.Duration) (string, error) {
+	claims := &MFAChallengeClaims{
+		ChallengeUserID: userID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   mfaChallengeSubject,
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiresIn)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	}
+
+	return keys.Sign(claims)
+}
+
+// ValidateMFAChallengeToken checks an MFA challenge token
+func ValidateMFAChallengeToken(tokenString string, keys *KeySet) (*MFAChallengeClaims, error) {
+	token, err := keys.Parse(tokenString, &MFAChallengeClaims{}, jwt.WithSubject(mfaChallengeSubject), jwt.WithExpirationRequired())
+
+	if err != nil {
+		return nil, err
+	}
+
+	if claims, ok := token.Claims.(*MFAChallengeClaims); ok && token.Valid && claims.ChallengeUserID != 0 {
+		return claims, nil
+	}
+
+	return nil, errors.New("invalid mfa challenge token")
+}
@@ -0,0 +1,116 @@
+package utils
+
+import (
+	"testing"
+	"time"
+
+	"github.com/joefazee/learning-go-shop/internal/config"
+)
+
+func newTestKeySet(t *testing.T) (*KeySet, *config.JWTConfig) {
+	t.Helper()
+
+	cfg := &config.JWTConfig{
+		Secret:             "test-secret",
+		ExpiresIn:          time.Hour,
+		OrderLookupExpires: time.Hour,
+		Issuer:             "test-issuer",
+		Audience:           "test-audience",
+	}
+
+	keys, err := LoadKeySet(cfg)
+	if err != nil {
+		t.Fatalf("LoadKeySet: %v", err)
+	}
+	return keys, cfg
+}
+
+func TestValidateAccessTokenAcceptsAccessToken(t *testing.T) {
+	keys, cfg := newTestKeySet(t)
+
+	access, _, err := GenerateTokenPair(keys, cfg, &TokenSubject{UserID: 7, Email: "a@example.com", SessionID: "sid", TokenVersion: 3})
+	if err != nil {
+		t.Fatalf("GenerateTokenPair: %v", err)
+	}
+
+	claims, err := ValidateAccessToken(access, keys, cfg)
+	if err != nil {
+		t.Fatalf("ValidateAccessToken: %v", err)
+	}
+	if claims.UserID != 7 || claims.SessionID != "sid" || claims.TokenVersion != 3 {
+		t.Errorf("unexpected claims %+v", claims)
+	}
+	if claims.ID == "" || claims.Issuer != cfg.Issuer || len(claims.Audience) != 1 || claims.Audience[0] != cfg.Audience {
+		t.Errorf("registered claims not populated: %+v", claims.RegisteredClaims)
+	}
+}
+
+func TestValidateAccessTokenRejectsMisuse(t *testing.T) {
+	keys, cfg := newTestKeySet(t)
+
+	_, refresh, err := GenerateTokenPair(keys, cfg, &TokenSubject{UserID: 7})
+	if err != nil {
+		t.Fatalf("GenerateTokenPair: %v", err)
+	}
+	lookup, err := GenerateOrderLookupToken(keys, cfg, 1, "a@example.com")
+	if err != nil {
+		t.Fatalf("GenerateOrderLookupToken: %v", err)
+	}
+	challenge, err := GenerateMFAChallengeToken(keys, 7, time.Minute)
+	if err != nil {
+		t.Fatalf("GenerateMFAChallengeToken: %v", err)
+	}
+
+	otherIssuer := *cfg
+	otherIssuer.Issuer = "someone-else"
+	foreignIssuer, _, _ := GenerateTokenPair(keys, &otherIssuer, &TokenSubject{UserID: 7})
+
+	otherAudience := *cfg
+	otherAudience.Audience = "another-api"
+	foreignAudience, _, _ := GenerateTokenPair(keys, &otherAudience, &TokenSubject{UserID: 7})
+
+	expiredCfg := *cfg
+	expiredCfg.ExpiresIn = -time.Minute
+	expired, _, _ := GenerateTokenPair(keys, &expiredCfg, &TokenSubject{UserID: 7})
+
+	otherKeys, _ := newTestKeySet(t)
+	otherKeys.active.private = []byte("another-secret")
+	forged, _, _ := GenerateTokenPair(otherKeys, cfg, &TokenSubject{UserID: 7})
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"refresh token", refresh},
+		{"order lookup token", lookup},
+		{"mfa challenge token", challenge},
+		{"wrong issuer", foreignIssuer},
+		{"wrong audience", foreignAudience},
+		{"expired", expired},
+		{"signed with another key", forged},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ValidateAccessToken(tt.token, keys, cfg); err == nil {
+				t.Fatal("expected the token to be rejected as an access token")
+			}
+		})
+	}
+}
+
+func TestAccessTokenIsNotAcceptedAsOtherTokenTypes(t *testing.T) {
+	keys, cfg := newTestKeySet(t)
+
+	access, _, err := GenerateTokenPair(keys, cfg, &TokenSubject{UserID: 7})
+	if err != nil {
+		t.Fatalf("GenerateTokenPair: %v", err)
+	}
+
+	if _, err := ValidateOrderLookupToken(access, keys); err == nil {
+		t.Error("access token accepted as order lookup token")
+	}
+	if _, err := ValidateMFAChallengeToken(access, keys); err == nil {
+		t.Error("access token accepted as mfa challenge token")
+	}
+}
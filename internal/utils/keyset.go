@@ -0,0 +1,244 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/joefazee/learning-go-shop/internal/config"
+)
+
+const (
+	algHS256 = "HS256"
+	algRS256 = "RS256"
+	algEdDSA = "EdDSA"
+
+	// hmacKeyID is the kid of the shared-secret key. Tokens issued before key
+	// ids existed carry no kid and are matched to it as well.
+	hmacKeyID = "hs256"
+)
+
+// signingKey is one entry of a KeySet. Keys without a private part can only
+// verify tokens, which is how retired keys are kept until their tokens expire.
+type signingKey struct {
+	id        string
+	algorithm string
+	method    jwt.SigningMethod
+	private   interface{}
+	public    interface{}
+}
+
+// KeySet signs access tokens with the active key and verifies tokens against
+// every key it holds, selected by the kid header
+type KeySet struct {
+	active *signingKey
+	keys   map[string]*signingKey
+}
+
+// LoadKeySet builds the key set described by the JWT config. Without a keys
+// directory the shared secret is used with HS256.
+func LoadKeySet(cfg *config.JWTConfig) (*KeySet, error) {
+	ks := &KeySet{keys: map[string]*signingKey{}}
+
+	hmacKey := &signingKey{
+		id:        hmacKeyID,
+		algorithm: algHS256,
+		method:    jwt.SigningMethodHS256,
+		private:   []byte(cfg.Secret),
+		public:    []byte(cfg.Secret),
+	}
+
+	if cfg.KeysDir == "" {
+		ks.keys[hmacKeyID] = hmacKey
+		ks.active = hmacKey
+		return ks, nil
+	}
+
+	files, err := filepath.Glob(filepath.Join(cfg.KeysDir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, file := range files {
+		key, err := loadPEMKey(file)
+		if err != nil {
+			return nil, fmt.Errorf("jwt key %s: %w", file, err)
+		}
+		ks.keys[key.id] = key
+	}
+
+	active, ok := ks.keys[cfg.ActiveKeyID]
+	if !ok {
+		return nil, fmt.Errorf("jwt: active key %q not found in %s", cfg.ActiveKeyID, cfg.KeysDir)
+	}
+	if active.private == nil {
+		return nil, fmt.Errorf("jwt: active key %q has no private key", cfg.ActiveKeyID)
+	}
+	ks.active = active
+
+	// ช่วงย้ายจาก HS256 => token เก่ายัง verify ได้จนหมดอายุ
+	if cfg.AcceptHS256 {
+		ks.keys[hmacKeyID] = hmacKey
+	}
+
+	return ks, nil
+}
+
+// Sign signs claims with the active key and sets the kid header
+func (ks *KeySet) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(ks.active.method, claims)
+	token.Header["kid"] = ks.active.id
+
+	return token.SignedString(ks.active.private)
+}
+
+// Parse verifies a token against the key named by its kid. The algorithm in
+// the header must be the one the key was created for.
+func (ks *KeySet) Parse(tokenString string, claims jwt.Claims, opts ...jwt.ParserOption) (*jwt.Token, error) {
+	opts = append(opts, jwt.WithValidMethods(ks.algorithms()))
+	return jwt.ParseWithClaims(tokenString, claims, ks.keyfunc, opts...)
+}
+
+func (ks *KeySet) keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		kid = hmacKeyID
+	}
+
+	key, ok := ks.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+
+	if token.Method.Alg() != key.algorithm {
+		return nil, fmt.Errorf("unexpected signing method %q for key %q", token.Method.Alg(), kid)
+	}
+
+	return key.public, nil
+}
+
+func (ks *KeySet) algorithms() []string {
+	seen := map[string]bool{}
+	var algs []string
+	for _, key := range ks.keys {
+		if !seen[key.algorithm] {
+			seen[key.algorithm] = true
+			algs = append(algs, key.algorithm)
+		}
+	}
+	return algs
+}
+
+// JWK is a public key in JSON Web Key format (RFC 7517)
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+
+	// Ed25519
+	Curve string `json:"crv,omitempty"`
+	X     string `json:"x,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public keys other services need to verify tokens.
+// The shared HS256 secret is never published.
+func (ks *KeySet) JWKS() JWKS {
+	jwks := JWKS{Keys: []JWK{}}
+
+	for _, key := range ks.keys {
+		switch pub := key.public.(type) {
+		case *rsa.PublicKey:
+			jwks.Keys = append(jwks.Keys, JWK{
+				KeyType:   "RSA",
+				KeyID:     key.id,
+				Use:       "sig",
+				Algorithm: key.algorithm,
+				N:         base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+				E:         base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+			})
+		case ed25519.PublicKey:
+			jwks.Keys = append(jwks.Keys, JWK{
+				KeyType:   "OKP",
+				KeyID:     key.id,
+				Use:       "sig",
+				Algorithm: key.algorithm,
+				Curve:     "Ed25519",
+				X:         base64.RawURLEncoding.EncodeToString(pub),
+			})
+		}
+	}
+
+	sort.Slice(jwks.Keys, func(i, j int) bool { return jwks.Keys[i].KeyID < jwks.Keys[j].KeyID })
+	return jwks
+}
+
+// loadPEMKey reads a private or public RSA/Ed25519 key. The file name without
+// extension is used as the key id.
+func loadPEMKey(path string) (*signingKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	key := &signingKey{id: strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))}
+
+	var parsed interface{}
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if signer, ok := parsed.(crypto.Signer); ok {
+		key.private = signer
+		parsed = signer.Public()
+	}
+
+	switch pub := parsed.(type) {
+	case *rsa.PublicKey:
+		key.algorithm = algRS256
+		key.method = jwt.SigningMethodRS256
+		key.public = pub
+	case ed25519.PublicKey:
+		key.algorithm = algEdDSA
+		key.method = jwt.SigningMethodEdDSA
+		key.public = pub
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", parsed)
+	}
+
+	return key, nil
+}
@@ -1,16 +1,39 @@
 package utils
 
 import (
+	"context"
+	"errors"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
+const problemContentType = "application/problem+json"
+
 type Response struct {
-	Success bool        `json:"success"`
-	Message string      `json:"message"`
-	Data    interface{} `json:"data"`
-	Error   string      `json:"error"`
+	Success bool         `json:"success"`
+	Message string       `json:"message"`
+	Data    interface{}  `json:"data"`
+	Error   string       `json:"error"`
+	Code    string       `json:"code,omitempty"`
+	Details []FieldError `json:"details,omitempty"`
+}
+
+// ProblemDetails is an RFC 7807 error body, sent instead of Response to
+// clients whose Accept header asks for application/problem+json
+type ProblemDetails struct {
+	Type     string       `json:"type"`
+	Title    string       `json:"title"`
+	Status   int          `json:"status"`
+	Detail   string       `json:"detail,omitempty"`
+	Instance string       `json:"instance,omitempty"`
+	Code     string       `json:"code"`
+	Errors   []FieldError `json:"errors,omitempty"`
 }
 
 type PaginatedResponse struct {
@@ -41,17 +64,72 @@ func CreatedResponse(c *gin.Context, message string, data interface{}) {
 	})
 }
 
+// ErrorResponse writes an error. Only AppErrors and request binding errors
+// are described to the client; other errors (raw database errors and the
+// like) are attached to the context for logging and otherwise hidden.
 func ErrorResponse(c *gin.Context, statusCode int, message string, err error) {
-	response := Response{
+	code := defaultErrorCode(statusCode)
+	var detail string
+	var fields []FieldError
+
+	if err != nil {
+		_ = c.Error(err)
+
+		appErr := bindingError(err)
+		if appErr == nil {
+			errors.As(err, &appErr)
+		}
+		if appErr != nil {
+			code, detail, fields = appErr.Code, appErr.Message, appErr.Fields
+		}
+	}
+
+	if strings.Contains(c.GetHeader("Accept"), problemContentType) {
+		if detail == "" {
+			detail = message
+		}
+		c.Header("Content-Type", problemContentType)
+		c.JSON(statusCode, ProblemDetails{
+			Type:     "about:blank",
+			Title:    http.StatusText(statusCode),
+			Status:   statusCode,
+			Detail:   detail,
+			Instance: c.Request.URL.Path,
+			Code:     code,
+			Errors:   fields,
+		})
+		return
+	}
+
+	c.JSON(statusCode, Response{
 		Success: false,
 		Message: message,
+		Error:   detail,
+		Code:    code,
+		Details: fields,
+	})
+}
+
+// ServiceErrorResponse maps an error returned by a service: AppErrors use
+// their own status, missing records are a 404 and anything else is a 500
+func ServiceErrorResponse(c *gin.Context, message string, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		err = &AppError{Kind: KindNotFound, Code: "not_found", Message: "resource not found", Err: err}
+	case errors.Is(err, gorm.ErrDuplicatedKey):
+		err = &AppError{Kind: KindConflict, Code: "duplicate", Message: "a record with the same unique value already exists", Err: err}
+	case errors.Is(err, context.DeadlineExceeded):
+		// เกิน REQUEST_TIMEOUT งานที่ค้างใน DB/S3 ถูกยกเลิกไปแล้ว
+		err = &AppError{Kind: KindTimeout, Code: "request_timeout", Message: "the request took too long to process", Err: err}
 	}
 
-	if err != nil {
-		response.Error = err.Error()
+	var appErr *AppError
+	if errors.As(err, &appErr) {
+		ErrorResponse(c, appErr.HTTPStatus(), message, err)
+		return
 	}
 
-	c.JSON(statusCode, response)
+	InternalServerErrorResponse(c, message, err)
 }
 
 func BadRequestResponse(c *gin.Context, message string, err error) {
@@ -70,6 +148,22 @@ func NotFoundResponse(c *gin.Context, message string) {
 	ErrorResponse(c, http.StatusNotFound, message, nil)
 }
 
+// ConflictResponse reports a 409 along with data describing the conflict
+func ConflictResponse(c *gin.Context, message string, data interface{}) {
+	c.JSON(http.StatusConflict, Response{
+		Success: false,
+		Message: message,
+		Data:    data,
+		Code:    defaultErrorCode(http.StatusConflict),
+	})
+}
+
+// TooManyRequestsResponse reports a 429 and tells the client when to retry
+func TooManyRequestsResponse(c *gin.Context, message string, retryAfter time.Duration) {
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	ErrorResponse(c, http.StatusTooManyRequests, message, nil)
+}
+
 func InternalServerErrorResponse(c *gin.Context, message string, err error) {
 	ErrorResponse(c, http.StatusInternalServerError, message, err)
 }
@@ -83,4 +177,4 @@ func PaginatedSuccessResponse(c *gin.Context, message string, data interface{},
 		},
 		Meta: meta,
 	})
-}
\ No newline at end of file
+}